@@ -35,6 +35,8 @@ const DefaultMaxDuration = 20 * time.Millisecond
 // function that takes single inputs (Func.Invoke). Multiple concurrenct
 // invocations of Func.Invoke get combined into a single call to Func.Many.
 type Func struct {
+	// Name optionally identifies the Func in Stats.
+	Name string
 	// Many computes a function for a batch of inputs. For example, a Func
 	// might fetch multiple rows from MySQL.
 	Many func(ctx context.Context, args []interface{}) ([]interface{}, error)
@@ -43,6 +45,11 @@ type Func struct {
 	// database might shard by table so that each invocation of Many only has to
 	// fetch rows from a single table.
 	Shard func(arg interface{}) (shard interface{})
+	// Key optionally identifies the inputs that Many computes the same result
+	// for, such as a foreign key shared by many parents. Invocations in a batch
+	// whose inputs have the same key are passed to Many once, as the first
+	// such input, and share its result. Keys must be comparable.
+	Key func(arg interface{}) (key interface{})
 	// MaxSize optionally limits the size of a batch. After receiving MaxSize
 	// invocations, Many will be invoked even if some goroutines are stil running.
 	// Zero, the default, means no limit.
@@ -61,6 +68,8 @@ type Func struct {
 type batchGroup struct {
 	// args is the array of arguments to be passed to the Func.Many.
 	args []interface{}
+	// keys maps the result of Func.Key for each of args to its index.
+	keys map[interface{}]int
 	// maxSizeCh is a 0-sized channel that is closed when len(args) hits Func.MaxSize.
 	maxSizeCh chan struct{}
 	// intervalTimer is a timer that is reset whenever the batch fn is invoked.
@@ -83,6 +92,68 @@ type funcShard struct {
 type batchContext struct {
 	mu                 sync.Mutex
 	pendingBatchGroups map[funcShard]*batchGroup
+	// stats holds the FuncStats of each Func invoked, in the order they were
+	// first invoked.
+	stats      []*FuncStats
+	statsIndex map[*Func]int
+	// wait, if positive, is the fixed duration of every batch, as set with
+	// WithBatchingWait.
+	wait time.Duration
+}
+
+// FuncStats reports how well a Func batched its invocations, for tuning
+// batched resolvers.
+type FuncStats struct {
+	// Name is the Func's Name.
+	Name string `json:"name"`
+	// Invocations counts the calls to Func.Invoke.
+	Invocations int `json:"invocations"`
+	// Batches counts the calls to Func.Many.
+	Batches int `json:"batches"`
+	// Args counts the arguments passed to Func.Many over all batches.
+	Args int `json:"args"`
+	// Shared counts the invocations that shared the result of an earlier
+	// invocation with the same Func.Key.
+	Shared int `json:"shared"`
+}
+
+// AverageBatchSize returns the average number of arguments passed to Func.Many,
+// or 0 if it was never called. An average close to 1 means the Func degenerated
+// into one call per invocation.
+func (s FuncStats) AverageBatchSize() float64 {
+	if s.Batches == 0 {
+		return 0
+	}
+	return float64(s.Args) / float64(s.Batches)
+}
+
+// funcStats returns the FuncStats of f. bctx.mu must be held.
+func (bctx *batchContext) funcStats(f *Func) *FuncStats {
+	if i, ok := bctx.statsIndex[f]; ok {
+		return bctx.stats[i]
+	}
+	stats := &FuncStats{Name: f.Name}
+	bctx.statsIndex[f] = len(bctx.stats)
+	bctx.stats = append(bctx.stats, stats)
+	return stats
+}
+
+// Stats returns the FuncStats of the Funcs invoked with the given context, in
+// the order they were first invoked, or nil if the context has no batching
+// support. Invocations still waiting for their batch are counted, but not yet
+// their batch.
+func Stats(ctx context.Context) []FuncStats {
+	bctx, ok := ctx.Value(batchContextKey{}).(*batchContext)
+	if !ok {
+		return nil
+	}
+	bctx.mu.Lock()
+	defer bctx.mu.Unlock()
+	stats := make([]FuncStats, 0, len(bctx.stats))
+	for _, s := range bctx.stats {
+		stats = append(stats, *s)
+	}
+	return stats
 }
 
 // batchContextKey is a context.Value key used for type *batchContext.
@@ -96,10 +167,24 @@ func WithBatching(ctx context.Context) context.Context {
 
 	bctx := &batchContext{
 		pendingBatchGroups: make(map[funcShard]*batchGroup),
+		statsIndex:         make(map[*Func]int),
 	}
 	return context.WithValue(ctx, batchContextKey{}, bctx)
 }
 
+// WithBatchingWait is like WithBatching, but every batch waits d after its
+// first invocation before calling Many, instead of the WaitInterval and
+// MaxDuration of its Func. All invocations made within d are combined into a
+// single batch. The timings of a Func are fixed by its author, as with the
+// Funcs built by BatchFieldFunc, so this lets a server tune batching for its
+// backends: a longer d trades latency for fewer calls to a slow or
+// rate-limited backend. It also makes batching predictable in tests.
+func WithBatchingWait(ctx context.Context, d time.Duration) context.Context {
+	ctx = WithBatching(ctx)
+	ctx.Value(batchContextKey{}).(*batchContext).wait = d
+	return ctx
+}
+
 // HasBatching returns if the given context has batching support.
 func HasBatching(ctx context.Context) bool {
 	return ctx.Value(batchContextKey{}) != nil
@@ -132,6 +217,11 @@ func (f *Func) Invoke(ctx context.Context, arg interface{}) (interface{}, error)
 		panic("WithBatching must be called on the context before using Func")
 	}
 
+	var key interface{}
+	if f.Key != nil {
+		key = f.Key(arg)
+	}
+
 	// Determine the current Func shard.
 	var shard interface{}
 	if f.Shard != nil {
@@ -146,8 +236,17 @@ func (f *Func) Invoke(ctx context.Context, arg interface{}) (interface{}, error)
 	if f.WaitInterval > 0 {
 		waitInterval = f.WaitInterval
 	}
+	maxDuration := DefaultMaxDuration
+	if f.MaxDuration > 0 {
+		maxDuration = f.MaxDuration
+	}
+	if bctx.wait > 0 {
+		waitInterval, maxDuration = bctx.wait, bctx.wait
+	}
 
 	bctx.mu.Lock()
+	stats := bctx.funcStats(f)
+	stats.Invocations++
 	// Look up the batchGroup for the Func shard, if any.
 	bg, existed := bctx.pendingBatchGroups[fs]
 	var timer *time.Timer
@@ -164,10 +263,6 @@ func (f *Func) Invoke(ctx context.Context, arg interface{}) (interface{}, error)
 		defer bg.intervalTimer.Stop()
 
 		// Setup a MaxDuration timer.
-		maxDuration := DefaultMaxDuration
-		if f.MaxDuration > 0 {
-			maxDuration = f.MaxDuration
-		}
 		timer = time.NewTimer(maxDuration)
 		defer timer.Stop()
 
@@ -185,14 +280,26 @@ func (f *Func) Invoke(ctx context.Context, arg interface{}) (interface{}, error)
 	}
 
 	// Add arg to the list of arguments to the batchGroup, and remember where to
-	// find the result.
-	index := len(bg.args)
-	bg.args = append(bg.args, arg)
+	// find the result. An arg with the same key as an earlier one shares its
+	// result instead.
+	index, shared := bg.keys[key]
+	if f.Key == nil || !shared {
+		index = len(bg.args)
+		bg.args = append(bg.args, arg)
+		if f.Key != nil {
+			if bg.keys == nil {
+				bg.keys = make(map[interface{}]int)
+			}
+			bg.keys[key] = index
+		}
 
-	// Maybe signal to run if we hit max batch size.
-	if f.MaxSize > 0 && len(bg.args) == f.MaxSize {
-		close(bg.maxSizeCh)
-		delete(bctx.pendingBatchGroups, fs)
+		// Maybe signal to run if we hit max batch size.
+		if f.MaxSize > 0 && len(bg.args) == f.MaxSize {
+			close(bg.maxSizeCh)
+			delete(bctx.pendingBatchGroups, fs)
+		}
+	} else {
+		stats.Shared++
 	}
 	bctx.mu.Unlock()
 
@@ -215,6 +322,10 @@ func (f *Func) Invoke(ctx context.Context, arg interface{}) (interface{}, error)
 		if bctx.pendingBatchGroups[fs] == bg {
 			delete(bctx.pendingBatchGroups, fs)
 		}
+		if ctx.Err() == nil {
+			stats.Batches++
+			stats.Args += len(bg.args)
+		}
 		bctx.mu.Unlock()
 
 		// Check for the context being canceled.
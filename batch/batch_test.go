@@ -115,6 +115,42 @@ func TestWaitInterval(t *testing.T) {
 	}
 }
 
+// TestBatchingWait tests that a context with a fixed batch wait combines the
+// invocations made within it into a single batch, even if they are further
+// apart than the Func's WaitInterval.
+func TestBatchingWait(t *testing.T) {
+	var mu sync.Mutex
+	calls := 0
+	f := (&batch.Func{
+		Many: func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			calls++
+			return args, nil
+		},
+		WaitInterval: time.Millisecond,
+	}).Invoke
+
+	ctx := batch.WithBatchingWait(context.Background(), 100*time.Millisecond)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			time.Sleep(time.Duration(i) * 5 * time.Millisecond)
+			if result, err := f(ctx, i); err != nil || result != i {
+				t.Error(err, i)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if calls != 1 {
+		t.Errorf("expected 1 batch, but received %d", calls)
+	}
+}
+
 // TestBackToBack tests that two back-to-back invocations of batch.Func from
 // multiple goroutines get batched in a total of two calls.
 func TestBackToBack(t *testing.T) {
@@ -193,6 +229,103 @@ func TestShard(t *testing.T) {
 	}
 }
 
+type keyedArg struct {
+	parent int
+	teamID int
+}
+
+// TestKey tests that Func.Key passes arguments with the same key to Many once
+// and shares their result.
+func TestKey(t *testing.T) {
+	var mu sync.Mutex
+	var loaded []int
+	f := (&batch.Func{
+		Many: func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			results := make([]interface{}, len(args))
+			for i, arg := range args {
+				loaded = append(loaded, arg.(keyedArg).teamID)
+				results[i] = arg.(keyedArg).teamID * 10
+			}
+			return results, nil
+		},
+		Key: func(arg interface{}) interface{} {
+			return arg.(keyedArg).teamID
+		},
+		WaitInterval: 10 * time.Millisecond,
+	}).Invoke
+
+	ctx := batch.WithBatching(context.Background())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			arg := keyedArg{parent: i, teamID: i % 3}
+			if result, err := f(ctx, arg); err != nil || result != arg.teamID*10 {
+				t.Error(err, result, arg)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Expect each key to be loaded once, allowing for a second batch in case of
+	// races.
+	if len(loaded) < 3 || len(loaded) > 6 {
+		t.Error(loaded)
+	}
+}
+
+// TestStats tests that Stats reports the invocations and batches of each Func.
+func TestStats(t *testing.T) {
+	f := &batch.Func{
+		Name: "teams",
+		Many: func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			return args, nil
+		},
+		Key: func(arg interface{}) interface{} {
+			return arg.(keyedArg).teamID
+		},
+		WaitInterval: 10 * time.Millisecond,
+	}
+
+	ctx := batch.WithBatching(context.Background())
+	if stats := batch.Stats(ctx); len(stats) != 0 {
+		t.Error(stats)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := f.Invoke(ctx, keyedArg{parent: i, teamID: i % 4}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	stats := batch.Stats(ctx)
+	if len(stats) != 1 || stats[0].Name != "teams" || stats[0].Invocations != 20 {
+		t.Fatal(stats)
+	}
+	// Expect 1 batch of the 4 keys, allowing for a second in case of races.
+	s := stats[0]
+	if s.Batches < 1 || s.Batches > 2 || s.Args+s.Shared != 20 || s.Args < 4 || s.Args > 8 {
+		t.Error(s)
+	}
+	if s.AverageBatchSize() != float64(s.Args)/float64(s.Batches) {
+		t.Error(s.AverageBatchSize())
+	}
+
+	if stats := batch.Stats(context.Background()); stats != nil {
+		t.Error(stats)
+	}
+}
+
 // TestMaxSize tests that no more than Func.MaxSize arguments get batched
 // together.
 func TestMaxSize(t *testing.T) {
@@ -0,0 +1,81 @@
+package graphql
+
+import "context"
+
+// audiencesKey is the context key for the audiences of the caller.
+type audiencesKey struct{}
+
+// WithAudiences returns a context for a caller in audiences, such as
+// "internal". Fields restricted to audiences, with Field.Audiences, can only
+// be selected by callers in one of them; to other callers, the fields do not
+// exist, and introspection hides them. It is typically called by middleware
+// that authenticates the caller before serving a query.
+func WithAudiences(ctx context.Context, audiences ...string) context.Context {
+	return context.WithValue(ctx, audiencesKey{}, audiences)
+}
+
+// FieldVisible returns true if the caller in ctx can select field, because
+// the field is not restricted to audiences or the caller is in one of them,
+// and the field is not restricted to API versions or exists in the caller's.
+func FieldVisible(ctx context.Context, field *Field) bool {
+	if len(field.Versions) > 0 && !hasVersion(ctx, field) {
+		return false
+	}
+	if len(field.Audiences) == 0 {
+		return true
+	}
+	callerAudiences, _ := ctx.Value(audiencesKey{}).([]string)
+	for _, audience := range field.Audiences {
+		for _, callerAudience := range callerAudiences {
+			if audience == callerAudience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasVersion returns true if field exists in the API version of the caller in
+// ctx.
+func hasVersion(ctx context.Context, field *Field) bool {
+	version := field.Version(ctx)
+	for _, v := range field.Versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAudiences returns an error if selectionSet selects a field of typ that
+// is not visible to the caller in ctx. The error is the same as for a field
+// that is not in the schema.
+func checkAudiences(ctx context.Context, typ Type, selectionSet *SelectionSet) error {
+	switch typ := typ.(type) {
+	case *Object:
+		for _, selection := range Flatten(selectionSet) {
+			field, ok := typ.Fields[selection.Name]
+			if !ok {
+				continue
+			}
+			if !FieldVisible(ctx, field) {
+				return NewClientError(`unknown field "%s"`, selection.Name)
+			}
+			if err := checkAudiences(ctx, field.Type, selection.SelectionSet); err != nil {
+				return err
+			}
+		}
+	case *Interface:
+		for _, name := range typ.typeNames() {
+			object := typ.Types[name]
+			if err := checkAudiences(ctx, object, selectionSetFor(typ, object, selectionSet)); err != nil {
+				return err
+			}
+		}
+	case *List:
+		return checkAudiences(ctx, typ.Type, selectionSet)
+	case *NonNull:
+		return checkAudiences(ctx, typ.Type, selectionSet)
+	}
+	return nil
+}
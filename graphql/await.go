@@ -1,6 +1,10 @@
 package graphql
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"sort"
+)
 
 func await(value interface{}) (interface{}, error) {
 	switch value := value.(type) {
@@ -29,6 +33,105 @@ func await(value interface{}) (interface{}, error) {
 	return value, nil
 }
 
+// awaitWithTimeout is like await, but once ctx's deadline has passed it
+// returns the fields resolved in time, with the failed fields as null, along
+// with the error of the first failed field in the order of their paths.
+func awaitWithTimeout(ctx context.Context, value interface{}) (interface{}, error) {
+	value, errs := awaitFields(nil, value)
+	if len(errs) == 0 {
+		return value, nil
+	}
+	if ctx.Err() != context.DeadlineExceeded {
+		return nil, errs[0]
+	}
+	return value, errs[0]
+}
+
+// awaitFields awaits the thunks of value at path, replacing the thunks that
+// failed and fieldErrors with null, and returns their errors.
+func awaitFields(path []string, value interface{}) (interface{}, []error) {
+	switch v := value.(type) {
+	case *thunk:
+		resolved, err := v.await()
+		if err != nil {
+			return nil, []error{nestPath(path, err)}
+		}
+		return awaitFields(path, resolved)
+
+	case *fieldError:
+		return nil, []error{nestPath(path, v.err)}
+
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var errs []error
+		for _, k := range keys {
+			resolved, fieldErrs := awaitFields(append(path[:len(path):len(path)], k), v[k])
+			v[k] = resolved
+			errs = append(errs, fieldErrs...)
+		}
+		return v, errs
+
+	case []interface{}:
+		var errs []error
+		for i, item := range v {
+			resolved, itemErrs := awaitFields(append(path[:len(path):len(path)], fmt.Sprint(i)), item)
+			v[i] = resolved
+			errs = append(errs, itemErrs...)
+		}
+		return v, errs
+	}
+	return value, nil
+}
+
+// hasThunks returns true if value holds thunks, outside of other thunks.
+func hasThunks(value interface{}) bool {
+	switch value := value.(type) {
+	case *thunk:
+		return true
+
+	case map[string]interface{}:
+		for _, v := range value {
+			if hasThunks(v) {
+				return true
+			}
+		}
+
+	case []interface{}:
+		for _, v := range value {
+			if hasThunks(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// copyResult returns a copy of the maps and slices of value, sharing the
+// thunks and other values they hold, so that the copy can be awaited apart
+// from value.
+func copyResult(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(value))
+		for k, v := range value {
+			copied[k] = copyResult(v)
+		}
+		return copied
+
+	case []interface{}:
+		copied := make([]interface{}, len(value))
+		for i, v := range value {
+			copied[i] = copyResult(v)
+		}
+		return copied
+	}
+	return value
+}
+
 type thunk struct {
 	value interface{}
 	err   error
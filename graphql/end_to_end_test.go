@@ -5,12 +5,16 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"sort"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
+	"github.com/samsarahq/thunder/batch"
 	"github.com/samsarahq/thunder/concurrencylimiter"
 	"github.com/samsarahq/thunder/graphql"
+	"github.com/samsarahq/thunder/graphql/introspection"
 	"github.com/samsarahq/thunder/graphql/schemabuilder"
 	"github.com/samsarahq/thunder/internal"
 	"github.com/samsarahq/thunder/reactive"
@@ -746,6 +750,69 @@ func TestEndToEndAwaitAndCache(t *testing.T) {
 	}
 }
 
+func TestPureFieldCache(t *testing.T) {
+	users := []*User{
+		{Name: "Alice", resource: reactive.NewResource()},
+		{Name: "Bob", resource: reactive.NewResource()},
+	}
+
+	var mu sync.Mutex
+	pureCalls, impureCalls := 0, 0
+
+	schema := schemabuilder.NewSchema()
+	query := schema.Query()
+	query.FieldFunc("users", func() []*User {
+		return users
+	})
+	user := schema.Object("User", User{})
+	user.FieldFunc("pure", func(ctx context.Context, u *User) string {
+		reactive.AddDependency(ctx, u.resource)
+		mu.Lock()
+		pureCalls++
+		mu.Unlock()
+		return u.Name
+	}, schemabuilder.Pure)
+	user.FieldFunc("impure", func(u *User) string {
+		mu.Lock()
+		impureCalls++
+		mu.Unlock()
+		return u.Name
+	})
+	builtSchema := schema.MustBuild()
+
+	q := graphql.MustParse(`{ users { pure impure } }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+
+	results := make(chan interface{})
+	rerunner := reactive.NewRerunner(context.Background(), func(ctx context.Context) (interface{}, error) {
+		e := graphql.Executor{}
+		result, err := e.Execute(ctx, builtSchema.Query, nil, q)
+		if err != nil {
+			t.Error(err)
+		}
+		results <- internal.AsJSON(result)
+		return nil, nil
+	}, 0)
+	defer rerunner.Stop()
+
+	expected := internal.ParseJSON(`{"users": [{"pure": "Alice", "impure": "Alice"}, {"pure": "Bob", "impure": "Bob"}]}`)
+	assert.Equal(t, expected, <-results)
+
+	// Only the pure field whose dependency changed is resolved again.
+	users[0].resource.Strobe()
+	assert.Equal(t, expected, <-results)
+	mu.Lock()
+	defer mu.Unlock()
+	if pureCalls != 3 {
+		t.Errorf("expected 3 calls to pure, got %d", pureCalls)
+	}
+	if impureCalls != 4 {
+		t.Errorf("expected 4 calls to impure, got %d", impureCalls)
+	}
+}
+
 func verifyArgumentOption(t *testing.T, query graphql.Type, queryString string, variables map[string]interface{}, expectedResult string) {
 	q := graphql.MustParse(queryString, variables)
 
@@ -874,3 +941,816 @@ func TestConcurrencyLimiterDeadlock(t *testing.T) {
 	wg.Wait()
 	defer rerunner.Stop()
 }
+
+func TestBatchPaginateFieldFunc(t *testing.T) {
+	type Post struct {
+		Id int64
+	}
+	type User struct {
+		Id int64
+	}
+	type Args struct {
+		MinId int64
+	}
+
+	schema := schemabuilder.NewSchema()
+	schema.Query().FieldFunc("users", func() []*User {
+		return []*User{{Id: 1}, {Id: 2}, {Id: 3}}
+	})
+	schema.Object("Post", Post{}).Key("id")
+
+	var mu sync.Mutex
+	var calls [][]int64
+	user := schema.Object("User", User{})
+	user.BatchPaginateFieldFunc("posts", func(ctx context.Context, users []*User, args Args, page schemabuilder.ConnectionArgs) ([][]*Post, error) {
+		var ids []int64
+		posts := make([][]*Post, len(users))
+		for i, u := range users {
+			ids = append(ids, u.Id)
+			// Load one more post than the page, to report hasNextPage.
+			for n := int64(0); n <= *page.First; n++ {
+				posts[i] = append(posts[i], &Post{Id: u.Id*10 + args.MinId + n})
+			}
+		}
+		mu.Lock()
+		calls = append(calls, ids)
+		mu.Unlock()
+		return posts, nil
+	})
+	builtSchema := schema.MustBuild()
+
+	q := graphql.MustParse(`{ users { posts(first: 2, minId: 5) { edges { node { id } } pageInfo { hasNextPage } } } }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+
+	e := graphql.Executor{}
+	// A fixed batch wait combines the resolutions of all users into one batch.
+	result, err := e.Execute(batch.WithBatchingWait(context.Background(), 50*time.Millisecond), builtSchema.Query, nil, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := func(id int64) string {
+		return fmt.Sprintf(`{"posts": {"edges": [{"node": {"__key": %d, "id": %d}}, {"node": {"__key": %d, "id": %d}}], "pageInfo": {"hasNextPage": true}}}`, id, id, id+1, id+1)
+	}
+	assert.Equal(t, internal.ParseJSON(`{"users": [`+page(15)+`, `+page(25)+`, `+page(35)+`]}`), internal.AsJSON(result))
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(calls) != 1 {
+		t.Errorf("expected the posts to be loaded in one batch, but they were loaded in %v", calls)
+	}
+
+	// Without batching, the posts are loaded per user.
+	calls = nil
+	mu.Unlock()
+	_, err = e.Execute(context.Background(), builtSchema.Query, nil, q)
+	mu.Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 3 {
+		t.Errorf("expected the posts to be loaded per user, but they were loaded in %v", calls)
+	}
+}
+
+func TestBatchFieldFunc(t *testing.T) {
+	type Organization struct {
+		Name string
+	}
+	type User struct {
+		Id    int64
+		OrgId int64
+	}
+	type Args struct {
+		Upper bool
+	}
+
+	schema := schemabuilder.NewSchema()
+	schema.Query().FieldFunc("users", func() []*User {
+		return []*User{{Id: 1, OrgId: 10}, {Id: 2, OrgId: 20}, {Id: 3}}
+	})
+
+	var mu sync.Mutex
+	var calls [][]int64
+	record := func(users []*User) {
+		var ids []int64
+		for _, u := range users {
+			ids = append(ids, u.Id)
+		}
+		mu.Lock()
+		calls = append(calls, ids)
+		mu.Unlock()
+	}
+	user := schema.Object("User", User{})
+	user.BatchFieldFunc("organization", func(ctx context.Context, users []*User) (map[*User]*Organization, error) {
+		record(users)
+		orgs := make(map[*User]*Organization)
+		for _, u := range users {
+			if u.OrgId != 0 {
+				orgs[u] = &Organization{Name: fmt.Sprintf("org%d", u.OrgId)}
+			}
+		}
+		return orgs, nil
+	})
+	user.BatchFieldFunc("label", func(ctx context.Context, users []*User, args Args) ([]string, error) {
+		labels := make([]string, len(users))
+		for i, u := range users {
+			labels[i] = fmt.Sprintf("user%d", u.Id)
+			if args.Upper {
+				labels[i] = strings.ToUpper(labels[i])
+			}
+		}
+		return labels, nil
+	})
+	builtSchema := schema.MustBuild()
+
+	q := graphql.MustParse(`{ users { organization { name } label(upper: false) upper: label(upper: true) } }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+
+	e := graphql.Executor{}
+	// A fixed batch wait combines the resolutions of all users into one batch.
+	result, err := e.Execute(batch.WithBatchingWait(context.Background(), 50*time.Millisecond), builtSchema.Query, nil, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, internal.ParseJSON(`{"users": [
+		{"organization": {"name": "org10"}, "label": "user1", "upper": "USER1"},
+		{"organization": {"name": "org20"}, "label": "user2", "upper": "USER2"},
+		{"organization": null, "label": "user3", "upper": "USER3"}
+	]}`), internal.AsJSON(result))
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(calls) != 1 {
+		t.Errorf("expected the organizations to be loaded in one batch, but they were loaded in %v", calls)
+	}
+
+	// Without batching, the organizations are loaded per user.
+	calls = nil
+	mu.Unlock()
+	_, err = e.Execute(context.Background(), builtSchema.Query, nil, q)
+	mu.Lock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 3 {
+		t.Errorf("expected the organizations to be loaded per user, but they were loaded in %v", calls)
+	}
+
+	assert.Panics(t, func() {
+		schema.Object("User", User{}).BatchFieldFunc("bad", func(ctx context.Context, users []*User, args struct{ Ids []int64 }) ([]string, error) {
+			return nil, nil
+		})
+	})
+}
+
+func TestPaginateCountFunc(t *testing.T) {
+	type Item struct {
+		Id int64
+	}
+	type Inner struct {
+		Limit int64
+	}
+	type Args struct {
+		Offset int64
+	}
+
+	schema := schemabuilder.NewSchema()
+	schema.Query().FieldFunc("inner", func() Inner {
+		return Inner{Limit: 3}
+	})
+	item := schema.Object("item", Item{})
+	item.Key("id")
+
+	counts := 0
+	inner := schema.Object("inner", Inner{})
+	inner.PaginateFieldFunc("items", func(i Inner, args Args) []Item {
+		var items []Item
+		for id := args.Offset; id < args.Offset+i.Limit; id++ {
+			items = append(items, Item{Id: id})
+		}
+		return items
+	}, schemabuilder.CountFunc(func(ctx context.Context, i Inner, args Args) (int64, error) {
+		counts++
+		return 100 - args.Offset, nil
+	}))
+	inner.PaginateFieldFunc("uncounted", func(i Inner) []Item {
+		return []Item{{Id: 1}}
+	})
+	builtSchema := schema.MustBuild()
+
+	fields := builtSchema.Query.(*graphql.Object).Fields["inner"].Type.(*graphql.NonNull).Type.(*graphql.Object).Fields
+	counted := fields["items"].Type.(*graphql.NonNull).Type.(*graphql.Object)
+	uncounted := fields["uncounted"].Type.(*graphql.NonNull).Type.(*graphql.Object)
+	assert.True(t, counted.Fields["totalCount"].Expensive)
+	assert.False(t, uncounted.Fields["totalCount"].Expensive)
+
+	e := graphql.Executor{}
+	for _, c := range []struct {
+		query    string
+		expected string
+		counts   int
+	}{
+		{
+			query:    `{ inner { items(first: 2, offset: 10) { totalCount edges { node { id } } } } }`,
+			expected: `{"inner": {"items": {"totalCount": 90, "edges": [{"node": {"__key": 10, "id": 10}}, {"node": {"__key": 11, "id": 11}}]}}}`,
+			counts:   1,
+		},
+		{
+			query:    `{ inner { items(first: 1, offset: 10) { edges { node { id } } } } }`,
+			expected: `{"inner": {"items": {"edges": [{"node": {"__key": 10, "id": 10}}]}}}`,
+			counts:   1,
+		},
+		{
+			query:    `{ inner { uncounted(first: 1) { totalCount } } }`,
+			expected: `{"inner": {"uncounted": {"totalCount": 1}}}`,
+			counts:   1,
+		},
+	} {
+		q := graphql.MustParse(c.query, nil)
+		if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+			t.Fatal(err)
+		}
+		result, err := e.Execute(context.Background(), builtSchema.Query, nil, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, internal.ParseJSON(c.expected), internal.AsJSON(result))
+		if counts != c.counts {
+			t.Errorf("expected count func to be called %d times, but it was called %d times", c.counts, counts)
+		}
+	}
+
+	invalid := schemabuilder.NewSchema()
+	invalid.Query().FieldFunc("inner", func() Inner { return Inner{} })
+	invalid.Object("item", Item{}).Key("id")
+	invalid.Object("inner", Inner{}).PaginateFieldFunc("items", func(args Args) []Item {
+		return nil
+	}, schemabuilder.CountFunc(func(i Inner) int {
+		return 0
+	}))
+	if _, err := invalid.Build(); err == nil {
+		t.Error("expected a count func returning int to fail")
+	}
+}
+
+func TestFieldFuncWithSummary(t *testing.T) {
+	type Transaction struct {
+		Amount int64
+	}
+	type Account struct {
+		Id int64
+	}
+	type Args struct {
+		MinAmount int64
+	}
+	type TransactionsSummary struct {
+		Total   int64
+		Count   int64
+		Average *float64
+		Largest int64
+	}
+
+	schema := schemabuilder.NewSchema()
+	schema.Query().FieldFunc("account", func() *Account {
+		return &Account{Id: 1}
+	})
+
+	var mu sync.Mutex
+	fetches := 0
+	account := schema.Object("Account", Account{})
+	account.FieldFuncWithSummary("transactions", func(ctx context.Context, a *Account, args Args) ([]*Transaction, error) {
+		mu.Lock()
+		fetches++
+		mu.Unlock()
+		var transactions []*Transaction
+		for _, amount := range []int64{10, 20, 60} {
+			if amount >= args.MinAmount {
+				transactions = append(transactions, &Transaction{Amount: amount})
+			}
+		}
+		return transactions, nil
+	}, "transactionsSummary", TransactionsSummary{},
+		schemabuilder.Aggregate{Field: "Total", Func: schemabuilder.AggregateSum, Of: "Amount"},
+		schemabuilder.Aggregate{Field: "Count", Func: schemabuilder.AggregateCount},
+		schemabuilder.Aggregate{Field: "Average", Func: schemabuilder.AggregateAverage, Of: "Amount"},
+		schemabuilder.Aggregate{Field: "Largest", Func: schemabuilder.AggregateMax, Of: "Amount"},
+	)
+	builtSchema := schema.MustBuild()
+
+	q := graphql.MustParse(`{
+		account {
+			transactions(minAmount: 15) { amount }
+			transactionsSummary(minAmount: 15) { total count average largest }
+			none: transactionsSummary(minAmount: 100) { total count average largest }
+		}
+	}`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+
+	results := make(chan interface{})
+	rerunner := reactive.NewRerunner(context.Background(), func(ctx context.Context) (interface{}, error) {
+		e := graphql.Executor{}
+		result, err := e.Execute(ctx, builtSchema.Query, nil, q)
+		if err != nil {
+			t.Error(err)
+		}
+		results <- internal.AsJSON(result)
+		return nil, nil
+	}, 0)
+	defer rerunner.Stop()
+
+	assert.Equal(t, internal.ParseJSON(`{"account": {
+		"transactions": [{"amount": 20}, {"amount": 60}],
+		"transactionsSummary": {"total": 80, "count": 2, "average": 40, "largest": 60},
+		"none": {"total": 0, "count": 0, "average": null, "largest": 0}
+	}}`), <-results)
+	mu.Lock()
+	defer mu.Unlock()
+	if fetches != 2 {
+		t.Errorf("expected the list to be fetched once per argument, but it was fetched %d times", fetches)
+	}
+}
+
+func TestFieldFuncWithUpdates(t *testing.T) {
+	type Args struct {
+		Symbol string
+	}
+
+	schema := schemabuilder.NewSchema()
+	updates := make(chan int64)
+	stopped := make(chan struct{})
+	var mu sync.Mutex
+	subscribes := 0
+	schema.Query().FieldFuncWithUpdates("price", func(ctx context.Context, args Args) (int64, <-chan int64, error) {
+		mu.Lock()
+		subscribes++
+		mu.Unlock()
+		go func() {
+			<-ctx.Done()
+			close(stopped)
+		}()
+		return 10, updates, nil
+	})
+	builtSchema := schema.MustBuild()
+
+	q := graphql.MustParse(`{ price(symbol: "X") }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+
+	results := make(chan interface{})
+	rerunner := reactive.NewRerunner(context.Background(), func(ctx context.Context) (interface{}, error) {
+		e := graphql.Executor{}
+		result, err := e.Execute(ctx, builtSchema.Query, nil, q)
+		if err != nil {
+			t.Error(err)
+		}
+		results <- internal.AsJSON(result)
+		return nil, nil
+	}, 0)
+
+	assert.Equal(t, internal.ParseJSON(`{"price": 10}`), <-results)
+	updates <- 11
+	assert.Equal(t, internal.ParseJSON(`{"price": 11}`), <-results)
+	updates <- 12
+	assert.Equal(t, internal.ParseJSON(`{"price": 12}`), <-results)
+
+	mu.Lock()
+	if subscribes != 1 {
+		t.Errorf("expected one subscription, but there were %d", subscribes)
+	}
+	mu.Unlock()
+
+	rerunner.Stop()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Error("expected the context to be canceled once the subscription stopped")
+	}
+}
+
+func TestFieldFuncWithSharedUpdates(t *testing.T) {
+	type Args struct {
+		Symbol string
+	}
+
+	schema := schemabuilder.NewSchema()
+	updates := make(chan int64)
+	stopped := make(chan struct{})
+	var mu sync.Mutex
+	subscribes := 0
+	schema.Query().FieldFuncWithSharedUpdates("price", func(ctx context.Context, args Args) (int64, <-chan int64) {
+		mu.Lock()
+		subscribes++
+		mu.Unlock()
+		go func() {
+			<-ctx.Done()
+			stopped <- struct{}{}
+		}()
+		return 10, updates
+	})
+	builtSchema := schema.MustBuild()
+
+	q := graphql.MustParse(`{ price(symbol: "X") }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+
+	subscribe := func() (*reactive.Rerunner, chan interface{}) {
+		// Updates rerun the subscriptions one after another, in any order.
+		results := make(chan interface{}, 1)
+		rerunner := reactive.NewRerunner(context.Background(), func(ctx context.Context) (interface{}, error) {
+			e := graphql.Executor{}
+			result, err := e.Execute(ctx, builtSchema.Query, nil, q)
+			if err != nil {
+				t.Error(err)
+			}
+			results <- internal.AsJSON(result)
+			return nil, nil
+		}, 0)
+		return rerunner, results
+	}
+
+	first, firstResults := subscribe()
+	assert.Equal(t, internal.ParseJSON(`{"price": 10}`), <-firstResults)
+	second, secondResults := subscribe()
+	assert.Equal(t, internal.ParseJSON(`{"price": 10}`), <-secondResults)
+
+	updates <- 11
+	assert.Equal(t, internal.ParseJSON(`{"price": 11}`), <-firstResults)
+	assert.Equal(t, internal.ParseJSON(`{"price": 11}`), <-secondResults)
+
+	mu.Lock()
+	if subscribes != 1 {
+		t.Errorf("expected one shared subscription, but there were %d", subscribes)
+	}
+	mu.Unlock()
+
+	first.Stop()
+	select {
+	case <-stopped:
+		t.Error("expected the shared subscription to continue while a subscriber remained")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	second.Stop()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Error("expected the context to be canceled once the last subscription stopped")
+	}
+}
+
+type txKey struct{}
+
+// recordingTxManager records the transactions it begins and finishes.
+type recordingTxManager struct {
+	mu  sync.Mutex
+	log []string
+}
+
+func (m *recordingTxManager) record(entry string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.log = append(m.log, entry)
+}
+
+func (m *recordingTxManager) Begin(ctx context.Context) (context.Context, error) {
+	m.record("begin")
+	return context.WithValue(ctx, txKey{}, m), nil
+}
+
+func (m *recordingTxManager) Commit(ctx context.Context) error {
+	m.record("commit")
+	return nil
+}
+
+func (m *recordingTxManager) Rollback(ctx context.Context) error {
+	m.record("rollback")
+	return nil
+}
+
+func TestTxManager(t *testing.T) {
+	schema := schemabuilder.NewSchema()
+	schema.Query().FieldFunc("tx", func(ctx context.Context) bool {
+		return ctx.Value(txKey{}) != nil
+	})
+	mutation := schema.Mutation()
+	mutation.FieldFunc("debit", func(ctx context.Context) (string, error) {
+		ctx.Value(txKey{}).(*recordingTxManager).record("debit")
+		return "ok", nil
+	})
+	mutation.FieldFunc("fail", func(ctx context.Context) (string, error) {
+		return "", errors.New("insufficient funds")
+	})
+	builtSchema := schema.MustBuild()
+
+	execute := func(typ graphql.Type, query string) (*recordingTxManager, interface{}, error) {
+		m := &recordingTxManager{}
+		q := graphql.MustParse(query, nil)
+		if err := graphql.PrepareQuery(typ, q.SelectionSet); err != nil {
+			t.Fatal(err)
+		}
+		e := graphql.NewExecutor(graphql.WithTxManager(m))
+		result, err := e.Execute(context.Background(), typ, nil, q)
+		return m, result, err
+	}
+
+	m, result, err := execute(builtSchema.Mutation, `mutation { debit }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, internal.ParseJSON(`{"debit": "ok"}`), internal.AsJSON(result))
+	assert.Equal(t, []string{"begin", "debit", "commit"}, m.log)
+
+	m, result, err = execute(builtSchema.Mutation, `mutation { fail }`)
+	if err == nil || err.Error() != "fail: insufficient funds" || result != nil {
+		t.Errorf("expected the mutation to fail without a result, but received %v, %v", result, err)
+	}
+	assert.Equal(t, []string{"begin", "rollback"}, m.log)
+
+	m, result, err = execute(builtSchema.Query, `{ tx }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, internal.ParseJSON(`{"tx": false}`), internal.AsJSON(result))
+	assert.Empty(t, m.log)
+}
+
+func TestRequireFeature(t *testing.T) {
+	schema := schemabuilder.NewSchema()
+	query := schema.Query()
+	query.FieldFunc("reports", func() *string {
+		report := "q1"
+		return &report
+	}, schemabuilder.RequireFeature("beta-reports"))
+	query.FieldFunc("count", func() int64 {
+		return 1
+	}, schemabuilder.RequireFeature("beta-reports"))
+	query.FieldFunc("stable", func() string {
+		return "ok"
+	})
+	builtSchema := schema.MustBuild()
+
+	execute := func(query string, features ...string) (interface{}, error) {
+		q := graphql.MustParse(query, nil)
+		if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+			t.Fatal(err)
+		}
+		e := graphql.NewExecutor(graphql.WithFeatureChecker(func(ctx context.Context, feature string) bool {
+			for _, enabled := range features {
+				if enabled == feature {
+					return true
+				}
+			}
+			return false
+		}))
+		return e.Execute(context.Background(), builtSchema.Query, nil, q)
+	}
+
+	result, err := execute(`{ reports stable count }`, "beta-reports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, internal.ParseJSON(`{"reports": "q1", "stable": "ok", "count": 1}`), internal.AsJSON(result))
+
+	result, err = execute(`{ reports stable }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, internal.ParseJSON(`{"reports": null, "stable": "ok"}`), internal.AsJSON(result))
+
+	if _, err := execute(`{ count }`); err == nil || err.Error() != "feature beta-reports is disabled" {
+		t.Errorf("expected a disabled feature error, but received %v", err)
+	}
+}
+
+func TestSelected(t *testing.T) {
+	type Order struct {
+		Id int64
+	}
+	type User struct {
+		Name string
+	}
+	paths := []string{"user", "user.name", "user.orders", "user.orders.id", "orders"}
+	var selected []string
+
+	schema := schemabuilder.NewSchema()
+	query := schema.Query()
+	query.FieldFunc("user", func(ctx context.Context) *User {
+		for _, path := range paths {
+			if graphql.Selected(ctx, path) {
+				selected = append(selected, path)
+			}
+		}
+		return &User{Name: "alice"}
+	})
+	user := schema.Object("user", User{})
+	user.FieldFunc("orders", func() []*Order {
+		return []*Order{{Id: 1}}
+	})
+	builtSchema := schema.MustBuild()
+
+	for _, testCase := range []struct {
+		name  string
+		query string
+		vars  map[string]interface{}
+		want  []string
+	}{
+		{
+			name:  "aliased",
+			query: `{ me: user { fullName: name purchases: orders { id } } }`,
+			want:  []string{"user", "user.name", "user.orders", "user.orders.id"},
+		},
+		{
+			name:  "fragment-nested",
+			query: `{ ... on Query { user { ...Orders } } } fragment Orders on user { ... on user { orders { id } } }`,
+			want:  []string{"user", "user.orders", "user.orders.id"},
+		},
+		{
+			name:  "skipped",
+			query: `query Q($skip: Boolean!) { user { name @skip(if: true) orders @include(if: $skip) { id } ... on user @skip(if: $skip) { name } } }`,
+			vars:  map[string]interface{}{"skip": false},
+			want:  []string{"user", "user.name"},
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			selected = nil
+			q, err := graphql.Parse(testCase.query, testCase.vars)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+				t.Fatal(err)
+			}
+			e := graphql.Executor{}
+			if _, err := e.Execute(context.Background(), builtSchema.Query, nil, q); err != nil {
+				t.Fatal(err)
+			}
+			assert.Equal(t, testCase.want, selected)
+		})
+	}
+}
+
+func TestQueryCost(t *testing.T) {
+	type User struct {
+		Id   int64
+		Name string
+	}
+	type FriendsArgs struct {
+		Limit int64
+	}
+
+	schema := schemabuilder.NewSchema()
+	user := schema.Object("User", User{})
+	user.Key("id")
+	user.FieldFunc("friends", func(u *User, args FriendsArgs) []*User {
+		return []*User{{Id: 2, Name: "bob"}}
+	}, schemabuilder.CostFunc(func(args FriendsArgs) int {
+		return int(args.Limit)
+	}))
+	query := schema.Query()
+	query.FieldFunc("users", func() []*User {
+		return []*User{{Id: 1, Name: "alice"}}
+	}, schemabuilder.Cost(2))
+	query.PaginateFieldFunc("pages", func() []*User {
+		return []*User{{Id: 1, Name: "alice"}}
+	})
+	query.FieldFunc("version", func() string {
+		return "1"
+	}, schemabuilder.Cost(0))
+	schema.VersionFunc(func(ctx context.Context) string {
+		return "v2"
+	})
+	query.VersionedFieldFunc("search", map[string]interface{}{
+		"v1": func(args FriendsArgs) []*User { return nil },
+		"v2": func(args FriendsArgs) []*User { return nil },
+	}, schemabuilder.CostFunc(func(args FriendsArgs) int {
+		return int(args.Limit)
+	}))
+	builtSchema := schema.MustBuild()
+	introspection.AddIntrospectionToSchema(builtSchema)
+
+	execute := func(query string, opts ...graphql.ExecutorOption) error {
+		q := graphql.MustParse(query, nil)
+		if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+			t.Fatal(err)
+		}
+		_, err := graphql.NewExecutor(opts...).Execute(context.Background(), builtSchema.Query, nil, q)
+		return err
+	}
+
+	// users costs 2 and friends costs its limit, plus 1 for each name.
+	if err := execute(`{ users { friends(limit: 5) { name } } }`, graphql.WithMaxCost(8), graphql.WithMaxDepth(3)); err != nil {
+		t.Error(err)
+	}
+	if err := execute(`{ users { friends(limit: 6) { name } } }`, graphql.WithMaxCost(8)); err == nil || err.Error() != "query too expensive: cost 9 exceeds the limit of 8" {
+		t.Errorf("expected a cost error, but received %v", err)
+	}
+	if err := execute(`{ users { friends(limit: 1) { friends(limit: 1) { name } } } }`, graphql.WithMaxDepth(3)); err == nil || err.Error() != "query too deep: depth 4 exceeds the limit of 3" {
+		t.Errorf("expected a depth error, but received %v", err)
+	}
+
+	// Fields of cost 0 are free.
+	if err := execute(`{ version users { friends(limit: 5) { name } } }`, graphql.WithMaxCost(8)); err != nil {
+		t.Error(err)
+	}
+
+	// A versioned field costs as much as its most expensive version.
+	if err := execute(`{ search(limit: 7) { name } }`, graphql.WithMaxCost(8)); err != nil {
+		t.Error(err)
+	}
+	if err := execute(`{ search(limit: 8) { name } }`, graphql.WithMaxCost(8)); err == nil || err.Error() != "query too expensive: cost 9 exceeds the limit of 8" {
+		t.Errorf("expected a cost error, but received %v", err)
+	}
+
+	// The selections of a paginated field are multiplied by its page size.
+	if err := execute(`{ pages(first: 10) { edges { node { name } } } }`, graphql.WithMaxCost(30)); err == nil || err.Error() != "query too expensive: cost 31 exceeds the limit of 30" {
+		t.Errorf("expected a cost error, but received %v", err)
+	}
+
+	// Introspection is free.
+	if err := execute(`{ __schema { types { name fields { name type { ofType { name } } } } } }`, graphql.WithMaxCost(1), graphql.WithMaxDepth(1)); err != nil {
+		t.Error(err)
+	}
+}
+
+// recordingTracer records the queries and fields it traces, with their
+// errors.
+type recordingTracer struct {
+	mu     sync.Mutex
+	events []string
+}
+
+type tracedFieldKey struct{}
+
+func (t *recordingTracer) record(event string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.events = append(t.events, event)
+}
+
+func (t *recordingTracer) StartQuery(ctx context.Context, query *graphql.Query) (context.Context, func(err error)) {
+	return ctx, func(err error) {
+		t.record(fmt.Sprintf("query %s: %v", query.Name, err))
+	}
+}
+
+func (t *recordingTracer) StartField(ctx context.Context, field graphql.TracedField) (context.Context, func(err error)) {
+	return context.WithValue(ctx, tracedFieldKey{}, field), func(err error) {
+		t.record(fmt.Sprintf("field %s.%s as %s (expensive %v): %v", field.Type, field.Name, field.Alias, field.Expensive, err))
+	}
+}
+
+func TestTracer(t *testing.T) {
+	type User struct {
+		Name string
+	}
+
+	schema := schemabuilder.NewSchema()
+	query := schema.Query()
+	query.FieldFunc("user", func(ctx context.Context) *User {
+		field, _ := ctx.Value(tracedFieldKey{}).(graphql.TracedField)
+		return &User{Name: field.Alias}
+	})
+	query.FieldFunc("fail", func() (string, error) {
+		return "", errors.New("boom")
+	})
+	builtSchema := schema.MustBuild()
+
+	execute := func(query string) (interface{}, []string, error) {
+		q := graphql.MustParse(query, nil)
+		if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+			t.Fatal(err)
+		}
+		tracer := &recordingTracer{}
+		result, err := graphql.NewExecutor(graphql.WithTracer(tracer)).Execute(context.Background(), builtSchema.Query, nil, q)
+		sort.Strings(tracer.events)
+		return result, tracer.events, err
+	}
+
+	result, events, err := execute(`query q { me: user { name } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, internal.ParseJSON(`{"me": {"name": "me"}}`), internal.AsJSON(result))
+	assert.Equal(t, []string{
+		"field Query.user as me (expensive true): <nil>",
+		"field User.name as name (expensive false): <nil>",
+		"query q: <nil>",
+	}, events)
+
+	_, events, err = execute(`{ fail }`)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	assert.Equal(t, []string{
+		"field Query.fail as fail (expensive false): boom",
+		"query : fail: boom",
+	}, events)
+}
@@ -0,0 +1,57 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// WithVerboseErrors makes Execute add a "debug" extension describing the error
+// of a failed query, as with AddExtension, for debugging in development. The
+// extension holds the path of the failed field and the chain of errors found by
+// unwrapping the error with its Unwrap method, with the message and Go type of
+// each. The stack of a recovered panic is part of its message when
+// WithPanicStacks is enabled. Errors expose implementation details to
+// clients, so verbose errors should be disabled in production.
+func WithVerboseErrors(enabled bool) ExecutorOption {
+	return func(e *Executor) {
+		e.verboseErrors = enabled
+	}
+}
+
+// errorDebug is the "debug" extension of a failed query.
+type errorDebug struct {
+	Path  string            `json:"path,omitempty"`
+	Chain []errorDebugEntry `json:"chain"`
+}
+
+type errorDebugEntry struct {
+	Message string `json:"message"`
+	Type    string `json:"type"`
+}
+
+// addErrorDebug adds the "debug" extension describing err to the response to
+// the query executing in ctx.
+func addErrorDebug(ctx context.Context, err error) {
+	debug := errorDebug{}
+	if pe, ok := err.(*pathError); ok {
+		path := make([]string, len(pe.path))
+		for i, key := range pe.path {
+			path[len(pe.path)-1-i] = key
+		}
+		debug.Path = strings.Join(path, ".")
+		err = pe.inner
+	}
+
+	for err != nil {
+		debug.Chain = append(debug.Chain, errorDebugEntry{Message: err.Error(), Type: fmt.Sprintf("%T", err)})
+		wrapper, ok := err.(interface {
+			Unwrap() error
+		})
+		if !ok {
+			break
+		}
+		err = wrapper.Unwrap()
+	}
+	AddExtension(ctx, "debug", debug)
+}
@@ -5,10 +5,14 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"reflect"
 	"runtime"
+	"strings"
 	"sync"
+	"time"
 
+	"github.com/graphql-go/graphql/language/ast"
 	"github.com/samsarahq/thunder/concurrencylimiter"
 	"github.com/samsarahq/thunder/reactive"
 )
@@ -37,6 +41,14 @@ func nestPathError(key string, err error) error {
 	}
 }
 
+// nestPath nests err under each key of path, outermost first.
+func nestPath(path []string, err error) error {
+	for i := len(path) - 1; i >= 0; i-- {
+		err = nestPathError(path[i], err)
+	}
+	return err
+}
+
 func extractPathError(err error) error {
 	if pe, ok := err.(*pathError); ok {
 		return pe.inner
@@ -77,70 +89,130 @@ func unwrap(v interface{}) interface{} {
 
 // PrepareQuery checks that the given selectionSet matches the schema typ, and
 // parses the args in selectionSet
+//
+// PrepareQuery reports all the errors it finds, rather than only the first, as
+// QueryErrors located at the selections of a query returned by Parse.
 func PrepareQuery(typ Type, selectionSet *SelectionSet) error {
+	state := newParseState(DefaultMaxInputDepth)
+	prepareQuery(typ, selectionSet, nil, state, make(map[preparedSelectionSet]bool))
+	if len(state.errors) > 0 {
+		return state.errors
+	}
+	return nil
+}
+
+// A preparedSelectionSet is a selection set that prepareQuery checked against
+// a type, so that fragments spread many times are checked once.
+type preparedSelectionSet struct {
+	typ          Type
+	selectionSet *SelectionSet
+}
+
+// prepareQuery checks selectionSet against typ, as PrepareQuery does, and
+// records errors in state. Errors about the selection set as a whole are
+// located at loc, the location of the selection it belongs to.
+func prepareQuery(typ Type, selectionSet *SelectionSet, loc *ast.Location, state *parseState, prepared map[preparedSelectionSet]bool) {
+	if selectionSet != nil {
+		key := preparedSelectionSet{typ: typ, selectionSet: selectionSet}
+		if prepared[key] {
+			return
+		}
+		prepared[key] = true
+	}
+
 	switch typ := typ.(type) {
 	case *Scalar:
 		if selectionSet != nil {
-			return NewClientError("scalar field must have no selections")
+			state.addError(NewClientError("scalar field must have no selections"), loc)
 		}
-		return nil
 	case *Enum:
 		if selectionSet != nil {
-			return NewClientError("enum field must have no selections")
+			state.addError(NewClientError("enum field must have no selections"), loc)
 		}
-		return nil
 	case *Object:
 		if selectionSet == nil {
-			return NewClientError("object field must have selections")
+			state.addError(NewClientError("object field must have selections"), loc)
+			return
+		}
+		prepareSelections(typ.Fields, typ.DefaultResolve, selectionSet, state, prepared)
+		for _, fragment := range selectionSet.Fragments {
+			prepareQuery(typ, fragment.SelectionSet, loc, state, prepared)
 		}
-		for _, selection := range selectionSet.Selections {
-			if selection.Name == "__typename" {
-				if !isNilArgs(selection.Args) {
-					return NewClientError(`error parsing args for "__typename": no args expected`)
-				}
-				if selection.SelectionSet != nil {
-					return NewClientError(`scalar field "__typename" must have no selection`)
-				}
-				continue
-			}
-
-			field, ok := typ.Fields[selection.Name]
-			if !ok {
-				return NewClientError(`unknown field "%s"`, selection.Name)
-			}
-
-			// Only parse args once for a given selection.
-			if !selection.parsed {
-				parsed, err := field.ParseArguments(selection.Args)
-				if err != nil {
-					return NewClientError(`error parsing args for "%s": %s`, selection.Name, err)
-				}
-				selection.Args = parsed
-				selection.parsed = true
-			}
 
-			if err := PrepareQuery(field.Type, selection.SelectionSet); err != nil {
-				return err
-			}
+	case *Interface:
+		if selectionSet == nil {
+			state.addError(NewClientError("interface field must have selections"), loc)
+			return
 		}
+		prepareSelections(typ.Fields, nil, selectionSet, state, prepared)
 		for _, fragment := range selectionSet.Fragments {
-			if err := PrepareQuery(typ, fragment.SelectionSet); err != nil {
-				return err
+			if fragment.On == "" || fragment.On == typ.Name {
+				prepareQuery(typ, fragment.SelectionSet, loc, state, prepared)
+				continue
 			}
+			object, ok := typ.Types[fragment.On]
+			if !ok {
+				state.addError(NewClientError(`fragment on "%s" cannot apply to interface "%s"`, fragment.On, typ.Name), loc)
+				continue
+			}
+			prepareQuery(object, fragment.SelectionSet, loc, state, prepared)
 		}
-		return nil
 
 	case *List:
-		return PrepareQuery(typ.Type, selectionSet)
+		prepareQuery(typ.Type, selectionSet, loc, state, prepared)
 
 	case *NonNull:
-		return PrepareQuery(typ.Type, selectionSet)
+		prepareQuery(typ.Type, selectionSet, loc, state, prepared)
 
 	default:
 		panic("unknown type kind")
 	}
 }
 
+// prepareSelections checks that the selections of selectionSet, but not of its
+// fragments, are in fields, and parses their args. Unknown selections are
+// resolved with defaultResolve, if set. Errors are recorded in state, located
+// at the selections causing them.
+func prepareSelections(fields map[string]*Field, defaultResolve DefaultResolver, selectionSet *SelectionSet, state *parseState, prepared map[preparedSelectionSet]bool) {
+	for _, selection := range selectionSet.Selections {
+		if selection.Name == "__typename" {
+			if !isNilArgs(selection.Args) {
+				state.addError(NewClientError(`error parsing args for "__typename": no args expected`), selection.loc)
+			}
+			if selection.SelectionSet != nil {
+				state.addError(NewClientError(`scalar field "__typename" must have no selection`), selection.loc)
+			}
+			continue
+		}
+
+		field, ok := fields[selection.Name]
+		if !ok && defaultResolve != nil {
+			if selection.SelectionSet != nil {
+				state.addError(NewClientError(`field "%s" is not in the schema and must have no selections`, selection.Name), selection.loc)
+			}
+			continue
+		}
+		if !ok {
+			state.addError(NewClientError(`unknown field "%s"`, selection.Name), selection.loc)
+			continue
+		}
+
+		// Only parse args once for a given selection.
+		if !selection.parsed {
+			parsed, err := field.ParseArguments(selection.Args)
+			if err != nil {
+				state.addError(NewClientError(`error parsing args for "%s": %s`, selection.Name, err), selection.loc)
+			} else {
+				selection.Args = parsed
+				selection.parsed = true
+				selection.parseArguments = field.ParseArguments
+			}
+		}
+
+		prepareQuery(field.Type, selection.SelectionSet, selection.loc, state, prepared)
+	}
+}
+
 type panicError struct {
 	message string
 }
@@ -149,16 +221,44 @@ func (p panicError) Error() string {
 	return p.message
 }
 
-func safeResolve(ctx context.Context, field *Field, source, args interface{}, selectionSet *SelectionSet) (result interface{}, err error) {
+func (e *Executor) safeResolve(ctx context.Context, typ *Object, field *Field, source interface{}, selection *Selection) (result interface{}, err error) {
+	if field.Resolve == nil {
+		return nil, ErrNotImplemented
+	}
+	if e.tracer != nil && selection.Name != "" {
+		var finish func(err error)
+		ctx, finish = e.tracer.StartField(ctx, TracedField{Type: typ.Name, Name: selection.Name, Alias: selection.Alias, Expensive: field.Expensive})
+		defer func() {
+			finish(err)
+		}()
+	}
+	return e.safeCall(ctx, func() (interface{}, error) {
+		return field.Resolve(ctx, source, selection.Args, selection.SelectionSet)
+	})
+}
+
+// safeCall calls f, converting a panic into an error with handlePanic.
+func (e *Executor) safeCall(ctx context.Context, f func() (interface{}, error)) (result interface{}, err error) {
 	defer func() {
-		if panicErr := recover(); panicErr != nil {
-			const size = 64 << 10
-			buf := make([]byte, size)
-			buf = buf[:runtime.Stack(buf, false)]
-			result, err = nil, fmt.Errorf("graphql: panic: %v\n%s", panicErr, buf)
+		if recovered := recover(); recovered != nil {
+			result, err = nil, e.handlePanic(ctx, recovered)
 		}
 	}()
-	return field.Resolve(ctx, source, args, selectionSet)
+	return f()
+}
+
+// handlePanic returns the error for a panic recovered by safeCall.
+func (e *Executor) handlePanic(ctx context.Context, recovered interface{}) error {
+	if e.panicHandler != nil {
+		return e.panicHandler(ctx, recovered)
+	}
+	if !e.panicStacks {
+		return fmt.Errorf("graphql: panic: %v", recovered)
+	}
+	const size = 64 << 10
+	buf := make([]byte, size)
+	buf = buf[:runtime.Stack(buf, false)]
+	return fmt.Errorf("graphql: panic: %v\n%s", recovered, buf)
 }
 
 type resolveAndExecuteCacheKey struct {
@@ -167,12 +267,47 @@ type resolveAndExecuteCacheKey struct {
 	selection *Selection
 }
 
-func (e *Executor) resolveAndExecute(ctx context.Context, field *Field, source interface{}, selection *Selection) (interface{}, error) {
+// listLimiterKey is the context key for the listLimiter of a field with
+// ListConcurrency, which applies to the fields of its elements.
+type listLimiterKey struct{}
+
+// A listLimiter bounds concurrency with its capacity, like a concurrency
+// limiter.
+type listLimiter chan struct{}
+
+// acquireListSlot waits for a slot in ctx's list limiter, if any, and returns
+// a context for the field's own selections, which are not limited.
+func acquireListSlot(ctx context.Context) (context.Context, func()) {
+	l, ok := ctx.Value(listLimiterKey{}).(listLimiter)
+	if !ok || l == nil {
+		return ctx, func() {}
+	}
+	select {
+	case l <- struct{}{}:
+	case <-ctx.Done():
+		return ctx, func() {}
+	}
+	var once sync.Once
+	return context.WithValue(ctx, listLimiterKey{}, listLimiter(nil)), func() {
+		once.Do(func() { <-l })
+	}
+}
+
+func (e *Executor) resolveAndExecute(ctx context.Context, typ *Object, field *Field, source interface{}, selection *Selection) (interface{}, error) {
 	if field.Expensive {
 		// TODO: Skip goroutine for cached value
 		ctx, release := concurrencylimiter.Acquire(ctx)
-		return fork(func() (interface{}, error) {
+		return fork(func() (result interface{}, err error) {
+			// The resolver is called with safeCall, but recover here too so
+			// that no panic escapes the goroutine.
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					result, err = nil, e.handlePanic(ctx, recovered)
+				}
+			}()
 			defer release()
+			ctx, releaseListSlot := acquireListSlot(ctx)
+			defer releaseListSlot()
 
 			value := reflect.ValueOf(source)
 			// cache the body of resolve and excecute so that if the source doesn't change, we
@@ -188,7 +323,10 @@ func (e *Executor) resolveAndExecute(ctx context.Context, field *Field, source i
 
 			// TODO: Consider cacheing resolve and execute independently
 			resolvedValue, err := reactive.Cache(ctx, key, func(ctx context.Context) (interface{}, error) {
-				value, err := safeResolve(ctx, field, source, selection.Args, selection.SelectionSet)
+				value, err := e.safeResolve(ctx, typ, field, source, selection)
+				if err == ErrNotImplemented && e.mocks != nil {
+					return e.mocks.mockField(field.Type, selection), nil
+				}
 				if err != nil {
 					return nil, err
 				}
@@ -196,26 +334,106 @@ func (e *Executor) resolveAndExecute(ctx context.Context, field *Field, source i
 				// Release concurrency token before recursing into execute. It will attempt to
 				// grab another concurrency token.
 				release()
+				releaseListSlot()
+				if field.ListConcurrency > 0 {
+					ctx = context.WithValue(ctx, listLimiterKey{}, make(listLimiter, field.ListConcurrency))
+				}
 
-				e.mu.Lock()
-				value, err = e.execute(ctx, field.Type, value, selection.SelectionSet)
-				e.mu.Unlock()
+				value, err = func() (interface{}, error) {
+					e.mu.Lock()
+					defer e.mu.Unlock()
+					value, err := e.executeResolved(ctx, field.Type, value, selection.SelectionSet)
+					if err == nil {
+						value, err = e.resolveLazy(value)
+					}
+					return value, err
+				}()
 
 				if err != nil {
 					return nil, err
 				}
-				return await(value)
+				if e.streamingWriter != nil {
+					return awaitPartial(value), nil
+				}
+				value, err = await(value)
+				if err == nil && e.timedOut(ctx) {
+					// Fields that failed once the request timed out are left
+					// in value, which is not cached for other requests.
+					return nil, ctx.Err()
+				}
+				return value, err
 			})
 
 			return resolvedValue, err
 		}), nil
 	}
 
-	value, err := safeResolve(ctx, field, source, selection.Args, selection.SelectionSet)
+	var value interface{}
+	var err error
+	if field.Pure && reactive.HasRerunner(ctx) {
+		value, err = e.resolvePure(ctx, typ, field, source, selection)
+	} else {
+		value, err = e.safeResolve(ctx, typ, field, source, selection)
+	}
+	if err == ErrNotImplemented && e.mocks != nil {
+		return e.mocks.mockField(field.Type, selection), nil
+	}
 	if err != nil {
 		return nil, err
 	}
-	return e.execute(ctx, field.Type, value, selection.SelectionSet)
+	if field.ListConcurrency > 0 {
+		ctx = context.WithValue(ctx, listLimiterKey{}, make(listLimiter, field.ListConcurrency))
+	}
+	return e.executeResolved(ctx, field.Type, value, selection.SelectionSet)
+}
+
+// pureResolveCacheKey is the key of the value of a Pure field resolved by
+// resolvePure.
+type pureResolveCacheKey struct {
+	field     *Field
+	source    interface{}
+	selection *Selection
+}
+
+// resolvePure resolves a Pure field that is not expensive, caching its value
+// across the reruns of a live query until the dependencies its resolver added
+// are invalidated, as is done for expensive fields. Fields that are not Pure
+// are resolved again on every rerun, since their resolvers may have side
+// effects.
+func (e *Executor) resolvePure(ctx context.Context, typ *Object, field *Field, source interface{}, selection *Selection) (interface{}, error) {
+	key := pureResolveCacheKey{field: field, source: source, selection: selection}
+	if value := reflect.ValueOf(source); value.IsValid() && !value.Type().Comparable() {
+		key.source = new(byte)
+	}
+	return reactive.Cache(ctx, key, func(ctx context.Context) (interface{}, error) {
+		return e.safeResolve(ctx, typ, field, source, selection)
+	})
+}
+
+// executeResolved executes a value returned by a resolver, deferring it if it
+// is Lazy. A nil value of a nullable type is null.
+func (e *Executor) executeResolved(ctx context.Context, typ Type, value interface{}, selectionSet *SelectionSet) (interface{}, error) {
+	if isNull(typ, value) {
+		return nil, nil
+	}
+	if lazy, ok := value.(Lazy); ok {
+		return &lazyField{ctx: ctx, typ: typ, lazy: lazy, selectionSet: selectionSet}, nil
+	}
+	return e.execute(ctx, typ, value, selectionSet)
+}
+
+// timedOut returns true if the request timeout set with WithRequestTimeout
+// has passed in ctx, after which fields that fail are left in the result as
+// fieldErrors instead of failing the query, for awaitWithTimeout.
+func (e *Executor) timedOut(ctx context.Context) bool {
+	return e.requestTimeout > 0 && ctx.Err() == context.DeadlineExceeded
+}
+
+// isNull returns true if value, returned by a resolver of a field of type typ,
+// is an untyped nil, and typ is nullable.
+func isNull(typ Type, value interface{}) bool {
+	_, nonNull := typ.(*NonNull)
+	return value == nil && !nonNull
 }
 
 // executeObject executes an object query
@@ -225,19 +443,106 @@ func (e *Executor) executeObject(ctx context.Context, typ *Object, source interf
 		return nil, nil
 	}
 
+	if typ.OnResolveStart == nil && typ.OnResolveEnd == nil {
+		return e.executeObjectFields(ctx, typ, source, selectionSet)
+	}
+
+	if typ.OnResolveStart != nil {
+		start := ctx
+		if _, err := e.safeCall(ctx, func() (interface{}, error) {
+			var err error
+			start, err = typ.OnResolveStart(ctx, source)
+			return nil, err
+		}); err != nil {
+			return nil, err
+		}
+		ctx = start
+	}
+	result, err := e.executeObjectFields(ctx, typ, source, selectionSet)
+	if typ.OnResolveEnd != nil {
+		e.resolveEnd(ctx, typ, source, result, err)
+	}
+	return result, err
+}
+
+// resolveEndHooksKey is the context key of the *sync.WaitGroup tracking the
+// OnResolveEnd hooks that wait for expensive fields, which executeQuery waits
+// for before returning.
+type resolveEndHooksKey struct{}
+
+// resolveEnd calls the OnResolveEnd hook of typ with the result of resolving
+// source. If the result holds expensive fields, which are resolved in the
+// background, the hook is called once they complete, with their values.
+func (e *Executor) resolveEnd(ctx context.Context, typ *Object, source interface{}, result interface{}, err error) {
+	end := func(result interface{}, err error) {
+		e.safeCall(ctx, func() (interface{}, error) {
+			typ.OnResolveEnd(ctx, source, result, err)
+			return nil, nil
+		})
+	}
+	if object, ok := result.(*streamedObject); ok {
+		// The fields of a streamed object are resolved as they are written,
+		// and are not kept for the hook.
+		object.end = func(err error) {
+			end(nil, err)
+		}
+		return
+	}
+	if err != nil || !hasThunks(result) {
+		end(result, err)
+		return
+	}
+
+	// The result is awaited in place by the caller, so the hook awaits a
+	// copy of its own.
+	pending := copyResult(result)
+	hooks, _ := ctx.Value(resolveEndHooksKey{}).(*sync.WaitGroup)
+	if hooks != nil {
+		hooks.Add(1)
+	}
+	go func() {
+		if hooks != nil {
+			defer hooks.Done()
+		}
+		end(await(pending))
+	}()
+}
+
+// executeObjectFields executes the selections of a non-nil object value.
+func (e *Executor) executeObjectFields(ctx context.Context, typ *Object, source interface{}, selectionSet *SelectionSet) (interface{}, error) {
+	if resolver, ok := source.(CustomResolver); ok {
+		result, err := e.safeCall(ctx, func() (interface{}, error) {
+			return resolver.GraphQLResolve(ctx, selectionSet)
+		})
+		if err == nil && e.streamingWriter != nil {
+			if fields, ok := result.(map[string]interface{}); ok {
+				return streamCustomFields(Flatten(selectionSet), fields), nil
+			}
+		}
+		return result, err
+	}
+
 	selections := Flatten(selectionSet)
+	if e.streamingWriter != nil {
+		return e.streamObjectFields(ctx, typ, source, selections), nil
+	}
 
 	fields := make(map[string]interface{})
 
 	// for every selection, resolve the value and store it in the output object
+	budget := responseBudgetFrom(ctx)
 	for _, selection := range selections {
-		if selection.Name == "__typename" {
-			fields[selection.Alias] = typ.Name
+		if budget != nil {
+			// The quoted key and its colon.
+			if err := budget.charge(len(selection.Alias) + 3); err != nil {
+				return nil, err
+			}
+		}
+		resolved, err := e.executeSelection(ctx, typ, source, selection)
+		if err != nil && e.timedOut(ctx) {
+			fields[selection.Alias] = &fieldError{err: err}
 			continue
 		}
-
-		field := typ.Fields[selection.Name]
-		resolved, err := e.resolveAndExecute(ctx, field, source, selection)
 		if err != nil {
 			return nil, nestPathError(selection.Alias, err)
 		}
@@ -245,7 +550,7 @@ func (e *Executor) executeObject(ctx context.Context, typ *Object, source interf
 	}
 
 	if typ.Key != nil {
-		value, err := e.resolveAndExecute(ctx, &Field{Type: &Scalar{Type: "string"}, Resolve: typ.Key}, source, &Selection{})
+		value, err := e.executeKey(ctx, typ, source)
 		if err != nil {
 			return nil, nestPathError("__key", err)
 		}
@@ -255,6 +560,91 @@ func (e *Executor) executeObject(ctx context.Context, typ *Object, source interf
 	return fields, nil
 }
 
+// executeSelection resolves and executes selection on source, a value of typ.
+func (e *Executor) executeSelection(ctx context.Context, typ *Object, source interface{}, selection *Selection) (interface{}, error) {
+	if selection.Name == "__typename" {
+		return typ.Name, nil
+	}
+	if e.introspectionResolver != nil && (selection.Name == "__schema" || selection.Name == "__type") {
+		return e.safeCall(ctx, func() (interface{}, error) {
+			return e.introspectionResolver(ctx, selection)
+		})
+	}
+
+	field, ok := typ.Fields[selection.Name]
+	if !ok {
+		// PrepareQuery only allows fields outside the schema on objects
+		// with a DefaultResolve.
+		field = defaultField(typ.DefaultResolve, selection.Name)
+	}
+	if e.fieldUsage != nil {
+		e.fieldUsage.record(field)
+	}
+	if field.Feature != "" && !e.featureEnabled(ctx, field.Feature) {
+		return nil, featureDisabledError(field)
+	}
+	return e.resolveAndExecute(ctx, typ, field, source, selection)
+}
+
+// executeKey resolves the __key of source, a value of typ.
+func (e *Executor) executeKey(ctx context.Context, typ *Object, source interface{}) (interface{}, error) {
+	return e.resolveAndExecute(ctx, typ, &Field{Type: &Scalar{Type: "string"}, Resolve: typ.Key}, source, &Selection{})
+}
+
+// A CustomResolver is a value that resolves its own selections, for objects
+// too dynamic for the static field model. When an object's value implements
+// CustomResolver, the executor calls GraphQLResolve instead of the object's
+// fields and uses its result as the object's output. The selections have been
+// validated against the object's type, and the result should be a
+// map[string]interface{} keyed by the aliases of Flatten(selectionSet),
+// holding values that encode to JSON. It is returned as is, without a __key.
+type CustomResolver interface {
+	GraphQLResolve(ctx context.Context, selectionSet *SelectionSet) (interface{}, error)
+}
+
+// defaultField returns a scalar field that resolves name with resolve. The
+// field's args are the selection's unparsed arguments.
+func defaultField(resolve DefaultResolver, name string) *Field {
+	return &Field{
+		Resolve: func(ctx context.Context, source, args interface{}, selectionSet *SelectionSet) (interface{}, error) {
+			asMap, _ := args.(map[string]interface{})
+			return resolve(ctx, source, name, asMap)
+		},
+		Type: &Scalar{Type: name},
+	}
+}
+
+// executeInterface executes a value of an interface as the object it resolves
+// to, with the fragments on other objects left out.
+func (e *Executor) executeInterface(ctx context.Context, typ *Interface, source interface{}, selectionSet *SelectionSet) (interface{}, error) {
+	object, value, err := typ.ResolveType(source)
+	if err != nil {
+		return nil, err
+	}
+	if object == nil {
+		return nil, nil
+	}
+	return e.executeObject(ctx, object, value, selectionSetFor(typ, object, selectionSet))
+}
+
+// selectionSetFor returns the selections of selectionSet, made on interface
+// typ, that apply to object, leaving out fragments on other objects.
+func selectionSetFor(typ *Interface, object *Object, selectionSet *SelectionSet) *SelectionSet {
+	filtered := &SelectionSet{Selections: selectionSet.Selections}
+	for _, fragment := range selectionSet.Fragments {
+		switch fragment.On {
+		case "", typ.Name:
+			filtered.Fragments = append(filtered.Fragments, &Fragment{
+				On:           fragment.On,
+				SelectionSet: selectionSetFor(typ, object, fragment.SelectionSet),
+			})
+		case object.Name:
+			filtered.Fragments = append(filtered.Fragments, fragment)
+		}
+	}
+	return filtered
+}
+
 var emptyList = []interface{}{}
 
 // executeList executes a set query
@@ -272,6 +662,10 @@ func (e *Executor) executeList(ctx context.Context, typ *List, source interface{
 		value := slice.Index(i)
 		resolved, err := e.execute(ctx, typ.Type, value.Interface(), selectionSet)
 		if err != nil {
+			if e.streamingWriter != nil || e.timedOut(ctx) {
+				items[i] = &fieldError{err: err}
+				continue
+			}
 			return nil, nestPathError(fmt.Sprint(i), err)
 		}
 		items[i] = resolved
@@ -287,15 +681,27 @@ func (e *Executor) execute(ctx context.Context, typ Type, source interface{}, se
 	}
 	switch typ := typ.(type) {
 	case *Scalar:
-		return unwrap(source), nil
+		value, err := executeScalar(typ, source)
+		if budget := responseBudgetFrom(ctx); budget != nil && err == nil {
+			err = budget.charge(scalarSize(value))
+		}
+		return value, err
 	case *Enum:
 		val := unwrap(source)
-		if mapVal, ok := typ.ReverseMap[val]; ok {
-			return mapVal, nil
+		mapVal, ok := typ.ReverseMap[val]
+		if !ok {
+			return nil, errors.New("enum is not valid")
+		}
+		if budget := responseBudgetFrom(ctx); budget != nil {
+			if err := budget.charge(scalarSize(mapVal)); err != nil {
+				return nil, err
+			}
 		}
-		return nil, errors.New("enum is not valid")
+		return mapVal, nil
 	case *Object:
 		return e.executeObject(ctx, typ, source, selectionSet)
+	case *Interface:
+		return e.executeInterface(ctx, typ, source, selectionSet)
 	case *List:
 		return e.executeList(ctx, typ, source, selectionSet)
 	case *NonNull:
@@ -305,25 +711,446 @@ func (e *Executor) execute(ctx context.Context, typ Type, source interface{}, se
 	}
 }
 
+// executeScalar returns the output representation of source, a value of
+// the scalar typ.
+func executeScalar(typ *Scalar, source interface{}) (interface{}, error) {
+	if marshaler, ok := source.(Marshaler); ok {
+		if v := reflect.ValueOf(source); v.Kind() == reflect.Ptr && v.IsNil() {
+			return nil, nil
+		}
+		return marshaler.MarshalGraphQL()
+	}
+	value := unwrap(source)
+	if marshaler, ok := value.(Marshaler); ok {
+		return marshaler.MarshalGraphQL()
+	}
+	if typ.Serialize != nil && value != nil {
+		return typ.Serialize(value)
+	}
+	return value, nil
+}
+
+// A Marshaler is a value that returns its own output representation, such as
+// a money amount returned as a formatted string. When a scalar field's value
+// implements Marshaler, the executor returns the result of MarshalGraphQL
+// instead of the value. Nil values are returned as null without calling it.
+type Marshaler interface {
+	MarshalGraphQL() (interface{}, error)
+}
+
+// A DeprecationLogger is notified when a query selects fields of an object
+// whose type has been marked as deprecated.
+type DeprecationLogger func(ctx context.Context, typeName string, reason string)
+
 type Executor struct {
 	mu sync.Mutex
+
+	deprecationLogger DeprecationLogger
+	// deprecatedSeen tracks the deprecated types already logged during the
+	// current execution.
+	deprecatedSeen map[*Object]bool
+
+	streamingWriter io.Writer
+	requestTimeout  time.Duration
+	fieldUsage      *FieldUsage
+	mocks           *MockConfig
+
+	introspectionOnly     bool
+	introspectionResolver IntrospectionResolver
+	maxResponseBytes      int
+	txManager             TxManager
+	verboseErrors         bool
+	featureChecker        FeatureChecker
+	maxDepth              int
+	maxCost               int
+	maxInputDepth         *int
+	tracer                Tracer
+
+	panicHandler PanicHandler
+	panicStacks  bool
+}
+
+// An ExecutorOption configures an Executor.
+type ExecutorOption func(*Executor)
+
+// NewExecutor creates an Executor configured with opts. The zero value
+// Executor{} is equivalent to NewExecutor() without any options.
+func NewExecutor(opts ...ExecutorOption) *Executor {
+	e := &Executor{}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// A PanicHandler returns the error reported for a field whose resolver
+// panicked with recovered. It is called from the recovering goroutine, so
+// runtime/debug.Stack returns the stack of the panic.
+type PanicHandler func(ctx context.Context, recovered interface{}) error
+
+// WithPanicHandler makes the executor report panics recovered from resolvers
+// with handler, for example to log them or send them to an error tracker. By
+// default, a panic is reported as an error with the panic's message.
+func WithPanicHandler(handler PanicHandler) ExecutorOption {
+	return func(e *Executor) {
+		e.panicHandler = handler
+	}
+}
+
+// WithPanicStacks includes the stack of a recovered panic in the error reported
+// by the default panic handler. Stacks expose implementation details to
+// clients, so they should only be enabled while debugging.
+func WithPanicStacks(enabled bool) ExecutorOption {
+	return func(e *Executor) {
+		e.panicStacks = enabled
+	}
+}
+
+// WithDeprecationLogger registers a logger that is called once per execution
+// for every deprecated object type the query selects fields of, before any
+// field is resolved.
+func WithDeprecationLogger(logger DeprecationLogger) ExecutorOption {
+	return func(e *Executor) {
+		e.deprecationLogger = logger
+	}
+}
+
+// WithStreamingWriter makes the executor write the JSON response for a query to
+// w as the result is serialized, instead of returning the result from Execute.
+//
+// The response has the form {"data": ..., "errors": [...]}. Fields are written
+// in the order they were selected, each as soon as it resolves, and values that
+// are still being computed concurrently are awaited only when the writer
+// reaches them. Lazy fields are resolved when they are reached, rather than in
+// batches, and OnResolveEnd hooks are called without the fields' values.
+// Because data is written before all errors are known, a field that fails to
+// resolve is written as null and its error, prefixed with the field's path, is
+// reported in the trailing errors list.
+func WithStreamingWriter(w io.Writer) ExecutorOption {
+	return func(e *Executor) {
+		e.streamingWriter = w
+	}
+}
+
+// WithRequestTimeout bounds every execution to timeout. The deadline is set on
+// the context passed to resolvers, so that they can check how much time
+// remains with ctx.Deadline or RemainingTime. Once it passes, in-flight
+// resolvers observe the context's cancellation and fields that have not been
+// resolved fail with context.DeadlineExceeded. Execute then returns the fields
+// resolved in time, with the failed fields as null, along with the error of
+// the first failed field; with WithStreamingWriter, they are written with all
+// the errors.
+func WithRequestTimeout(timeout time.Duration) ExecutorOption {
+	return func(e *Executor) {
+		e.requestTimeout = timeout
+	}
+}
+
+// WithIntrospectionOnly makes the executor reject queries that select fields
+// other than the introspection fields __schema, __type, and __typename at their
+// root, for endpoints that publish the schema without serving its data.
+func WithIntrospectionOnly(introspectionOnly bool) ExecutorOption {
+	return func(e *Executor) {
+		e.introspectionOnly = introspectionOnly
+	}
+}
+
+// An IntrospectionResolver answers a selection of the __schema or __type
+// meta-field in place of the built-in introspection. The selection has been
+// validated against the schema, so its Args are those of the built-in field,
+// such as struct{ Name string } for __type. The result is returned as is, and
+// should be shaped like the selections of the selection set, keyed by their
+// aliases.
+type IntrospectionResolver func(ctx context.Context, selection *Selection) (interface{}, error)
+
+// WithIntrospectionResolver makes the executor answer the __schema and __type
+// meta-fields with resolver instead of the built-in introspection, for
+// example to serve a filtered schema or proxy the introspection of a remote
+// one. The meta-fields must still be part of the schema, as added by
+// introspection.AddIntrospectionToSchema, for queries to select them.
+func WithIntrospectionResolver(resolver IntrospectionResolver) ExecutorOption {
+	return func(e *Executor) {
+		e.introspectionResolver = resolver
+	}
+}
+
+// A FeatureChecker returns true if feature is enabled for the caller in ctx.
+type FeatureChecker func(ctx context.Context, feature string) bool
+
+// WithFeatureChecker makes the executor check fields that require a feature,
+// as set with Field.Feature, with checker. Fields whose feature is disabled
+// for the caller are not resolved: they are null if nullable, and otherwise
+// fail with a "feature disabled" error. Without a checker, every feature is
+// disabled.
+func WithFeatureChecker(checker FeatureChecker) ExecutorOption {
+	return func(e *Executor) {
+		e.featureChecker = checker
+	}
+}
+
+// featureEnabled returns true if feature is enabled for the caller in ctx.
+func (e *Executor) featureEnabled(ctx context.Context, feature string) bool {
+	return e.featureChecker != nil && e.featureChecker(ctx, feature)
+}
+
+// featureDisabledError returns the error of field when its feature is
+// disabled, or nil if the field is nullable and so is null instead.
+func featureDisabledError(field *Field) error {
+	if _, ok := field.Type.(*NonNull); !ok {
+		return nil
+	}
+	return NewClientError("feature %s is disabled", field.Feature)
+}
+
+// WithMaxResponseBytes makes Execute fail with a "response too large" error
+// instead of returning a result that encodes to more than n bytes of JSON, as
+// a defensive limit for public endpoints. The response's keys and scalars are
+// counted as fields resolve, so that execution stops as soon as the response
+// is known to be too large, and the complete result is then counted exactly,
+// without encoding it. It does not apply with WithStreamingWriter, which
+// writes the response while it is being resolved.
+func WithMaxResponseBytes(n int) ExecutorOption {
+	return func(e *Executor) {
+		e.maxResponseBytes = n
+	}
+}
+
+// RemainingTime returns the time left before ctx's deadline, and false if ctx
+// has no deadline.
+func RemainingTime(ctx context.Context) (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	return deadline.Sub(time.Now()), true
+}
+
+// checkIntrospectionOnly returns an error if the executor only allows
+// introspection and query selects other fields.
+func (e *Executor) checkIntrospectionOnly(query *Query) error {
+	if !e.introspectionOnly {
+		return nil
+	}
+	for _, selection := range Flatten(query.SelectionSet) {
+		switch selection.Name {
+		case "__schema", "__type", "__typename":
+		default:
+			return NewClientError(`only introspection queries are allowed, but "%s" was selected`, selection.Name)
+		}
+	}
+	return nil
+}
+
+// operationKey is the context key for the selection set of the operation
+// being executed.
+type operationKey struct{}
+
+// Selected returns true if the operation being executed in ctx selects the
+// field at path, a dotted list of field names from the root of the operation
+// such as "user.orders.items". Fields are matched by name, ignoring aliases,
+// and fragments are searched as if their selections were inlined. Selections
+// skipped with @skip or @include are not selected. Resolvers can use Selected
+// to prefetch data that the rest of the query needs.
+func Selected(ctx context.Context, path string) bool {
+	selectionSet, ok := ctx.Value(operationKey{}).(*SelectionSet)
+	if !ok {
+		return false
+	}
+	return selectedIn(selectionSet, strings.Split(path, "."))
+}
+
+func selectedIn(selectionSet *SelectionSet, path []string) bool {
+	if len(path) == 0 {
+		return true
+	}
+	if selectionSet == nil {
+		return false
+	}
+	for _, selection := range selectionSet.Selections {
+		if selection.Name == path[0] && selectedIn(selection.SelectionSet, path[1:]) {
+			return true
+		}
+	}
+	for _, fragment := range selectionSet.Fragments {
+		if selectedIn(fragment.SelectionSet, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// logDeprecatedTypes logs the deprecated objects whose fields selectionSet
+// selects on typ, whether or not any value of them is resolved, such as for
+// fields returning nil or empty lists. An object selected through an interface
+// is logged if a fragment on it is spread.
+//
+// logDeprecatedTypes must be called with e.mu held.
+func (e *Executor) logDeprecatedTypes(ctx context.Context, typ Type, selectionSet *SelectionSet) {
+	if selectionSet == nil {
+		return
+	}
+	switch typ := typ.(type) {
+	case *Object:
+		if typ.DeprecationReason != "" {
+			e.logDeprecatedType(ctx, typ)
+		}
+		e.logDeprecatedFields(ctx, typ, selectionSet)
+	case *Interface:
+		for _, name := range typ.typeNames() {
+			object := typ.Types[name]
+			if object.DeprecationReason != "" && spreadsFragmentOn(selectionSet, name) {
+				e.logDeprecatedType(ctx, object)
+			}
+			e.logDeprecatedFields(ctx, object, selectionSetFor(typ, object, selectionSet))
+		}
+	case *List:
+		e.logDeprecatedTypes(ctx, typ.Type, selectionSet)
+	case *NonNull:
+		e.logDeprecatedTypes(ctx, typ.Type, selectionSet)
+	}
+}
+
+// logDeprecatedFields logs the deprecated objects returned by the fields
+// selectionSet selects on typ, as logDeprecatedTypes does.
+func (e *Executor) logDeprecatedFields(ctx context.Context, typ *Object, selectionSet *SelectionSet) {
+	for _, selection := range Flatten(selectionSet) {
+		if field, ok := typ.Fields[selection.Name]; ok {
+			e.logDeprecatedTypes(ctx, field.Type, selection.SelectionSet)
+		}
+	}
+}
+
+// spreadsFragmentOn returns true if selectionSet spreads a fragment on the
+// type named name.
+func spreadsFragmentOn(selectionSet *SelectionSet, name string) bool {
+	for _, fragment := range selectionSet.Fragments {
+		if fragment.On == name || spreadsFragmentOn(fragment.SelectionSet, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// logDeprecatedType must be called with e.mu held.
+func (e *Executor) logDeprecatedType(ctx context.Context, typ *Object) {
+	if e.deprecationLogger == nil || e.deprecatedSeen[typ] {
+		return
+	}
+	if e.deprecatedSeen == nil {
+		e.deprecatedSeen = make(map[*Object]bool)
+	}
+	e.deprecatedSeen[typ] = true
+	e.deprecationLogger(ctx, typ.Name, typ.DeprecationReason)
 }
 
 // Execute executes a query by dispatches according to typ
 func (e *Executor) Execute(ctx context.Context, typ Type, source interface{}, query *Query) (interface{}, error) {
+	if e.tracer == nil {
+		return e.executeQuery(ctx, typ, source, query)
+	}
+	ctx, finish := e.tracer.StartQuery(ctx, query)
+	value, err := e.executeQuery(ctx, typ, source, query)
+	finish(err)
+	return value, err
+}
+
+// executeQuery executes query for Execute.
+func (e *Executor) executeQuery(ctx context.Context, typ Type, source interface{}, query *Query) (interface{}, error) {
+	if e.requestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.requestTimeout)
+		defer cancel()
+	}
+
+	err := e.checkIntrospectionOnly(query)
+	if err == nil {
+		err = checkAudiences(ctx, typ, query.SelectionSet)
+	}
+	if err == nil {
+		err = e.checkQueryCost(typ, query.SelectionSet)
+	}
+	if err != nil {
+		if e.streamingWriter != nil {
+			return nil, writeStreamingResponse(e.streamingWriter, nil, &fieldError{err: err})
+		}
+		return nil, err
+	}
+
+	ctx = context.WithValue(ctx, operationKey{}, query.SelectionSet)
+
+	transaction := e.usesTransaction(query)
+	if transaction {
+		if ctx, err = e.txManager.Begin(ctx); err != nil {
+			if query.Name != "" {
+				err = nestPathError(query.Name, err)
+			}
+			return nil, err
+		}
+	}
+
+	if e.maxResponseBytes > 0 && e.streamingWriter == nil {
+		ctx = withResponseBudget(ctx, e.maxResponseBytes)
+	}
+
+	var hooks sync.WaitGroup
+	ctx = context.WithValue(ctx, resolveEndHooksKey{}, &hooks)
+
 	e.mu.Lock()
+	e.deprecatedSeen = nil
+	if e.deprecationLogger != nil {
+		e.logDeprecatedTypes(ctx, typ, query.SelectionSet)
+	}
 	value, err := e.execute(ctx, typ, source, query.SelectionSet)
+	if err == nil {
+		value, err = e.resolveLazy(value)
+	}
 	e.mu.Unlock()
 
+	if e.streamingWriter != nil {
+		if err != nil {
+			value = &fieldError{err: err}
+		}
+		var path []string
+		if query.Name != "" {
+			path = []string{query.Name}
+		}
+		err := writeStreamingResponse(e.streamingWriter, path, value)
+		if err == nil {
+			hooks.Wait()
+		}
+		return nil, err
+	}
+
 	// Await the promise if things look good so far.
-	if err == nil {
+	if err == nil && e.requestTimeout > 0 {
+		value, err = awaitWithTimeout(ctx, value)
+	} else if err == nil {
 		value, err = await(value)
 	}
+	if err == nil {
+		// The OnResolveEnd hooks waiting for expensive fields are waited for
+		// once all fields have completed. After an error, fields may still be
+		// running, and their hooks are called in the background.
+		hooks.Wait()
+	}
+	if err == nil && e.maxResponseBytes > 0 {
+		if err = checkResponseSize(value, e.maxResponseBytes); err != nil {
+			value = nil
+		}
+	}
+	if transaction {
+		if err = e.finishTransaction(ctx, err); err != nil {
+			value = nil
+		}
+	}
 
 	// Maybe error wrap if we have an error and a name to attach.
 	if err != nil && query.Name != "" {
 		err = nestPathError(query.Name, err)
 	}
+	if err != nil && e.verboseErrors {
+		addErrorDebug(ctx, err)
+	}
 
 	return value, err
 }
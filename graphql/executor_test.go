@@ -1,11 +1,16 @@
 package graphql
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"reflect"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/davecgh/go-spew/spew"
 	"github.com/samsarahq/thunder/internal"
@@ -192,6 +197,52 @@ func TestRepeatedFragment(t *testing.T) {
 	}
 }
 
+func TestMergeDuplicateSelections(t *testing.T) {
+	ctr := 0
+	query := makeQuery(nil)
+	query.Fields["counted"] = &Field{
+		Resolve: func(ctx context.Context, source, args interface{}, selectionSet *SelectionSet) (interface{}, error) {
+			ctr++
+			return 0, nil
+		},
+		Type:           query.Fields["a"].Type,
+		ParseArguments: query.Fields["a"].ParseArguments,
+	}
+
+	q := MustParse(`{
+		counted { value }
+		counted { nested { value } }
+		...frag
+	}
+	fragment frag on Query {
+		counted { value nested { valuePtr } }
+	}
+	`, nil)
+
+	if err := PrepareQuery(query, q.SelectionSet); err != nil {
+		t.Error(err)
+	}
+	e := Executor{}
+	result, err := e.Execute(context.Background(), query, nil, q)
+	if err != nil {
+		t.Error(err)
+	}
+
+	if ctr != 1 {
+		t.Errorf("Expected duplicate selections to be resolved once, but they were resolved %d times.", ctr)
+	}
+	if !reflect.DeepEqual(internal.AsJSON(result), internal.ParseJSON(`
+		{
+			"counted": {
+				"value": 0,
+				"__key": 0,
+				"nested": {"value": 1, "valuePtr": 1, "__key": 1}
+			}
+		}`)) {
+		t.Error("bad value", spew.Sdump(internal.AsJSON(result)))
+	}
+}
+
 /*
 func TestMissingField(t *testing.T) {
 	q := MustParse(`
@@ -262,6 +313,206 @@ func TestError(t *testing.T) {
 	}
 }
 
+func TestStreamingWriter(t *testing.T) {
+	query := makeQuery(nil)
+
+	q := MustParse(`
+		query foo {
+			static
+			error
+			as { value }
+		}
+	`, map[string]interface{}{})
+
+	if err := PrepareQuery(query, q.SelectionSet); err != nil {
+		t.Error(err)
+	}
+
+	var buf bytes.Buffer
+	e := NewExecutor(WithStreamingWriter(&buf))
+	if _, err := e.Execute(context.Background(), query, nil, q); err != nil {
+		t.Error(err)
+	}
+
+	// Fields are written in the order of the query.
+	expected := `{"data":{"static":"static","error":null,"as":[{"value":0,"__key":0},{"value":1,"__key":1},{"value":2,"__key":2},{"value":3,"__key":3}]},"errors":["foo.error: test error"]}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("expected %s, got %s", expected, buf.String())
+	}
+
+	q = MustParse(`{ z: static as { value } a: static ... on Query { b: static } }`, nil)
+	if err := PrepareQuery(query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if _, err := e.Execute(context.Background(), query, nil, q); err != nil {
+		t.Error(err)
+	}
+	expected = `{"data":{"z":"static","as":[{"value":0,"__key":0},{"value":1,"__key":1},{"value":2,"__key":2},{"value":3,"__key":3}],"a":"static","b":"static"},"errors":null}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("expected %s, got %s", expected, buf.String())
+	}
+}
+
+func TestMaxResponseBytes(t *testing.T) {
+	query := makeQuery(nil)
+
+	q := MustParse(`{ as { value } }`, nil)
+	if err := PrepareQuery(query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+
+	// The result encodes to 96 bytes.
+	e := NewExecutor(WithMaxResponseBytes(96))
+	if _, err := e.Execute(context.Background(), query, nil, q); err != nil {
+		t.Errorf("expected response within the limit to succeed, but received %v", err)
+	}
+
+	e = NewExecutor(WithMaxResponseBytes(95))
+	result, err := e.Execute(context.Background(), query, nil, q)
+	if err == nil || err.Error() != "response too large, exceeding the limit of 95 bytes" {
+		t.Errorf("expected response too large error, but received %v", err)
+	}
+	if result != nil {
+		t.Errorf("expected no result, but received %v", result)
+	}
+}
+
+func TestEncodedSize(t *testing.T) {
+	for _, value := range []interface{}{
+		map[string]interface{}{"a": 1, "b": 2},
+		[]interface{}{1, 2, 3},
+		map[string]interface{}{"a": []interface{}{1, map[string]interface{}{"b": "c"}}, "d": nil},
+		[]interface{}{},
+	} {
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := checkResponseSize(value, len(encoded)); err != nil {
+			t.Errorf("expected %s within a limit of %d bytes, but received %v", encoded, len(encoded), err)
+		}
+		if err := checkResponseSize(value, len(encoded)-1); err == nil {
+			t.Errorf("expected %s to exceed a limit of %d bytes", encoded, len(encoded)-1)
+		}
+	}
+}
+
+func TestMaxResponseBytesStopsEarly(t *testing.T) {
+	query := &Object{
+		Name:   "Query",
+		Fields: make(map[string]*Field),
+	}
+	item := &Object{
+		Name:   "Item",
+		Fields: make(map[string]*Field),
+	}
+	noArguments := func(json interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	var calls int
+	item.Fields["value"] = &Field{
+		Resolve: func(ctx context.Context, source, args interface{}, selectionSet *SelectionSet) (interface{}, error) {
+			calls++
+			return "0123456789", nil
+		},
+		Type:           &Scalar{Type: "string"},
+		ParseArguments: noArguments,
+	}
+	query.Fields["items"] = &Field{
+		Resolve: func(ctx context.Context, source, args interface{}, selectionSet *SelectionSet) (interface{}, error) {
+			return make([]int, 100), nil
+		},
+		Type:           &List{Type: item},
+		ParseArguments: noArguments,
+	}
+
+	q := MustParse(`{ items { value } }`, nil)
+	if err := PrepareQuery(query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	e := NewExecutor(WithMaxResponseBytes(100))
+	if _, err := e.Execute(context.Background(), query, nil, q); err == nil || err.Error() != "response too large, exceeding the limit of 100 bytes" {
+		t.Errorf("expected response too large error, but received %v", err)
+	}
+	if calls >= 10 {
+		t.Errorf("expected execution to stop once the limit was exceeded, but value was resolved %d times", calls)
+	}
+}
+
+func TestRequestTimeout(t *testing.T) {
+	query := &Object{
+		Name:   "Query",
+		Fields: make(map[string]*Field),
+	}
+	noArguments := func(json interface{}) (interface{}, error) {
+		return nil, nil
+	}
+	query.Fields["hasDeadline"] = &Field{
+		Resolve: func(ctx context.Context, source, args interface{}, selectionSet *SelectionSet) (interface{}, error) {
+			remaining, ok := RemainingTime(ctx)
+			return ok && remaining > 0 && remaining <= time.Second, nil
+		},
+		Type:           &Scalar{Type: "bool"},
+		ParseArguments: noArguments,
+	}
+	query.Fields["slow"] = &Field{
+		Resolve: func(ctx context.Context, source, args interface{}, selectionSet *SelectionSet) (interface{}, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+		Type:           &Scalar{Type: "string"},
+		ParseArguments: noArguments,
+		Expensive:      true,
+	}
+
+	query.Fields["blocked"] = &Field{
+		Resolve: func(ctx context.Context, source, args interface{}, selectionSet *SelectionSet) (interface{}, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+		Type:           &Scalar{Type: "string"},
+		ParseArguments: noArguments,
+	}
+
+	q := MustParse(`{ hasDeadline slow }`, nil)
+	if err := PrepareQuery(query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+
+	// The fields resolved in time are returned with the error.
+	e := NewExecutor(WithRequestTimeout(10 * time.Millisecond))
+	result, err := e.Execute(context.Background(), query, nil, q)
+	if err == nil || err.Error() != "slow: context deadline exceeded" {
+		t.Errorf("expected deadline error, but received %v", err)
+	}
+	if !reflect.DeepEqual(result, map[string]interface{}{"hasDeadline": true, "slow": nil}) {
+		t.Errorf("expected partial result, but received %v", result)
+	}
+
+	blocked := MustParse(`{ hasDeadline blocked }`, nil)
+	if err := PrepareQuery(query, blocked.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	result, err = e.Execute(context.Background(), query, nil, blocked)
+	if err == nil || err.Error() != "blocked: context deadline exceeded" {
+		t.Errorf("expected deadline error, but received %v", err)
+	}
+	if !reflect.DeepEqual(result, map[string]interface{}{"hasDeadline": true, "blocked": nil}) {
+		t.Errorf("expected partial result, but received %v", result)
+	}
+
+	var buf bytes.Buffer
+	e = NewExecutor(WithRequestTimeout(10*time.Millisecond), WithStreamingWriter(&buf))
+	if _, err := e.Execute(context.Background(), query, nil, q); err != nil {
+		t.Error(err)
+	}
+	expected := `{"data":{"hasDeadline":true,"slow":null},"errors":["slow: context deadline exceeded"]}` + "\n"
+	if buf.String() != expected {
+		t.Errorf("expected %s, got %s", expected, buf.String())
+	}
+}
+
 // TestPanic tests that a panicing resolver will report an error to a
 // context implementing PanicReporter instead of crashing the server.
 func TestPanic(t *testing.T) {
@@ -283,9 +534,85 @@ func TestPanic(t *testing.T) {
 	if err == nil || !strings.Contains(err.Error(), "test panic") {
 		t.Error("expected test panic")
 	}
+	if strings.Contains(err.Error(), "executor_test.go") {
+		t.Error("expected no stacktrace outside of debugging")
+	}
+
+	_, err = NewExecutor(WithPanicStacks(true)).Execute(context.Background(), query, nil, q)
+	if err == nil || !strings.Contains(err.Error(), "test panic") {
+		t.Error("expected test panic")
+	}
 	if !strings.Contains(err.Error(), "executor_test.go") {
 		t.Error("expected stacktrace")
 	}
 }
 
+func TestPanicHandler(t *testing.T) {
+	query := makeQuery(nil)
+	query.Fields["expensivePanic"] = &Field{
+		Resolve: func(ctx context.Context, source, args interface{}, selectionSet *SelectionSet) (interface{}, error) {
+			panic("expensive panic")
+		},
+		Type:           &Scalar{Type: "string"},
+		ParseArguments: query.Fields["panic"].ParseArguments,
+		Expensive:      true,
+	}
+
+	var recovered []interface{}
+	var mu sync.Mutex
+	e := NewExecutor(WithPanicHandler(func(ctx context.Context, r interface{}) error {
+		mu.Lock()
+		defer mu.Unlock()
+		recovered = append(recovered, r)
+		return errors.New("internal error")
+	}))
+
+	for _, field := range []string{"panic", "expensivePanic"} {
+		q := MustParse(fmt.Sprintf("{ %s }", field), nil)
+		if err := PrepareQuery(query, q.SelectionSet); err != nil {
+			t.Fatal(err)
+		}
+		_, err := e.Execute(context.Background(), query, nil, q)
+		if err == nil || err.Error() != field+": internal error" {
+			t.Errorf("expected internal error, but received %v", err)
+		}
+	}
+	if !reflect.DeepEqual(recovered, []interface{}{"test panic", "expensive panic"}) {
+		t.Errorf("expected both panics to be handled, but received %v", recovered)
+	}
+}
+
 // TODO: Verify caching and concurrency
+
+func TestFieldUsage(t *testing.T) {
+	query := makeQuery(nil)
+	usage := NewFieldUsage(&Schema{Query: query})
+
+	q := MustParse(`{ a { value } }`, nil)
+	if err := PrepareQuery(query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	e := NewExecutor(WithFieldUsage(usage))
+	for i := 0; i < 2; i++ {
+		if _, err := e.Execute(context.Background(), query, nil, q); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	counts := usage.Counts()
+	if counts["Query.a"] != 2 || counts["A.value"] != 2 {
+		t.Errorf("bad counts %v", counts)
+	}
+	expected := []string{"A.fieldWithArgs", "A.nested", "A.valuePtr", "Query.as", "Query.error", "Query.panic", "Query.static"}
+	if !reflect.DeepEqual(usage.Unused(), expected) {
+		t.Errorf("expected unused %v, received %v", expected, usage.Unused())
+	}
+
+	reported := make(chan []string, 1)
+	usage.ReportUnusedAfter(time.Millisecond, func(unused []string) {
+		reported <- unused
+	})
+	if unused := <-reported; !reflect.DeepEqual(unused, expected) {
+		t.Errorf("expected report %v, received %v", expected, unused)
+	}
+}
@@ -0,0 +1,16 @@
+package graphql
+
+// ClearLocations clears the locations Parse records on the selections of
+// selectionSet, so that tests can compare parsed queries with literals.
+func ClearLocations(selectionSet *SelectionSet) {
+	if selectionSet == nil {
+		return
+	}
+	for _, selection := range selectionSet.Selections {
+		selection.loc = nil
+		ClearLocations(selection.SelectionSet)
+	}
+	for _, fragment := range selectionSet.Fragments {
+		ClearLocations(fragment.SelectionSet)
+	}
+}
@@ -0,0 +1,53 @@
+package graphql
+
+import (
+	"context"
+	"sync"
+)
+
+// extensionsKey is the context key for the extensions of a query's response.
+type extensionsKey struct{}
+
+type extensions struct {
+	mu     sync.Mutex
+	values map[string]interface{}
+}
+
+// WithExtensions returns a context that collects the extensions added with
+// AddExtension while executing a query, and a function that returns the
+// extensions collected so far.
+func WithExtensions(ctx context.Context) (context.Context, func() map[string]interface{}) {
+	e := &extensions{}
+	return context.WithValue(ctx, extensionsKey{}, e), func() map[string]interface{} {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		if len(e.values) == 0 {
+			return nil
+		}
+		values := make(map[string]interface{}, len(e.values))
+		for k, v := range e.values {
+			values[k] = v
+		}
+		return values
+	}
+}
+
+// AddExtension sets key to value in the "extensions" of the response to the
+// query executing in ctx, for metadata that does not belong in its data, such
+// as cache hits or downstream latency. It is safe to call from concurrent
+// resolvers. If several resolvers set the same key, the last value set is
+// kept. HTTPHandler reports warnings added with AddWarning under "warnings",
+// replacing an extension with that key. AddExtension does nothing if ctx does
+// not collect extensions.
+func AddExtension(ctx context.Context, key string, value interface{}) {
+	e, ok := ctx.Value(extensionsKey{}).(*extensions)
+	if !ok {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.values == nil {
+		e.values = make(map[string]interface{})
+	}
+	e.values[key] = value
+}
@@ -1,26 +1,201 @@
 package graphql
 
 import (
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/samsarahq/thunder/batch"
 	"github.com/samsarahq/thunder/reactive"
 )
 
 func HTTPHandler(schema *Schema, middlewares ...MiddlewareFunc) http.Handler {
-	return &httpHandler{
-		schema:      schema,
-		middlewares: middlewares,
+	return NewHTTPHandler(schema, WithHTTPMiddlewares(middlewares...))
+}
+
+// NewHTTPHandler creates an http.Handler that serves queries against schema,
+// configured with opts.
+func NewHTTPHandler(schema *Schema, opts ...HTTPHandlerOption) http.Handler {
+	h := &httpHandler{
+		schema: schema,
+	}
+	for _, opt := range opts {
+		opt(h)
 	}
+	h.maxInputDepth = NewExecutor(h.executorOpts...).inputDepth()
+	return h
 }
 
 type httpHandler struct {
-	schema      *Schema
-	middlewares []MiddlewareFunc
+	schema       *Schema
+	middlewares  []MiddlewareFunc
+	executorOpts []ExecutorOption
+	streaming    bool
+
+	compression        bool
+	compressionMinSize int
+
+	sizeLimits     querySizeLimits
+	maxInputDepth  int
+	errorLocations bool
+	queryCache     *QueryCache
+	batchStats     bool
+	batchingWait   time.Duration
+}
+
+// An HTTPHandlerOption configures the handler returned by NewHTTPHandler.
+type HTTPHandlerOption func(*httpHandler)
+
+// WithHTTPMiddlewares adds middlewares that wrap every query served by the
+// handler.
+func WithHTTPMiddlewares(middlewares ...MiddlewareFunc) HTTPHandlerOption {
+	return func(h *httpHandler) {
+		h.middlewares = append(h.middlewares, middlewares...)
+	}
+}
+
+// WithHTTPExecutorOptions configures the executor used to run queries served
+// by the handler.
+func WithHTTPExecutorOptions(opts ...ExecutorOption) HTTPHandlerOption {
+	return func(h *httpHandler) {
+		h.executorOpts = append(h.executorOpts, opts...)
+	}
+}
+
+// WithHTTPStreaming makes the handler stream query results to the client as
+// they are serialized. See WithStreamingWriter for how errors are reported.
+func WithHTTPStreaming() HTTPHandlerOption {
+	return func(h *httpHandler) {
+		h.streaming = true
+	}
+}
+
+// WithHTTPCompression makes the handler gzip responses of at least minSize
+// bytes for clients that accept gzip encoding. Streamed responses are always
+// compressed, since their size is not known in advance, and are flushed
+// through the compressor as they are written.
+func WithHTTPCompression(minSize int) HTTPHandlerOption {
+	return func(h *httpHandler) {
+		h.compression = true
+		h.compressionMinSize = minSize
+	}
+}
+
+// WithHTTPMaxQuerySize makes the handler reject query documents longer than
+// bytes before parsing them.
+func WithHTTPMaxQuerySize(bytes int) HTTPHandlerOption {
+	return func(h *httpHandler) {
+		h.sizeLimits.maxBytes = bytes
+	}
+}
+
+// WithHTTPMaxTokens makes the handler reject query documents of more than n
+// lexical tokens before parsing them. Tokens are counted without building a
+// syntax tree, and counting stops as soon as the limit is exceeded.
+func WithHTTPMaxTokens(n int) HTTPHandlerOption {
+	return func(h *httpHandler) {
+		h.sizeLimits.maxTokens = n
+	}
+}
+
+// WithHTTPMaxInputDepth makes the handler reject arguments and variables with
+// objects and lists nested more than n levels deep, instead of
+// DefaultMaxInputDepth. A negative n removes the limit. It is the same as
+// WithHTTPExecutorOptions(WithMaxInputDepth(n)).
+func WithHTTPMaxInputDepth(n int) HTTPHandlerOption {
+	return WithHTTPExecutorOptions(WithMaxInputDepth(n))
+}
+
+// WithHTTPErrorLocations makes the handler report the errors found by Parse and
+// PrepareQuery in the GraphQL error format, as objects with a message and the
+// locations of the offending tokens in the query, one per error. Other errors
+// are still reported as strings.
+func WithHTTPErrorLocations() HTTPHandlerOption {
+	return func(h *httpHandler) {
+		h.errorLocations = true
+	}
+}
+
+// WithHTTPQueryCache makes the handler parse and prepare queries with cache.
+func WithHTTPQueryCache(cache *QueryCache) HTTPHandlerOption {
+	return func(h *httpHandler) {
+		h.queryCache = cache
+	}
+}
+
+// WithHTTPBatchStats makes the handler report how well the batch.Funcs invoked
+// by a query batched their invocations, as the batch.Stats of the query under
+// the "batch" extension. Streamed responses do not report extensions.
+func WithHTTPBatchStats() HTTPHandlerOption {
+	return func(h *httpHandler) {
+		h.batchStats = true
+	}
+}
+
+// WithHTTPBatchingWait makes every batch of a query served by the handler wait
+// d after its first invocation before running, as with batch.WithBatchingWait.
+func WithHTTPBatchingWait(d time.Duration) HTTPHandlerOption {
+	return func(h *httpHandler) {
+		h.batchingWait = d
+	}
+}
+
+// acceptsGzip returns true if r's Accept-Encoding header allows gzip, either
+// by name or with *, and its quality value is not 0, as in "gzip;q=0.0". An
+// encoding of gzip refuses gzip even if * allows it.
+func acceptsGzip(r *http.Request) bool {
+	named, wildcard := false, false
+	for _, header := range r.Header["Accept-Encoding"] {
+		for _, encoding := range strings.Split(header, ",") {
+			params := strings.Split(encoding, ";")
+			name := strings.ToLower(strings.TrimSpace(params[0]))
+			accepted := true
+			for _, param := range params[1:] {
+				param = strings.TrimSpace(param)
+				if len(param) < 2 || strings.ToLower(param[:2]) != "q=" {
+					continue
+				}
+				if q, err := strconv.ParseFloat(param[2:], 64); err != nil || q <= 0 {
+					accepted = false
+				}
+			}
+			switch name {
+			case "gzip":
+				if !accepted {
+					return false
+				}
+				named = true
+			case "*":
+				wildcard = accepted
+			}
+		}
+	}
+	return named || wildcard
+}
+
+// gzipFlushWriter flushes compressed output to the client whenever the
+// streaming writer flushes.
+type gzipFlushWriter struct {
+	gz *gzip.Writer
+	w  http.ResponseWriter
+}
+
+func (g *gzipFlushWriter) Write(p []byte) (int, error) {
+	return g.gz.Write(p)
+}
+
+func (g *gzipFlushWriter) Flush() {
+	g.gz.Flush()
+	if flusher, ok := g.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
 }
 
 type httpPostBody struct {
@@ -29,18 +204,48 @@ type httpPostBody struct {
 }
 
 type httpResponse struct {
-	Data   interface{} `json:"data"`
-	Errors []string    `json:"errors"`
+	Data       interface{}            `json:"data"`
+	Errors     []interface{}          `json:"errors"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
 }
 
 func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	writeResponse := func(value interface{}, err error) {
-		response := httpResponse{}
-		if err != nil {
-			response.Errors = []string{err.Error()}
-		} else {
-			response.Data = value
+	compress := h.compression && acceptsGzip(r)
+	if h.compression {
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+
+	// gz is set once the response is being compressed.
+	var gz *gzip.Writer
+	defer func() {
+		if gz != nil {
+			gz.Close()
+		}
+	}()
+	startGzip := func() {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Encoding", "gzip")
+		gz = gzip.NewWriter(w)
+	}
+
+	writeResponse := func(value interface{}, err error, extensions map[string]interface{}, warnings []Warning) {
+		response := httpResponse{Extensions: extensions}
+		if len(warnings) > 0 {
+			if response.Extensions == nil {
+				response.Extensions = make(map[string]interface{})
+			}
+			response.Extensions["warnings"] = warnings
 		}
+		if queryErrors, ok := err.(QueryErrors); ok && h.errorLocations {
+			for _, queryErr := range queryErrors {
+				response.Errors = append(response.Errors, queryErr)
+			}
+		} else if err != nil {
+			response.Errors = []interface{}{err.Error()}
+		}
+		// The data of a query that timed out is returned with its error.
+		response.Data = value
 
 		responseJSON, err := json.Marshal(response)
 		if err != nil {
@@ -48,49 +253,77 @@ func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		if gz == nil && compress && len(responseJSON) >= h.compressionMinSize {
+			startGzip()
+		}
+		if gz != nil {
+			gz.Write(responseJSON)
+			gz.Write([]byte("\n"))
+			return
+		}
+
 		http.Error(w, string(responseJSON), http.StatusOK)
 	}
 
 	if r.Method != "POST" {
-		writeResponse(nil, errors.New("request must be a POST"))
+		writeResponse(nil, errors.New("request must be a POST"), nil, nil)
 		return
 	}
 
 	if r.Body == nil {
-		writeResponse(nil, errors.New("request must include a query"))
+		writeResponse(nil, errors.New("request must include a query"), nil, nil)
 		return
 	}
 
 	var params httpPostBody
 	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
-		writeResponse(nil, err)
+		writeResponse(nil, err, nil, nil)
 		return
 	}
 
-	query, err := Parse(params.Query, params.Variables)
-	if err != nil {
-		writeResponse(nil, err)
+	if err := h.sizeLimits.check(params.Query); err != nil {
+		writeResponse(nil, err, nil, nil)
 		return
 	}
 
-	if err := PrepareQuery(h.schema.Query, query.SelectionSet); err != nil {
-		writeResponse(nil, err)
+	query, err := parseAndPrepare(h.queryCache, h.schema.Query, params.Query, params.Variables, h.maxInputDepth)
+	if err != nil {
+		writeResponse(nil, err, nil, nil)
 		return
 	}
 
 	var wg sync.WaitGroup
-	e := Executor{}
+	executorOpts := h.executorOpts
+	if h.streaming {
+		var streamWriter io.Writer = w
+		if compress {
+			startGzip()
+			streamWriter = &gzipFlushWriter{gz: gz, w: w}
+		}
+		executorOpts = append(executorOpts[:len(executorOpts):len(executorOpts)], WithStreamingWriter(streamWriter))
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+	}
+	e := NewExecutor(executorOpts...)
 
 	wg.Add(1)
 	runner := reactive.NewRerunner(r.Context(), func(ctx context.Context) (interface{}, error) {
 		defer wg.Done()
 
-		ctx = batch.WithBatching(ctx)
+		if h.batchingWait > 0 {
+			ctx = batch.WithBatchingWait(ctx, h.batchingWait)
+		} else {
+			ctx = batch.WithBatching(ctx)
+		}
+		ctx, warnings := WithWarnings(ctx)
+		ctx, extensions := WithExtensions(ctx)
 
 		var middlewares []MiddlewareFunc
 		middlewares = append(middlewares, h.middlewares...)
+		executed := false
 		middlewares = append(middlewares, func(input *ComputationInput, next MiddlewareNextFunc) *ComputationOutput {
 			output := next(input)
+			executed = true
 			output.Current, output.Error = e.Execute(input.Ctx, h.schema.Query, nil, input.ParsedQuery)
 			return output
 		})
@@ -102,17 +335,27 @@ func (h *httpHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			Variables:   params.Variables,
 		})
 		current, err := output.Current, output.Error
+		if h.batchStats {
+			if stats := batch.Stats(ctx); len(stats) > 0 {
+				AddExtension(ctx, "batch", stats)
+			}
+		}
+
+		if h.streaming && executed {
+			// The executor has already written the response.
+			return nil, err
+		}
 
 		if err != nil {
 			if extractPathError(err) == context.Canceled {
 				return nil, err
 			}
 
-			writeResponse(nil, err)
+			writeResponse(current, err, extensions(), nil)
 			return nil, err
 		}
 
-		writeResponse(current, nil)
+		writeResponse(current, nil, extensions(), warnings())
 		return nil, nil
 	}, DefaultMinRerunInterval)
 
@@ -1,18 +1,32 @@
 package graphql_test
 
 import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/kylelemons/godebug/pretty"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/samsarahq/thunder/batch"
 
 	"github.com/samsarahq/thunder/graphql"
 	"github.com/samsarahq/thunder/graphql/schemabuilder"
 )
 
 func testHTTPRequest(req *http.Request) *httptest.ResponseRecorder {
+	return testHTTPRequestWithOptions(req)
+}
+
+func testHTTPRequestWithOptions(req *http.Request, opts ...graphql.HTTPHandlerOption) *httptest.ResponseRecorder {
 	schema := schemabuilder.NewSchema()
 
 	query := schema.Query()
@@ -23,7 +37,7 @@ func testHTTPRequest(req *http.Request) *httptest.ResponseRecorder {
 	builtSchema := schema.MustBuild()
 
 	rr := httptest.NewRecorder()
-	handler := graphql.HTTPHandler(builtSchema)
+	handler := graphql.NewHTTPHandler(builtSchema, opts...)
 
 	handler.ServeHTTP(rr, req)
 	return rr
@@ -80,6 +94,32 @@ func TestHTTPMustHaveQuery(t *testing.T) {
 	}
 }
 
+func TestHTTPErrorLocations(t *testing.T) {
+	body := `{"query": "{ a: mirror(value: 1) a: other(value: 2) mirror @defer }"}`
+
+	req, err := http.NewRequest("POST", "/graphql", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := testHTTPRequest(req)
+	if diff := pretty.Compare(rr.Body.String(), "{\"data\":null,\"errors\":[\"directives not supported\\nsame alias with different name\"]}\n"); diff != "" {
+		t.Errorf("expected response to match, but received %s", diff)
+	}
+
+	req, err = http.NewRequest("POST", "/graphql", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr = testHTTPRequestWithOptions(req, graphql.WithHTTPErrorLocations())
+	expected := `{"data":null,"errors":[` +
+		`{"message":"directives not supported","locations":[{"line":1,"column":49}]},` +
+		`{"message":"same alias with different name","locations":[{"line":1,"column":3},{"line":1,"column":23}]}` +
+		`]}` + "\n"
+	if diff := pretty.Compare(rr.Body.String(), expected); diff != "" {
+		t.Errorf("expected response to match, but received %s", diff)
+	}
+}
+
 func TestHTTPSuccess(t *testing.T) {
 	req, err := http.NewRequest("POST", "/graphql", strings.NewReader(`{"query": "query TestQuery($value: int64) { mirror(value: $value) }", "variables": { "value": 1 }}`))
 	if err != nil {
@@ -96,3 +136,275 @@ func TestHTTPSuccess(t *testing.T) {
 		t.Errorf("expected response to match, but received %s", diff)
 	}
 }
+
+func TestHTTPCompression(t *testing.T) {
+	body := `{"query": "{ mirror(value: 1) }"}`
+	expected := "{\"data\":{\"mirror\":-1},\"errors\":null}\n"
+
+	for _, c := range []struct {
+		name       string
+		opts       []graphql.HTTPHandlerOption
+		encoding   string
+		compressed bool
+	}{
+		{"large enough", []graphql.HTTPHandlerOption{graphql.WithHTTPCompression(10)}, "gzip, deflate", true},
+		{"too small", []graphql.HTTPHandlerOption{graphql.WithHTTPCompression(1000)}, "gzip", false},
+		{"not accepted", []graphql.HTTPHandlerOption{graphql.WithHTTPCompression(10)}, "deflate, gzip;q=0", false},
+		{"zero quality", []graphql.HTTPHandlerOption{graphql.WithHTTPCompression(10)}, "gzip;q=0.0", false},
+		{"zero quality with padding", []graphql.HTTPHandlerOption{graphql.WithHTTPCompression(10)}, "gzip; q=0.00", false},
+		{"refused over wildcard", []graphql.HTTPHandlerOption{graphql.WithHTTPCompression(10)}, "*, gzip;q=0", false},
+		{"low quality", []graphql.HTTPHandlerOption{graphql.WithHTTPCompression(10)}, "gzip;q=0.5", true},
+		{"wildcard", []graphql.HTTPHandlerOption{graphql.WithHTTPCompression(10)}, "deflate, *;q=1.0", true},
+		{"streaming", []graphql.HTTPHandlerOption{graphql.WithHTTPCompression(1000), graphql.WithHTTPStreaming()}, "gzip", true},
+	} {
+		req, err := http.NewRequest("POST", "/graphql", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Accept-Encoding", c.encoding)
+
+		rr := testHTTPRequestWithOptions(req, c.opts...)
+		if rr.Code != http.StatusOK {
+			t.Errorf("%s: expected 200, but received %d", c.name, rr.Code)
+		}
+
+		actual := rr.Body.String()
+		if c.compressed {
+			if rr.Header().Get("Content-Encoding") != "gzip" {
+				t.Errorf("%s: expected gzip encoding", c.name)
+			}
+			reader, err := gzip.NewReader(rr.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			bytes, err := ioutil.ReadAll(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			actual = string(bytes)
+		} else if rr.Header().Get("Content-Encoding") != "" {
+			t.Errorf("%s: expected no encoding", c.name)
+		}
+
+		if diff := pretty.Compare(actual, expected); diff != "" {
+			t.Errorf("%s: expected response to match, but received %s", c.name, diff)
+		}
+	}
+}
+
+func TestHTTPMaxInputDepth(t *testing.T) {
+	body := `{"query": "{ mirror(value: [1]) }"}`
+	expected := "{\"data\":null,\"errors\":[\"input is nested too deeply\"]}\n"
+
+	for _, opts := range [][]graphql.HTTPHandlerOption{
+		{graphql.WithHTTPMaxInputDepth(0)},
+		{graphql.WithHTTPExecutorOptions(graphql.WithMaxInputDepth(0))},
+	} {
+		req, err := http.NewRequest("POST", "/graphql", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := testHTTPRequestWithOptions(req, opts...)
+
+		if diff := pretty.Compare(rr.Body.String(), expected); diff != "" {
+			t.Errorf("expected response to match, but received %s", diff)
+		}
+	}
+}
+
+func TestHTTPQuerySizeLimits(t *testing.T) {
+	// The query below is 66 bytes and 17 tokens long.
+	body := `{"query": "query TestQuery($value: int64) { mirror(value: $value) } # comment", "variables": { "value": 1 }}`
+
+	for _, c := range []struct {
+		opts     []graphql.HTTPHandlerOption
+		expected string
+	}{
+		{
+			opts:     []graphql.HTTPHandlerOption{graphql.WithHTTPMaxQuerySize(66), graphql.WithHTTPMaxTokens(17)},
+			expected: "{\"data\":{\"mirror\":-1},\"errors\":null}\n",
+		},
+		{
+			opts:     []graphql.HTTPHandlerOption{graphql.WithHTTPMaxQuerySize(65)},
+			expected: "{\"data\":null,\"errors\":[\"query is 66 bytes, exceeding the limit of 65 bytes\"]}\n",
+		},
+		{
+			opts:     []graphql.HTTPHandlerOption{graphql.WithHTTPMaxTokens(16)},
+			expected: "{\"data\":null,\"errors\":[\"query exceeds the limit of 16 tokens\"]}\n",
+		},
+	} {
+		req, err := http.NewRequest("POST", "/graphql", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := testHTTPRequestWithOptions(req, c.opts...)
+
+		if diff := pretty.Compare(rr.Body.String(), c.expected); diff != "" {
+			t.Errorf("expected response to match, but received %s", diff)
+		}
+	}
+}
+
+func TestHTTPOptionalBackend(t *testing.T) {
+	schema := schemabuilder.NewSchema()
+	query := schema.Query()
+	query.FieldFunc("name", func() string {
+		return "me"
+	})
+	query.FieldFunc("recommendations", func() (*string, error) {
+		return nil, errors.New("recommendations unavailable")
+	}, schemabuilder.OptionalBackend)
+	query.FieldFunc("rating", func() (int64, bool, error) {
+		return 0, false, errors.New("ratings unavailable")
+	}, schemabuilder.OptionalBackend)
+	query.FieldFunc("lazyOuter", func() (func() (*string, error), error) {
+		return nil, errors.New("outer unavailable")
+	}, schemabuilder.OptionalBackend)
+	query.FieldFunc("lazyInner", func() (func() (*string, error), error) {
+		return func() (*string, error) {
+			return nil, errors.New("inner unavailable")
+		}, nil
+	}, schemabuilder.OptionalBackend)
+	builtSchema := schema.MustBuild()
+
+	req, err := http.NewRequest("POST", "/graphql", strings.NewReader(`{"query": "{ name recommendations rating lazyOuter lazyInner }"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	graphql.NewHTTPHandler(builtSchema).ServeHTTP(rr, req)
+
+	expected := `{"data":{"lazyInner":null,"lazyOuter":null,"name":"me","rating":null,"recommendations":null},"errors":null,` +
+		`"extensions":{"warnings":[{"message":"recommendations unavailable"},{"message":"ratings unavailable"},` +
+		`{"message":"outer unavailable"},{"message":"inner unavailable"}]}}` + "\n"
+	if diff := pretty.Compare(rr.Body.String(), expected); diff != "" {
+		t.Errorf("expected response to match, but received %s", diff)
+	}
+
+	nonNull := schemabuilder.NewSchema()
+	nonNull.Query().FieldFunc("name", func() (string, error) {
+		return "", nil
+	}, schemabuilder.OptionalBackend)
+	if _, err := nonNull.Build(); err == nil || !strings.Contains(err.Error(), "optional backend requires a nullable result") {
+		t.Errorf("expected non-null optional backend to fail, but received %v", err)
+	}
+}
+
+// wrappedError wraps an inner error with context, for TestHTTPVerboseErrors.
+type wrappedError struct {
+	message string
+	inner   error
+}
+
+func (e *wrappedError) Error() string { return e.message + ": " + e.inner.Error() }
+func (e *wrappedError) Unwrap() error { return e.inner }
+
+func TestHTTPVerboseErrors(t *testing.T) {
+	schema := schemabuilder.NewSchema()
+	query := schema.Query()
+	query.FieldFunc("balance", func(ctx context.Context) (int64, error) {
+		return 0, &wrappedError{message: "loading balance", inner: errors.New("connection refused")}
+	})
+	builtSchema := schema.MustBuild()
+
+	for _, c := range []struct {
+		verbose  bool
+		expected string
+	}{
+		{
+			verbose:  false,
+			expected: `{"data":null,"errors":["balance: loading balance: connection refused"]}` + "\n",
+		},
+		{
+			verbose: true,
+			expected: `{"data":null,"errors":["balance: loading balance: connection refused"],` +
+				`"extensions":{"debug":{"path":"balance","chain":[` +
+				`{"message":"loading balance: connection refused","type":"*graphql_test.wrappedError"},` +
+				`{"message":"connection refused","type":"*errors.errorString"}]}}}` + "\n",
+		},
+	} {
+		req, err := http.NewRequest("POST", "/graphql", strings.NewReader(`{"query": "{ balance }"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		graphql.NewHTTPHandler(builtSchema, graphql.WithHTTPExecutorOptions(graphql.WithVerboseErrors(c.verbose))).ServeHTTP(rr, req)
+
+		if diff := pretty.Compare(rr.Body.String(), c.expected); diff != "" {
+			t.Errorf("expected response to match, but received %s", diff)
+		}
+	}
+}
+
+func TestHTTPExtensions(t *testing.T) {
+	schema := schemabuilder.NewSchema()
+	query := schema.Query()
+	query.FieldFunc("cached", func(ctx context.Context) string {
+		graphql.AddExtension(ctx, "cacheHit", true)
+		return "value"
+	})
+	query.FieldFunc("slow", func(ctx context.Context) string {
+		graphql.AddExtension(ctx, "latencyMs", 20)
+		return "value"
+	})
+	builtSchema := schema.MustBuild()
+
+	req, err := http.NewRequest("POST", "/graphql", strings.NewReader(`{"query": "{ cached slow }"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	graphql.NewHTTPHandler(builtSchema).ServeHTTP(rr, req)
+
+	expected := `{"data":{"cached":"value","slow":"value"},"errors":null,` +
+		`"extensions":{"cacheHit":true,"latencyMs":20}}` + "\n"
+	if diff := pretty.Compare(rr.Body.String(), expected); diff != "" {
+		t.Errorf("expected response to match, but received %s", diff)
+	}
+}
+
+func TestHTTPBatchStats(t *testing.T) {
+	type User struct {
+		Id int64
+	}
+
+	schema := schemabuilder.NewSchema()
+	schema.Query().FieldFunc("users", func() []*User {
+		return []*User{{Id: 1}, {Id: 2}, {Id: 3}}
+	})
+	schema.Object("User", User{}).BatchFieldFunc("label", func(ctx context.Context, users []*User) ([]string, error) {
+		labels := make([]string, len(users))
+		for i, u := range users {
+			labels[i] = fmt.Sprintf("user%d", u.Id)
+		}
+		return labels, nil
+	})
+	builtSchema := schema.MustBuild()
+
+	req, err := http.NewRequest("POST", "/graphql", strings.NewReader(`{"query": "{ users { label } }"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler := graphql.NewHTTPHandler(builtSchema, graphql.WithHTTPBatchStats(), graphql.WithHTTPBatchingWait(50*time.Millisecond))
+	handler.ServeHTTP(rr, req)
+
+	var response struct {
+		Extensions struct {
+			Batch []batch.FuncStats `json:"batch"`
+		} `json:"extensions"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Extensions.Batch) != 1 {
+		t.Fatalf("expected stats for 1 func, but received %s", rr.Body.String())
+	}
+	stats := response.Extensions.Batch[0]
+	assert.Equal(t, "label", stats.Name)
+	assert.Equal(t, 3, stats.Invocations)
+	assert.Equal(t, 3, stats.Args)
+	assert.Equal(t, 1, stats.Batches)
+}
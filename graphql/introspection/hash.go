@@ -0,0 +1,47 @@
+package introspection
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+
+	"github.com/samsarahq/thunder/graphql"
+)
+
+// SchemaHash returns a hash of the introspection result of schema. The hash
+// is stable across processes, and changes whenever a type, field, or argument
+// in the schema changes.
+func SchemaHash(schema *graphql.Schema) (string, error) {
+	bytes, err := computeSchemaJSON(schema)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(bytes)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+type healthResponse struct {
+	Status     string `json:"status"`
+	SchemaHash string `json:"schemaHash"`
+}
+
+// HealthHandler returns an http.Handler that reports the server as healthy,
+// along with the SchemaHash of schema, so that gateways can detect readiness
+// and schema changes. The hash is computed once, when HealthHandler is
+// called.
+func HealthHandler(schema *graphql.Schema) (http.Handler, error) {
+	hash, err := SchemaHash(schema)
+	if err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(healthResponse{Status: "ok", SchemaHash: hash})
+	if err != nil {
+		return nil, err
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}), nil
+}
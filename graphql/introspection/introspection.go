@@ -95,6 +95,8 @@ func (s *introspection) registerType(schema *schemabuilder.Schema) {
 		switch t.Inner.(type) {
 		case *graphql.Object:
 			return OBJECT
+		case *graphql.Interface:
+			return INTERFACE
 		case *graphql.Scalar:
 			return SCALAR
 		case *graphql.Enum:
@@ -114,6 +116,8 @@ func (s *introspection) registerType(schema *schemabuilder.Schema) {
 		switch t := t.Inner.(type) {
 		case *graphql.Object:
 			return t.Name
+		case *graphql.Interface:
+			return t.Name
 		case *graphql.Scalar:
 			return t.Type
 		case *graphql.Enum:
@@ -129,13 +133,42 @@ func (s *introspection) registerType(schema *schemabuilder.Schema) {
 		switch t := t.Inner.(type) {
 		case *graphql.Object:
 			return t.Description
+		case *graphql.Interface:
+			return t.Description
 		default:
 			return ""
 		}
 	})
 
-	object.FieldFunc("interfaces", func() []Type { return nil })
-	object.FieldFunc("possibleTypes", func() []Type { return nil })
+	object.FieldFunc("specifiedByURL", func(t Type) *string {
+		switch t := t.Inner.(type) {
+		case *graphql.Scalar:
+			if t.SpecifiedByURL != "" {
+				return &t.SpecifiedByURL
+			}
+		}
+		return nil
+	})
+
+	object.FieldFunc("interfaces", func(t Type) []Type {
+		var interfaces []Type
+		if t, ok := t.Inner.(*graphql.Object); ok {
+			for _, iface := range t.Interfaces {
+				interfaces = append(interfaces, Type{Inner: iface})
+			}
+		}
+		return interfaces
+	})
+	object.FieldFunc("possibleTypes", func(t Type) []Type {
+		var types []Type
+		if t, ok := t.Inner.(*graphql.Interface); ok {
+			for _, object := range t.Types {
+				types = append(types, Type{Inner: object})
+			}
+		}
+		sort.Slice(types, func(i, j int) bool { return types[i].Inner.String() < types[j].Inner.String() })
+		return types
+	})
 
 	object.FieldFunc("inputFields", func(t Type) []InputValue {
 		var fields []InputValue
@@ -154,33 +187,17 @@ func (s *introspection) registerType(schema *schemabuilder.Schema) {
 		return fields
 	})
 
-	object.FieldFunc("fields", func(t Type, args struct {
+	object.FieldFunc("fields", func(ctx context.Context, t Type, args struct {
 		IncludeDeprecated *bool
 	}) []field {
-		var fields []field
-
+		includeDeprecated := args.IncludeDeprecated != nil && *args.IncludeDeprecated
 		switch t := t.Inner.(type) {
 		case *graphql.Object:
-			for name, f := range t.Fields {
-				var args []InputValue
-				for name, a := range f.Args {
-					args = append(args, InputValue{
-						Name: name,
-						Type: Type{Inner: a},
-					})
-				}
-				sort.Slice(args, func(i, j int) bool { return args[i].Name < args[j].Name })
-
-				fields = append(fields, field{
-					Name: name,
-					Type: Type{Inner: f.Type},
-					Args: args,
-				})
-			}
+			return visibleFields(ctx, t.Fields, t.FieldOrder, includeDeprecated)
+		case *graphql.Interface:
+			return visibleFields(ctx, t.Fields, nil, includeDeprecated)
 		}
-		sort.Slice(fields, func(i, j int) bool { return fields[i].Name < fields[j].Name })
-
-		return fields
+		return nil
 	})
 
 	object.FieldFunc("ofType", func(t Type) *Type {
@@ -200,11 +217,16 @@ func (s *introspection) registerType(schema *schemabuilder.Schema) {
 
 		switch t := t.Inner.(type) {
 		case *graphql.Enum:
+			includeDeprecated := args.IncludeDeprecated != nil && *args.IncludeDeprecated
 			var enumVals []EnumValue
 			for k, v := range t.ReverseMap {
 				val := fmt.Sprintf("%v", k)
+				reason, deprecated := enumValueDeprecation(t, v)
+				if deprecated && !includeDeprecated {
+					continue
+				}
 				enumVals = append(enumVals,
-					EnumValue{Name: v, Description: val, IsDeprecated: false, DeprecationReason: ""})
+					EnumValue{Name: v, Description: val, IsDeprecated: deprecated, DeprecationReason: reason})
 			}
 			sort.Slice(enumVals, func(i, j int) bool { return enumVals[i].Name < enumVals[j].Name })
 			return enumVals
@@ -213,6 +235,48 @@ func (s *introspection) registerType(schema *schemabuilder.Schema) {
 	})
 }
 
+// enumValueDeprecation returns the reason value of enum is deprecated for, and
+// true if it is deprecated with a "deprecated" directive.
+func enumValueDeprecation(enum *graphql.Enum, value string) (string, bool) {
+	for _, directive := range enum.ValueDirectives[value] {
+		if directive.Name == "deprecated" {
+			reason, _ := directive.Args["reason"].(string)
+			return reason, true
+		}
+	}
+	return "", false
+}
+
+// visibleFields returns the fields of fields visible to the caller in ctx, in
+// order as for sortFields. Deprecated fields are only included if
+// includeDeprecated is true.
+func visibleFields(ctx context.Context, fields map[string]*graphql.Field, order []string, includeDeprecated bool) []field {
+	var visible []field
+	for name, f := range fields {
+		if !graphql.FieldVisible(ctx, f) || (f.DeprecationReason != "" && !includeDeprecated) {
+			continue
+		}
+		var args []InputValue
+		for name, a := range f.Args {
+			args = append(args, InputValue{
+				Name: name,
+				Type: Type{Inner: a},
+			})
+		}
+		sort.Slice(args, func(i, j int) bool { return args[i].Name < args[j].Name })
+
+		visible = append(visible, field{
+			Name:              name,
+			Type:              Type{Inner: f.Type},
+			Args:              args,
+			IsDeprecated:      f.DeprecationReason != "",
+			DeprecationReason: f.DeprecationReason,
+		})
+	}
+	sortFields(visible, order)
+	return visible
+}
+
 type field struct {
 	Name              string
 	Description       string
@@ -222,6 +286,26 @@ type field struct {
 	DeprecationReason string
 }
 
+// sortFields sorts fields by their position in order, followed by the fields
+// missing from order sorted by name.
+func sortFields(fields []field, order []string) {
+	position := make(map[string]int)
+	for i, name := range order {
+		position[name] = i
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		pi, iok := position[fields[i].Name]
+		pj, jok := position[fields[j].Name]
+		if iok && jok {
+			return pi < pj
+		}
+		if iok != jok {
+			return iok
+		}
+		return fields[i].Name < fields[j].Name
+	})
+}
+
 func (s *introspection) registerField(schema *schemabuilder.Schema) {
 	schema.Object("__Field", field{})
 }
@@ -241,6 +325,26 @@ func collectTypes(typ graphql.Type, types map[string]graphql.Type) {
 				collectTypes(arg, types)
 			}
 		}
+		for _, iface := range typ.Interfaces {
+			collectTypes(iface, types)
+		}
+
+	case *graphql.Interface:
+		if _, ok := types[typ.Name]; ok {
+			return
+		}
+		types[typ.Name] = typ
+
+		for _, field := range typ.Fields {
+			collectTypes(field.Type, types)
+
+			for _, arg := range field.Args {
+				collectTypes(arg, types)
+			}
+		}
+		for _, object := range typ.Types {
+			collectTypes(object, types)
+		}
 
 	case *graphql.List:
 		collectTypes(typ.Type, types)
@@ -333,6 +437,7 @@ func AddIntrospectionToSchema(schema *graphql.Schema) {
 	for k, v := range query.Fields {
 		isQuery.Fields[k] = v
 	}
+	isQuery.FieldOrder = query.FieldOrder
 
 	schema.Query = isQuery
 }
@@ -340,7 +445,13 @@ func AddIntrospectionToSchema(schema *graphql.Schema) {
 // ComputeSchemaJSON returns the result of executing a GraphQL introspection
 // query.
 func ComputeSchemaJSON(schemaBuilderSchema schemabuilder.Schema) ([]byte, error) {
-	schema := schemaBuilderSchema.MustBuild()
+	return computeSchemaJSON(schemaBuilderSchema.MustBuild())
+}
+
+// computeSchemaJSON executes an introspection query against a copy of schema
+// with introspection added.
+func computeSchemaJSON(built *graphql.Schema) ([]byte, error) {
+	schema := &graphql.Schema{Query: built.Query, Mutation: built.Mutation}
 	AddIntrospectionToSchema(schema)
 
 	query, err := graphql.Parse(introspectionQuery, map[string]interface{}{})
@@ -1,14 +1,20 @@
 package introspection_test
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"io/ioutil"
+	"net/http/httptest"
 	"os"
 	"reflect"
 	"testing"
+	"time"
 
+	"github.com/samsarahq/thunder/graphql"
 	"github.com/samsarahq/thunder/graphql/introspection"
 	"github.com/samsarahq/thunder/graphql/schemabuilder"
+	"github.com/samsarahq/thunder/internal"
 )
 
 type User struct {
@@ -94,3 +100,480 @@ func TestComputeSchemaJSON(t *testing.T) {
 		t.Errorf("schema JSONs do not match:\n---expected---\n%+v\n---actual---\n%+v", expected, actual)
 	}
 }
+
+func TestSpecifiedByURL(t *testing.T) {
+	schemaBuilderSchema := schemabuilder.NewSchema()
+	schemaBuilderSchema.SpecifiedBy(time.Time{}, "https://tools.ietf.org/html/rfc3339")
+	query := schemaBuilderSchema.Query()
+	query.FieldFunc("now", func() time.Time {
+		return time.Now()
+	})
+	query.FieldFunc("name", func() string {
+		return "me"
+	})
+	schema := schemaBuilderSchema.MustBuild()
+	introspection.AddIntrospectionToSchema(schema)
+
+	q := graphql.MustParse(`{
+		time: __type(name: "Time") { specifiedByURL }
+		string: __type(name: "string") { specifiedByURL }
+	}`, nil)
+	if err := graphql.PrepareQuery(schema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	e := graphql.Executor{}
+	result, err := e.Execute(context.Background(), schema.Query, nil, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(internal.AsJSON(result), internal.ParseJSON(`{
+		"time": {"specifiedByURL": "https://tools.ietf.org/html/rfc3339"},
+		"string": {"specifiedByURL": null}
+	}`)) {
+		t.Errorf("bad value %v", internal.AsJSON(result))
+	}
+}
+
+func TestSchemaHash(t *testing.T) {
+	hash, err := introspection.SchemaHash(makeSchema().MustBuild())
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := introspection.SchemaHash(makeSchema().MustBuild())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != again {
+		t.Errorf("expected hashes of the same schema to match, got %s and %s", hash, again)
+	}
+
+	changed := makeSchema()
+	changed.Query().FieldFunc("extra", func() string { return "" })
+	changedHash, err := introspection.SchemaHash(changed.MustBuild())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash == changedHash {
+		t.Error("expected hash to change with the schema")
+	}
+
+	handler, err := introspection.HealthHandler(makeSchema().MustBuild())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/health", nil))
+	if expected := `{"status":"ok","schemaHash":"` + hash + `"}`; rr.Body.String() != expected {
+		t.Errorf("expected %s, got %s", expected, rr.Body.String())
+	}
+}
+
+func TestPreserveFieldOrder(t *testing.T) {
+	type Item struct {
+		Zebra string
+		Apple string
+	}
+
+	schemaBuilderSchema := schemabuilder.NewSchema()
+	schemaBuilderSchema.PreserveFieldOrder()
+	item := schemaBuilderSchema.Object("Item", Item{})
+	item.FieldFunc("middle", func(i Item) string { return "" })
+	item.FieldFunc("before", func(i Item) string { return "" })
+	query := schemaBuilderSchema.Query()
+	query.FieldFunc("item", func() Item { return Item{} })
+	query.FieldFunc("count", func() int64 { return 0 })
+	schema := schemaBuilderSchema.MustBuild()
+	introspection.AddIntrospectionToSchema(schema)
+
+	q := graphql.MustParse(`{
+		item: __type(name: "Item") { fields { name } }
+		query: __type(name: "Query") { fields { name } }
+	}`, nil)
+	if err := graphql.PrepareQuery(schema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	e := graphql.Executor{}
+	result, err := e.Execute(context.Background(), schema.Query, nil, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(internal.AsJSON(result), internal.ParseJSON(`{
+		"item": {"fields": [{"name": "zebra"}, {"name": "apple"}, {"name": "middle"}, {"name": "before"}]},
+		"query": {"fields": [{"name": "item"}, {"name": "count"}]}
+	}`)) {
+		t.Errorf("bad value %v", internal.AsJSON(result))
+	}
+}
+
+func TestDeprecatedField(t *testing.T) {
+	schemaBuilderSchema := schemabuilder.NewSchema()
+	query := schemaBuilderSchema.Query()
+	query.FieldFunc("name", func() string { return "new" })
+	query.FieldFunc("fullName", func() string { return "old" }, schemabuilder.Deprecated("use name instead"))
+	schema := schemaBuilderSchema.MustBuild()
+	introspection.AddIntrospectionToSchema(schema)
+
+	q := graphql.MustParse(`{
+		fullName
+		all: __type(name: "Query") { fields(includeDeprecated: true) { name isDeprecated deprecationReason } }
+		current: __type(name: "Query") { fields { name } }
+	}`, nil)
+	if err := graphql.PrepareQuery(schema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	e := graphql.Executor{}
+	result, err := e.Execute(context.Background(), schema.Query, nil, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(internal.AsJSON(result), internal.ParseJSON(`{
+		"fullName": "old",
+		"all": {"fields": [
+			{"name": "fullName", "isDeprecated": true, "deprecationReason": "use name instead"},
+			{"name": "name", "isDeprecated": false, "deprecationReason": ""}
+		]},
+		"current": {"fields": [{"name": "name"}]}
+	}`)) {
+		t.Errorf("bad value %v", internal.AsJSON(result))
+	}
+}
+
+type color int32
+
+func TestDeprecatedEnumValue(t *testing.T) {
+	schemaBuilderSchema := schemabuilder.NewSchema()
+	schemaBuilderSchema.Enum(color(1), map[string]interface{}{
+		"red":     color(1),
+		"crimson": color(2),
+	})
+	schemaBuilderSchema.EnumValueDirective(color(2), "crimson", "deprecated", map[string]interface{}{"reason": "use red instead"})
+	schemaBuilderSchema.Query().FieldFunc("color", func() color { return 1 })
+	schema := schemaBuilderSchema.MustBuild()
+	introspection.AddIntrospectionToSchema(schema)
+
+	q := graphql.MustParse(`{
+		all: __type(name: "color") { enumValues(includeDeprecated: true) { name isDeprecated deprecationReason } }
+		current: __type(name: "color") { enumValues { name } }
+	}`, nil)
+	if err := graphql.PrepareQuery(schema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	e := graphql.Executor{}
+	result, err := e.Execute(context.Background(), schema.Query, nil, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(internal.AsJSON(result), internal.ParseJSON(`{
+		"all": {"enumValues": [
+			{"name": "crimson", "isDeprecated": true, "deprecationReason": "use red instead"},
+			{"name": "red", "isDeprecated": false, "deprecationReason": ""}
+		]},
+		"current": {"enumValues": [{"name": "red"}]}
+	}`)) {
+		t.Errorf("bad value %v", internal.AsJSON(result))
+	}
+}
+
+func TestIntrospectionOnly(t *testing.T) {
+	schema := makeSchema().MustBuild()
+	introspection.AddIntrospectionToSchema(schema)
+	e := graphql.NewExecutor(graphql.WithIntrospectionOnly(true))
+
+	q := graphql.MustParse(`{ __type(name: "Query") { name } }`, nil)
+	if err := graphql.PrepareQuery(schema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	result, err := e.Execute(context.Background(), schema.Query, nil, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(internal.AsJSON(result), internal.ParseJSON(`{"__type": {"name": "Query"}}`)) {
+		t.Errorf("bad value %v", internal.AsJSON(result))
+	}
+
+	q = graphql.MustParse(`{ __typename ...Fields } fragment Fields on Query { me { name } }`, nil)
+	if err := graphql.PrepareQuery(schema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Execute(context.Background(), schema.Query, nil, q); err == nil || err.Error() != `only introspection queries are allowed, but "me" was selected` {
+		t.Errorf("expected data query to fail, but received %v", err)
+	}
+}
+
+func TestIntrospectionResolver(t *testing.T) {
+	schema := makeSchema().MustBuild()
+	introspection.AddIntrospectionToSchema(schema)
+	e := graphql.NewExecutor(graphql.WithIntrospectionResolver(func(ctx context.Context, selection *graphql.Selection) (interface{}, error) {
+		if selection.Name != "__type" {
+			return nil, errors.New("only __type is proxied")
+		}
+		name := selection.Args.(struct{ Name string }).Name
+		return map[string]interface{}{"name": "Remote" + name}, nil
+	}))
+
+	q := graphql.MustParse(`{ t: __type(name: "Query") { name } me { name } }`, nil)
+	if err := graphql.PrepareQuery(schema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	result, err := e.Execute(context.Background(), schema.Query, nil, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(internal.AsJSON(result), internal.ParseJSON(`{"t": {"name": "RemoteQuery"}, "me": {"name": "me", "__key": "me"}}`)) {
+		t.Errorf("bad value %v", internal.AsJSON(result))
+	}
+
+	q = graphql.MustParse(`{ __schema { queryType { name } } }`, nil)
+	if err := graphql.PrepareQuery(schema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Execute(context.Background(), schema.Query, nil, q); err == nil || err.Error() != "__schema: only __type is proxied" {
+		t.Errorf("expected the resolver's error, but received %v", err)
+	}
+}
+
+func TestAudience(t *testing.T) {
+	type Account struct {
+		Name string
+	}
+
+	schema := schemabuilder.NewSchema()
+	query := schema.Query()
+	query.FieldFunc("account", func() *Account {
+		return &Account{Name: "Acme"}
+	})
+	account := schema.Object("Account", Account{})
+	account.FieldFunc("balance", func(a *Account) int64 {
+		return 100
+	}, schemabuilder.Audience("internal"))
+	built := schema.MustBuild()
+	introspection.AddIntrospectionToSchema(built)
+	e := graphql.NewExecutor()
+
+	internalCtx := graphql.WithAudiences(context.Background(), "internal")
+	execute := func(ctx context.Context, query string) (interface{}, error) {
+		q := graphql.MustParse(query, nil)
+		if err := graphql.PrepareQuery(built.Query, q.SelectionSet); err != nil {
+			t.Fatal(err)
+		}
+		result, err := e.Execute(ctx, built.Query, nil, q)
+		return internal.AsJSON(result), err
+	}
+
+	result, err := execute(internalCtx, `{ account { name balance } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, internal.ParseJSON(`{"account": {"name": "Acme", "balance": 100}}`)) {
+		t.Errorf("bad value %v", result)
+	}
+
+	if _, err := execute(context.Background(), `{ account { name balance } }`); err == nil || err.Error() != `unknown field "balance"` {
+		t.Errorf("expected balance to be hidden, but received %v", err)
+	}
+
+	fieldsQuery := `{ __type(name: "Account") { fields { name } } }`
+	result, err = execute(context.Background(), fieldsQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, internal.ParseJSON(`{"__type": {"fields": [{"name": "name"}]}}`)) {
+		t.Errorf("bad value %v", result)
+	}
+
+	result, err = execute(internalCtx, fieldsQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, internal.ParseJSON(`{"__type": {"fields": [{"name": "balance"}, {"name": "name"}]}}`)) {
+		t.Errorf("bad value %v", result)
+	}
+}
+
+type versionKey struct{}
+
+func TestVersionedFieldFunc(t *testing.T) {
+	type Account struct {
+		First, Last string
+	}
+
+	schema := schemabuilder.NewSchema()
+	schema.VersionFunc(func(ctx context.Context) string {
+		version, _ := ctx.Value(versionKey{}).(string)
+		return version
+	})
+	query := schema.Query()
+	query.FieldFunc("account", func() *Account {
+		return &Account{First: "Ada", Last: "Lovelace"}
+	})
+	account := schema.Object("Account", Account{})
+	account.VersionedFieldFunc("name", map[string]interface{}{
+		"v1": func(a *Account, args struct{ Upper *bool }) string {
+			return a.First
+		},
+		"v2": func(a *Account, args struct{ Upper *bool }) string {
+			if args.Upper != nil && *args.Upper {
+				return "ADA LOVELACE"
+			}
+			return a.First + " " + a.Last
+		},
+	})
+	account.VersionedFieldFunc("initials", map[string]interface{}{
+		"v2": func(a *Account) string {
+			return a.First[:1] + a.Last[:1]
+		},
+	})
+	built := schema.MustBuild()
+	introspection.AddIntrospectionToSchema(built)
+	e := graphql.NewExecutor()
+
+	execute := func(version string, query string) (interface{}, error) {
+		q := graphql.MustParse(query, nil)
+		if err := graphql.PrepareQuery(built.Query, q.SelectionSet); err != nil {
+			t.Fatal(err)
+		}
+		result, err := e.Execute(context.WithValue(context.Background(), versionKey{}, version), built.Query, nil, q)
+		return internal.AsJSON(result), err
+	}
+
+	result, err := execute("v1", `{ account { name } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, internal.ParseJSON(`{"account": {"name": "Ada"}}`)) {
+		t.Errorf("bad value %v", result)
+	}
+
+	result, err = execute("v2", `{ account { name upper: name(upper: true) initials } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, internal.ParseJSON(`{"account": {"name": "Ada Lovelace", "upper": "ADA LOVELACE", "initials": "AL"}}`)) {
+		t.Errorf("bad value %v", result)
+	}
+
+	if _, err := execute("v1", `{ account { initials } }`); err == nil || err.Error() != `unknown field "initials"` {
+		t.Errorf("expected initials to be hidden from v1, but received %v", err)
+	}
+
+	result, err = execute("v1", `{ __type(name: "Account") { fields { name } } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, internal.ParseJSON(`{"__type": {"fields": [{"name": "first"}, {"name": "last"}, {"name": "name"}]}}`)) {
+		t.Errorf("bad value %v", result)
+	}
+
+	unversioned := schemabuilder.NewSchema()
+	unversioned.Query().VersionedFieldFunc("name", map[string]interface{}{"v1": func() string { return "" }})
+	if _, err := unversioned.Build(); err == nil || err.Error() != "bad method name on type schemabuilder.query: versioned field requires a version function, set with Schema.VersionFunc" {
+		t.Errorf("expected build without a version function to fail, but received %v", err)
+	}
+
+	mismatched := schemabuilder.NewSchema()
+	mismatched.VersionFunc(func(ctx context.Context) string { return "" })
+	mismatched.Query().VersionedFieldFunc("name", map[string]interface{}{
+		"v1": func() string { return "" },
+		"v2": func() int64 { return 0 },
+	})
+	if _, err := mismatched.Build(); err == nil || err.Error() != "bad method name on type schemabuilder.query: version v2: result int64! differs from string!" {
+		t.Errorf("expected mismatched versions to fail, but received %v", err)
+	}
+}
+
+func TestInterface(t *testing.T) {
+	type Author struct {
+		Id   int64
+		Name string
+	}
+	type Book struct {
+		Id    int64
+		Title string
+	}
+	type Node struct {
+		schemabuilder.Interface
+		*Author
+		*Book
+	}
+	type authorLabelArgs struct{ Upper *bool }
+	type bookLabelArgs struct{ Upper *bool }
+
+	schema := schemabuilder.NewSchema()
+	schema.Query().FieldFunc("nodes", func() []Node {
+		return []Node{
+			{Author: &Author{Id: 1, Name: "ada"}},
+			{Book: &Book{Id: 2, Title: "notes"}},
+		}
+	})
+	schema.Object("Author", Author{}).FieldFunc("label", func(a *Author, args authorLabelArgs) string {
+		if args.Upper != nil && *args.Upper {
+			return "AUTHOR"
+		}
+		return "author"
+	})
+	schema.Object("Book", Book{}).FieldFunc("label", func(b *Book, args bookLabelArgs) string {
+		if args.Upper != nil && *args.Upper {
+			return "BOOK"
+		}
+		return "book"
+	})
+	built := schema.MustBuild()
+	introspection.AddIntrospectionToSchema(built)
+	e := graphql.NewExecutor()
+
+	execute := func(query string) (interface{}, error) {
+		q := graphql.MustParse(query, nil)
+		if err := graphql.PrepareQuery(built.Query, q.SelectionSet); err != nil {
+			return nil, err
+		}
+		result, err := e.Execute(context.Background(), built.Query, nil, q)
+		return internal.AsJSON(result), err
+	}
+
+	result, err := execute(`{ nodes { __typename id label(upper: true) ... on Author { name } ...BookFields } } fragment BookFields on Book { title }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, internal.ParseJSON(`{"nodes": [
+		{"__typename": "Author", "id": 1, "label": "AUTHOR", "name": "ada"},
+		{"__typename": "Book", "id": 2, "label": "BOOK", "title": "notes"}
+	]}`)) {
+		t.Errorf("bad value %v", result)
+	}
+
+	result, err = execute(`{
+		node: __type(name: "Node") { kind fields { name } possibleTypes { name } }
+		author: __type(name: "Author") { interfaces { name } }
+	}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(result, internal.ParseJSON(`{
+		"node": {"kind": "INTERFACE", "fields": [{"name": "id"}, {"name": "label"}], "possibleTypes": [{"name": "Author"}, {"name": "Book"}]},
+		"author": {"interfaces": [{"name": "Node"}]}
+	}`)) {
+		t.Errorf("bad value %v", result)
+	}
+
+	if _, err := execute(`{ nodes { name } }`); err == nil || err.Error() != `unknown field "name"` {
+		t.Errorf("expected fields of one object to require a fragment, but received %v", err)
+	}
+	if _, err := execute(`{ nodes { ... on Query { nodes { id } } } }`); err == nil || err.Error() != `fragment on "Query" cannot apply to interface "Node"` {
+		t.Errorf("expected a fragment on another type to fail, but received %v", err)
+	}
+
+	unrelated := schemabuilder.NewSchema()
+	unrelated.Query().FieldFunc("node", func() *struct {
+		schemabuilder.Interface
+		*Author
+	} {
+		return nil
+	})
+	if _, err := unrelated.Build(); err == nil || err.Error() != "bad method node on type schemabuilder.query: bad type struct { schemabuilder.Interface; *introspection_test.Author }: should have a name" {
+		t.Errorf("expected an unnamed interface to fail, but received %v", err)
+	}
+}
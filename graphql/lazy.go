@@ -0,0 +1,93 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+)
+
+// Lazy is a deferred field value. A Resolve function may return a Lazy to
+// postpone work until the rest of the query has been resolved, for example to
+// let a batch loader collect the keys requested by many fields before any of
+// them is loaded. The executor calls the Lazy once all non-lazy fields have
+// been resolved, and then executes the field's selections on its result.
+type Lazy func() (interface{}, error)
+
+// lazyField is left in the result tree in place of a field whose resolver
+// returned a Lazy.
+type lazyField struct {
+	ctx          context.Context
+	typ          Type
+	lazy         Lazy
+	selectionSet *SelectionSet
+}
+
+// lazySlot is the location of a lazyField in a result tree.
+type lazySlot struct {
+	field *lazyField
+	path  []string
+	set   func(value interface{})
+}
+
+// collectLazyFields appends the lazyFields in value to slots. It does not
+// descend into thunks, whose lazy fields are resolved when they are forked.
+func collectLazyFields(value interface{}, path []string, slots []lazySlot) []lazySlot {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for k, v := range value {
+			k := k
+			path := append(path[:len(path):len(path)], k)
+			if field, ok := v.(*lazyField); ok {
+				slots = append(slots, lazySlot{field: field, path: path, set: func(v interface{}) { value[k] = v }})
+			} else {
+				slots = collectLazyFields(v, path, slots)
+			}
+		}
+
+	case []interface{}:
+		for i, v := range value {
+			i := i
+			path := append(path[:len(path):len(path)], fmt.Sprint(i))
+			if field, ok := v.(*lazyField); ok {
+				slots = append(slots, lazySlot{field: field, path: path, set: func(v interface{}) { value[i] = v }})
+			} else {
+				slots = collectLazyFields(v, path, slots)
+			}
+		}
+	}
+	return slots
+}
+
+// resolveLazy replaces the lazyFields in value with their executed results.
+// Lazy fields are resolved one level at a time, so that all lazy fields
+// produced by one level are called before any of the next level.
+//
+// resolveLazy must be called with e.mu held.
+func (e *Executor) resolveLazy(value interface{}) (interface{}, error) {
+	var slots []lazySlot
+	if field, ok := value.(*lazyField); ok {
+		slots = []lazySlot{{field: field, set: func(v interface{}) { value = v }}}
+	} else {
+		slots = collectLazyFields(value, nil, nil)
+	}
+
+	for len(slots) > 0 {
+		var next []lazySlot
+		for _, slot := range slots {
+			result, err := e.safeCall(slot.field.ctx, slot.field.lazy)
+			if err == nil && !isNull(slot.field.typ, result) {
+				result, err = e.execute(slot.field.ctx, slot.field.typ, result, slot.field.selectionSet)
+			}
+			if err != nil {
+				if e.streamingWriter == nil && !e.timedOut(slot.field.ctx) {
+					return nil, nestPath(slot.path, err)
+				}
+				result = &fieldError{err: err}
+			}
+			slot.set(result)
+			next = collectLazyFields(result, slot.path, next)
+		}
+		slots = next
+	}
+
+	return value, nil
+}
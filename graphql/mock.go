@@ -0,0 +1,149 @@
+package graphql
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// ErrNotImplemented is returned by resolvers of fields that have not been
+// implemented yet. Executors configured with WithMocks resolve such fields
+// with mock data, as they do fields without a Resolve function.
+var ErrNotImplemented = errors.New("not implemented")
+
+// A MockGenerator returns a mock value for a type, for a field selected with
+// selectionSet.
+type MockGenerator func(r *rand.Rand, selectionSet *SelectionSet) interface{}
+
+// MockConfig configures the mock data generated by WithMocks.
+type MockConfig struct {
+	// Seed seeds mock generation. The same seed, schema, and query always
+	// produce the same mock data.
+	Seed int64
+
+	// ListLength is the length of mocked lists. It defaults to 2.
+	ListLength int
+
+	// NullProbability is the probability that a mocked nullable value is
+	// null. Non-null values are never null.
+	NullProbability float64
+
+	// Generators override the mock data of types, by type name, such as
+	// "Time" or "User".
+	Generators map[string]MockGenerator
+}
+
+// WithMocks makes the executor resolve fields that are not implemented with
+// mock data, for developing clients against a schema whose resolvers do not
+// exist yet. A field is not implemented if it has no Resolve function or if
+// its resolver returns ErrNotImplemented. Implemented fields are resolved as
+// usual, and nested fields of a mocked value are always mocked.
+func WithMocks(config MockConfig) ExecutorOption {
+	if config.ListLength == 0 {
+		config.ListLength = 2
+	}
+	return func(e *Executor) {
+		e.mocks = &config
+	}
+}
+
+// mockField returns mock data for the field selected by selection. The data
+// depends only on the seed and the selection, so that mocks are deterministic
+// even when fields are resolved concurrently.
+func (c *MockConfig) mockField(typ Type, selection *Selection) interface{} {
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%s:%s", selection.Name, selection.Alias)
+	r := rand.New(rand.NewSource(c.Seed ^ int64(h.Sum64())))
+	return c.mock(r, typ, selection.SelectionSet, true)
+}
+
+func (c *MockConfig) mock(r *rand.Rand, typ Type, selectionSet *SelectionSet, nullable bool) interface{} {
+	if nonNull, ok := typ.(*NonNull); ok {
+		return c.mock(r, nonNull.Type, selectionSet, false)
+	}
+	if nullable && c.NullProbability > 0 && r.Float64() < c.NullProbability {
+		return nil
+	}
+	if generator, ok := c.Generators[typ.String()]; ok {
+		return generator(r, selectionSet)
+	}
+
+	switch typ := typ.(type) {
+	case *Scalar:
+		return mockScalar(r, typ.Type)
+
+	case *Enum:
+		if len(typ.Values) == 0 {
+			return nil
+		}
+		return typ.Values[r.Intn(len(typ.Values))]
+
+	case *List:
+		items := make([]interface{}, c.ListLength)
+		for i := range items {
+			items[i] = c.mock(r, typ.Type, selectionSet, true)
+		}
+		return items
+
+	case *Object:
+		// Flatten does not preserve the order of selections, so mock them in
+		// order of their aliases.
+		selections := Flatten(selectionSet)
+		sort.Slice(selections, func(i, j int) bool { return selections[i].Alias < selections[j].Alias })
+
+		fields := make(map[string]interface{})
+		for _, selection := range selections {
+			if selection.Name == "__typename" {
+				fields[selection.Alias] = typ.Name
+				continue
+			}
+			field, ok := typ.Fields[selection.Name]
+			if !ok {
+				fields[selection.Alias] = nil
+				continue
+			}
+			fields[selection.Alias] = c.mock(r, field.Type, selection.SelectionSet, true)
+		}
+		return fields
+
+	case *Interface:
+		names := typ.typeNames()
+		if len(names) == 0 {
+			return nil
+		}
+		object := typ.Types[names[r.Intn(len(names))]]
+		return c.mock(r, object, selectionSetFor(typ, object, selectionSet), false)
+
+	default:
+		return nil
+	}
+}
+
+const mockLetters = "abcdefghijklmnopqrstuvwxyz"
+
+// mockScalar returns a mock value for the scalar type name.
+func mockScalar(r *rand.Rand, name string) interface{} {
+	switch name {
+	case "bool":
+		return r.Intn(2) == 0
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64":
+		return r.Intn(100)
+	case "float32", "float64":
+		return float64(r.Intn(10000)) / 100
+	case "Time":
+		return time.Unix(r.Int63n(2000000000), 0).UTC()
+	case "bytes":
+		b := make([]byte, 8)
+		r.Read(b)
+		return b
+	default:
+		b := make([]byte, 8)
+		for i := range b {
+			b[i] = mockLetters[r.Intn(len(mockLetters))]
+		}
+		return string(b)
+	}
+}
@@ -1,7 +1,9 @@
 package graphql
 
 import (
+	"encoding/json"
 	"reflect"
+	"sort"
 	"strconv"
 
 	"github.com/graphql-go/graphql/language/ast"
@@ -12,9 +14,36 @@ import (
 // parser from graphql-go, and stores its output value in a more convenient
 // format.
 
+// DefaultMaxInputDepth is the default limit on how deeply the objects and
+// lists of an argument or variable can be nested.
+const DefaultMaxInputDepth = 64
+
+// WithMaxInputDepth makes the handlers and connections running the executor
+// reject arguments and variables with objects and lists nested more than n
+// levels deep when parsing queries, instead of DefaultMaxInputDepth. A
+// negative n removes the limit.
+func WithMaxInputDepth(n int) ExecutorOption {
+	return func(e *Executor) {
+		e.maxInputDepth = &n
+	}
+}
+
+// inputDepth returns the limit set with WithMaxInputDepth, or
+// DefaultMaxInputDepth.
+func (e *Executor) inputDepth() int {
+	if e.maxInputDepth == nil {
+		return DefaultMaxInputDepth
+	}
+	return *e.maxInputDepth
+}
+
+// errInputTooDeep is returned for arguments nested beyond their limit.
+var errInputTooDeep = NewClientError("input is nested too deeply")
+
 // valueToJson takes a graphql-go ast value and converts it to a value like
-// those generated by json.Unmarshal
-func valueToJson(value ast.Value, vars map[string]interface{}) (interface{}, error) {
+// those generated by json.Unmarshal. Objects and lists can be nested depth
+// levels deep, or without limit if depth is negative.
+func valueToJson(value ast.Value, vars map[string]interface{}, depth int) (interface{}, error) {
 	switch value := value.(type) {
 	case *ast.IntValue:
 		v, err := strconv.ParseInt(value.Value, 10, 64)
@@ -40,15 +69,18 @@ func valueToJson(value ast.Value, vars map[string]interface{}) (interface{}, err
 		if !ok {
 			return nil, nil
 		}
-		return actual, nil
+		return normalizeVariable(actual, depth)
 	case *ast.ObjectValue:
+		if depth == 0 {
+			return nil, errInputTooDeep
+		}
 		obj := make(map[string]interface{})
 		for _, field := range value.Fields {
 			name := field.Name.Value
 			if _, found := obj[name]; found {
 				return nil, NewClientError("duplicate field")
 			}
-			value, err := valueToJson(field.Value, vars)
+			value, err := valueToJson(field.Value, vars, depth-1)
 			if err != nil {
 				return nil, err
 			}
@@ -56,9 +88,12 @@ func valueToJson(value ast.Value, vars map[string]interface{}) (interface{}, err
 		}
 		return obj, nil
 	case *ast.ListValue:
+		if depth == 0 {
+			return nil, errInputTooDeep
+		}
 		list := make([]interface{}, 0, len(value.Values))
 		for _, item := range value.Values {
-			value, err := valueToJson(item, vars)
+			value, err := valueToJson(item, vars, depth-1)
 			if err != nil {
 				return nil, err
 			}
@@ -70,16 +105,83 @@ func valueToJson(value ast.Value, vars map[string]interface{}) (interface{}, err
 	}
 }
 
+// normalizeVariable converts a variable's value to the representation of the
+// same value written inline, so that arguments parse identically either way.
+// Variables passed from Go or decoded with json.Decoder.UseNumber can hold
+// integers and json.Numbers, which are converted to float64 like inline
+// numbers. Objects and lists can be nested depth levels deep, as for
+// valueToJson.
+func normalizeVariable(value interface{}, depth int) (interface{}, error) {
+	switch value := value.(type) {
+	case json.Number:
+		v, err := value.Float64()
+		if err != nil {
+			return nil, NewClientError("bad number variable: %s", err)
+		}
+		return v, nil
+	case int:
+		return float64(value), nil
+	case int8:
+		return float64(value), nil
+	case int16:
+		return float64(value), nil
+	case int32:
+		return float64(value), nil
+	case int64:
+		return float64(value), nil
+	case uint:
+		return float64(value), nil
+	case uint8:
+		return float64(value), nil
+	case uint16:
+		return float64(value), nil
+	case uint32:
+		return float64(value), nil
+	case uint64:
+		return float64(value), nil
+	case float32:
+		return float64(value), nil
+	case map[string]interface{}:
+		if depth == 0 {
+			return nil, errInputTooDeep
+		}
+		obj := make(map[string]interface{}, len(value))
+		for name, field := range value {
+			field, err := normalizeVariable(field, depth-1)
+			if err != nil {
+				return nil, err
+			}
+			obj[name] = field
+		}
+		return obj, nil
+	case []interface{}:
+		if depth == 0 {
+			return nil, errInputTooDeep
+		}
+		list := make([]interface{}, len(value))
+		for i, item := range value {
+			item, err := normalizeVariable(item, depth-1)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = item
+		}
+		return list, nil
+	default:
+		return value, nil
+	}
+}
+
 // argsToJson converts a graphql-go ast argument list to a json.Marshal-style
 // map[string]interface{}
-func argsToJson(input []*ast.Argument, vars map[string]interface{}) (interface{}, error) {
+func argsToJson(input []*ast.Argument, vars map[string]interface{}, depth int) (interface{}, error) {
 	args := make(map[string]interface{})
 	for _, arg := range input {
 		name := arg.Name.Value
 		if _, found := args[name]; found {
 			return nil, NewClientError("duplicate arg")
 		}
-		value, err := valueToJson(arg.Value, vars)
+		value, err := valueToJson(arg.Value, vars, depth)
 		if err != nil {
 			return nil, err
 		}
@@ -88,15 +190,52 @@ func argsToJson(input []*ast.Argument, vars map[string]interface{}) (interface{}
 	return args, nil
 }
 
+// includeSelection returns true unless directives, those of a selection or
+// fragment spread, skip it with @skip(if: true) or @include(if: false), with
+// their conditions bound to vars. Other directives are not supported. Errors
+// are recorded in state, and then ok is false. If state keeps skipped
+// selections, the conditions are only checked when the query is bound.
+func includeSelection(directives []*ast.Directive, vars map[string]interface{}, state *parseState) (include bool, ok bool) {
+	include = true
+	for _, directive := range directives {
+		name := directive.Name.Value
+		if name != "skip" && name != "include" {
+			state.addError(NewClientError("directives not supported"), directive.Loc)
+			return false, false
+		}
+		if len(directive.Arguments) != 1 || directive.Arguments[0].Name.Value != "if" {
+			state.addError(NewClientError(`directive @%s expects a single "if" argument`, name), directive.Loc)
+			return false, false
+		}
+		if state.keepSkipped {
+			continue
+		}
+		value, err := valueToJson(directive.Arguments[0].Value, vars, state.maxInputDepth)
+		condition, isBool := value.(bool)
+		if err != nil || !isBool {
+			state.addError(NewClientError(`directive @%s expects a boolean "if" argument`, name), directive.Loc)
+			return false, false
+		}
+		if condition == (name == "skip") {
+			include = false
+		}
+	}
+	return include, true
+}
+
 // parseSelectionSet takes a grapqhl-go selection set and converts it to a
-// simplified *SelectionSet, bindings vars
-func parseSelectionSet(input *ast.SelectionSet, globalFragments map[string]*Fragment, vars map[string]interface{}) (*SelectionSet, error) {
+// simplified *SelectionSet, bindings vars. Errors are recorded in state, and
+// the selections that caused them are skipped, as are the selections skipped
+// with @skip or @include.
+func parseSelectionSet(input *ast.SelectionSet, globalFragments map[string]*Fragment, vars map[string]interface{}, state *parseState) *SelectionSet {
 	if input == nil {
-		return nil, nil
+		return nil
 	}
 
 	var selections []*Selection
 	var fragments []*Fragment
+	// spreadDirectives are the directives of the fragments spread.
+	var spreadDirectives [][]*ast.Directive
 	for _, selection := range input.Selections {
 		switch selection := selection.(type) {
 		case *ast.Field:
@@ -105,57 +244,62 @@ func parseSelectionSet(input *ast.SelectionSet, globalFragments map[string]*Frag
 				alias = selection.Alias.Value
 			}
 
-			if len(selection.Directives) != 0 {
-				return nil, NewClientError("directives not supported")
-			}
-
-			args, err := argsToJson(selection.Arguments, vars)
-			if err != nil {
-				return nil, err
+			if include, ok := includeSelection(selection.Directives, vars, state); !ok || !include {
+				continue
 			}
 
-			selectionSet, err := parseSelectionSet(selection.SelectionSet, globalFragments, vars)
+			args, err := argsToJson(selection.Arguments, vars, state.maxInputDepth)
 			if err != nil {
-				return nil, err
+				state.addError(err, selection.Loc)
+				continue
 			}
 
-			selections = append(selections, &Selection{
+			parsed := &Selection{
 				Alias:        alias,
 				Name:         selection.Name.Value,
 				Args:         args,
-				SelectionSet: selectionSet,
-			})
+				SelectionSet: parseSelectionSet(selection.SelectionSet, globalFragments, vars, state),
+				loc:          selection.Loc,
+			}
+			state.nodes[parsed] = selection
+			selections = append(selections, parsed)
 
 		case *ast.FragmentSpread:
 			name := selection.Name.Value
 
-			if len(selection.Directives) != 0 {
-				return nil, NewClientError("directives not supported")
+			include, ok := includeSelection(selection.Directives, vars, state)
+			if !ok {
+				continue
 			}
 
 			fragment, found := globalFragments[name]
 			if !found {
-				return nil, NewClientError("unknown fragment")
+				state.addError(NewClientError("unknown fragment"), selection.Loc)
+				continue
+			}
+			if !include {
+				// The fragment is still checked, and not reported as unused.
+				state.skippedFragments = append(state.skippedFragments, fragment)
+				continue
 			}
 
 			fragments = append(fragments, fragment)
+			spreadDirectives = append(spreadDirectives, selection.Directives)
 
 		case *ast.InlineFragment:
 			on := selection.TypeCondition.Name.Value
 
-			if len(selection.Directives) != 0 {
-				return nil, NewClientError("directives not supported")
-			}
-
-			selectionSet, err := parseSelectionSet(selection.SelectionSet, globalFragments, vars)
-			if err != nil {
-				return nil, err
+			if include, ok := includeSelection(selection.Directives, vars, state); !ok || !include {
+				continue
 			}
 
-			fragments = append(fragments, &Fragment{
+			fragment := &Fragment{
 				On:           on,
-				SelectionSet: selectionSet,
-			})
+				SelectionSet: parseSelectionSet(selection.SelectionSet, globalFragments, vars, state),
+			}
+			state.fragments[fragment] = selection.Loc
+			fragments = append(fragments, fragment)
+			spreadDirectives = append(spreadDirectives, selection.Directives)
 		}
 	}
 
@@ -163,7 +307,15 @@ func parseSelectionSet(input *ast.SelectionSet, globalFragments map[string]*Frag
 		Selections: selections,
 		Fragments:  fragments,
 	}
-	return selectionSet, nil
+	if state.keepSkipped {
+		for _, directives := range spreadDirectives {
+			if len(directives) > 0 {
+				state.spreadDirectives[selectionSet] = spreadDirectives
+				break
+			}
+		}
+	}
+	return selectionSet
 }
 
 type visitState int
@@ -176,59 +328,55 @@ const (
 
 // detectCyclesAndUnusedFragments finds cycles in fragments that include
 // eachother as well as fragments that don't appear anywhere
-func detectCyclesAndUnusedFragments(selectionSet *SelectionSet, globalFragments map[string]*Fragment) error {
+func detectCyclesAndUnusedFragments(selectionSet *SelectionSet, globalFragments map[string]*Fragment, parseState *parseState) {
 	state := make(map[*Fragment]visitState)
 
-	var visitFragment func(*Fragment) error
-	var visitSelectionSet func(*SelectionSet) error
+	var visitFragment func(*Fragment)
+	var visitSelectionSet func(*SelectionSet)
 
-	visitSelectionSet = func(selectionSet *SelectionSet) error {
+	visitSelectionSet = func(selectionSet *SelectionSet) {
 		if selectionSet == nil {
-			return nil
+			return
 		}
 
 		for _, selection := range selectionSet.Selections {
-			if err := visitSelectionSet(selection.SelectionSet); err != nil {
-				return err
-			}
+			visitSelectionSet(selection.SelectionSet)
 		}
 
 		for _, fragment := range selectionSet.Fragments {
-			if err := visitFragment(fragment); err != nil {
-				return err
-			}
+			visitFragment(fragment)
 		}
-
-		return nil
 	}
 
-	visitFragment = func(fragment *Fragment) error {
+	visitFragment = func(fragment *Fragment) {
 		switch state[fragment] {
 		case visiting:
-			return NewClientError("fragment contains itself")
+			parseState.addError(NewClientError("fragment contains itself"), parseState.fragments[fragment])
+			return
 		case visited:
-			return nil
+			return
 		}
 
 		state[fragment] = visiting
-		if err := visitSelectionSet(fragment.SelectionSet); err != nil {
-			return err
-		}
+		visitSelectionSet(fragment.SelectionSet)
 		state[fragment] = visited
-
-		return nil
 	}
 
-	if err := visitSelectionSet(selectionSet); err != nil {
-		return err
+	visitSelectionSet(selectionSet)
+	for _, fragment := range parseState.skippedFragments {
+		visitFragment(fragment)
 	}
 
-	for _, fragment := range globalFragments {
-		if state[fragment] != visited {
-			return NewClientError("unused fragment")
+	names := make([]string, 0, len(globalFragments))
+	for name := range globalFragments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if fragment := globalFragments[name]; state[fragment] != visited {
+			parseState.addError(NewClientError("unused fragment"), parseState.fragments[fragment])
 		}
 	}
-	return nil
 }
 
 // detectConflicts finds conflicts
@@ -240,50 +388,80 @@ func detectCyclesAndUnusedFragments(selectionSet *SelectionSet, globalFragments
 //
 // A query cannot contain both selections, because they have the same alias
 // with different source names, and they also have different arguments.
-func detectConflicts(selectionSet *SelectionSet) error {
-	state := make(map[*SelectionSet]visitState)
-
-	var visitChild func(*SelectionSet) error
-	visitChild = func(selectionSet *SelectionSet) error {
-		if state[selectionSet] == visited {
-			return nil
-		}
-		state[selectionSet] = visited
-
-		selections := make(map[string]*Selection)
-
-		var visitSibling func(*SelectionSet) error
-		visitSibling = func(selectionSet *SelectionSet) error {
+//
+// Selections with the same alias are merged, as Flatten does, so their
+// sub-selections are checked together, and conflicts between them are found
+// at any depth.
+func detectConflicts(selectionSet *SelectionSet, parseState *parseState) {
+	reported := make(map[[2]*Selection]bool)
+	// expanding holds the fragments spread on the path to the selection sets
+	// being visited, so that cycles, which are reported by
+	// detectCyclesAndUnusedFragments, terminate.
+	expanding := make(map[*Fragment]bool)
+
+	// visit checks the selection sets merged into one object, and then the
+	// merged sub-selections of each of their aliases.
+	var visit func([]*SelectionSet)
+	visit = func(selectionSets []*SelectionSet) {
+		var aliases []string
+		grouped := make(map[string][]*Selection)
+		var expanded []*Fragment
+
+		var collect func(*SelectionSet)
+		collect = func(selectionSet *SelectionSet) {
 			for _, selection := range selectionSet.Selections {
-				if other, found := selections[selection.Alias]; found {
-					if other.Name != selection.Name {
-						return NewClientError("same alias with different name")
-					}
-					if !reflect.DeepEqual(other.Args, selection.Args) {
-						return NewClientError("same alias with different args")
-					}
-				} else {
-					selections[selection.Alias] = selection
+				if _, ok := grouped[selection.Alias]; !ok {
+					aliases = append(aliases, selection.Alias)
 				}
+				grouped[selection.Alias] = append(grouped[selection.Alias], selection)
 			}
-
 			for _, fragment := range selectionSet.Fragments {
-				if err := visitSibling(fragment.SelectionSet); err != nil {
-					return err
+				if !expanding[fragment] {
+					expanding[fragment] = true
+					expanded = append(expanded, fragment)
+					collect(fragment.SelectionSet)
 				}
 			}
-
-			return nil
 		}
+		for _, selectionSet := range selectionSets {
+			collect(selectionSet)
+		}
+
+		for _, alias := range aliases {
+			selections := grouped[alias]
+			first := selections[0]
+			for _, selection := range selections[1:] {
+				pair := [2]*Selection{first, selection}
+				if reported[pair] {
+					continue
+				}
+				locs := []*ast.Location{first.loc, selection.loc}
+				if first.Name != selection.Name {
+					reported[pair] = true
+					parseState.addError(NewClientError("same alias with different name"), locs...)
+				} else if !reflect.DeepEqual(first.Args, selection.Args) {
+					reported[pair] = true
+					parseState.addError(NewClientError("same alias with different args"), locs...)
+				}
+			}
 
-		if err := visitSibling(selectionSet); err != nil {
-			return err
+			var children []*SelectionSet
+			for _, selection := range selections {
+				if selection.SelectionSet != nil {
+					children = append(children, selection.SelectionSet)
+				}
+			}
+			if len(children) > 0 {
+				visit(children)
+			}
 		}
 
-		return nil
+		for _, fragment := range expanded {
+			delete(expanding, fragment)
+		}
 	}
 
-	return visitChild(selectionSet)
+	visit([]*SelectionSet{selectionSet})
 }
 
 type Query struct {
@@ -298,12 +476,22 @@ type Query struct {
 // contains no cycles or unused fragments or immediate conflicts. However, it
 // does not validate that the query is legal under a given schema, which
 // instead is done by PrepareQuery.
+//
+// Parse reports all the errors it finds, rather than only the first, as
+// QueryErrors located in source. A syntax error stops parsing, so it is
+// reported alone. Arguments and variables can nest objects and lists up to
+// DefaultMaxInputDepth levels deep.
 func Parse(source string, vars map[string]interface{}) (*Query, error) {
 	document, err := parser.Parse(parser.ParseParams{Source: source})
 	if err != nil {
-		return nil, NewClientError(err.Error())
+		return nil, syntaxError(err)
 	}
+	return parseDocument(document, vars, newParseState(DefaultMaxInputDepth))
+}
 
+// parseDocument converts a graphql-go document to a *Query, binding vars.
+// Errors and the nodes of the selections are recorded in state.
+func parseDocument(document *ast.Document, vars map[string]interface{}, state *parseState) (*Query, error) {
 	var queryDefinition *ast.OperationDefinition
 	fragmentDefinitions := make(map[string]*ast.FragmentDefinition)
 
@@ -312,26 +500,32 @@ func Parse(source string, vars map[string]interface{}) (*Query, error) {
 		case *ast.FragmentDefinition:
 			name := definition.Name.Value
 			if _, found := fragmentDefinitions[name]; found {
-				return nil, NewClientError("duplicate fragment")
+				state.addError(NewClientError("duplicate fragment"), definition.Loc)
+				continue
 			}
 			fragmentDefinitions[name] = definition
 
 		case *ast.OperationDefinition:
 			if definition.Operation != "query" && definition.Operation != "mutation" {
-				return nil, NewClientError("only support queries or mutations")
+				state.addError(NewClientError("only support queries or mutations"), definition.Loc)
+				continue
 			}
 			if queryDefinition != nil {
-				return nil, NewClientError("only support a single query")
+				state.addError(NewClientError("only support a single query"), definition.Loc)
+				continue
 			}
 			queryDefinition = definition
 
 		default:
-			return nil, NewClientError("unsupported definition")
+			state.addError(NewClientError("unsupported definition"), definition.GetLoc())
 		}
 	}
 
 	if queryDefinition == nil {
-		return nil, NewClientError("must have a single query")
+		if len(state.errors) == 0 {
+			state.addError(NewClientError("must have a single query"))
+		}
+		return nil, state.errors
 	}
 
 	kind := queryDefinition.Operation
@@ -346,14 +540,51 @@ func Parse(source string, vars map[string]interface{}) (*Query, error) {
 		SelectionSet: nil,
 	}
 
-	// Parse variable definitions, default values, etc.
+	vars = defaultVariables(queryDefinition, vars, state)
+
+	globalFragments := make(map[string]*Fragment)
+	for name, definition := range fragmentDefinitions {
+		fragment := &Fragment{
+			On: definition.TypeCondition.Name.Value,
+		}
+		globalFragments[name] = fragment
+		state.fragments[fragment] = definition.Loc
+	}
+
+	// Parse fragments in order of their names, so that errors are reported
+	// in a stable order.
+	names := make([]string, 0, len(fragmentDefinitions))
+	for name := range fragmentDefinitions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		globalFragments[name].SelectionSet = parseSelectionSet(fragmentDefinitions[name].SelectionSet, globalFragments, vars, state)
+	}
+
+	selectionSet := parseSelectionSet(queryDefinition.SelectionSet, globalFragments, vars, state)
+	detectCyclesAndUnusedFragments(selectionSet, globalFragments, state)
+	detectConflicts(selectionSet, state)
+
+	if len(state.errors) > 0 {
+		return rv, state.errors
+	}
+
+	rv.SelectionSet = selectionSet
+
+	return rv, nil
+}
+
+// defaultVariables returns vars with the default values of the variables of
+// definition that are not set. Errors are recorded in state.
+func defaultVariables(definition *ast.OperationDefinition, vars map[string]interface{}, state *parseState) map[string]interface{} {
 	var defaultedVars map[string]interface{}
-	for _, variableDefinition := range queryDefinition.VariableDefinitions {
+	for _, variableDefinition := range definition.VariableDefinitions {
 		name := variableDefinition.Variable.Name.Value
 
 		if _, ok := variableDefinition.Type.(*ast.NonNull); ok {
 			if variableDefinition.DefaultValue != nil {
-				return rv, NewClientError("required variable cannot provide a default value: $%s", name)
+				state.addError(NewClientError("required variable cannot provide a default value: $%s", name), variableDefinition.DefaultValue.GetLoc())
 			}
 
 			continue
@@ -375,9 +606,10 @@ func Parse(source string, vars map[string]interface{}) (*Query, error) {
 
 			// TODO: properly implement coerceValue.
 			// See: https://github.com/graphql/graphql-js/blob/17a0bfd5292f39cafe4eec5b3bd0e22514243b68/src/execution/values.js#L84
-			val, err := valueToJson(variableDefinition.DefaultValue, nil)
+			val, err := valueToJson(variableDefinition.DefaultValue, nil, state.maxInputDepth)
 			if err != nil {
-				return rv, NewClientError("failed to parse default value: %s", err.Error())
+				state.addError(NewClientError("failed to parse default value: %s", err.Error()), variableDefinition.DefaultValue.GetLoc())
+				continue
 			}
 
 			defaultedVars[name] = val
@@ -385,40 +617,9 @@ func Parse(source string, vars map[string]interface{}) (*Query, error) {
 	}
 
 	if defaultedVars != nil {
-		vars = defaultedVars
-	}
-
-	globalFragments := make(map[string]*Fragment)
-	for name, fragment := range fragmentDefinitions {
-		globalFragments[name] = &Fragment{
-			On: fragment.TypeCondition.Name.Value,
-		}
+		return defaultedVars
 	}
-
-	for name, fragment := range fragmentDefinitions {
-		selectionSet, err := parseSelectionSet(fragment.SelectionSet, globalFragments, vars)
-		if err != nil {
-			return rv, err
-		}
-		globalFragments[name].SelectionSet = selectionSet
-	}
-
-	selectionSet, err := parseSelectionSet(queryDefinition.SelectionSet, globalFragments, vars)
-	if err != nil {
-		return rv, err
-	}
-
-	if err := detectCyclesAndUnusedFragments(selectionSet, globalFragments); err != nil {
-		return rv, err
-	}
-
-	if err := detectConflicts(selectionSet); err != nil {
-		return rv, err
-	}
-
-	rv.SelectionSet = selectionSet
-
-	return rv, nil
+	return vars
 }
 
 func MustParse(source string, vars map[string]interface{}) *Query {
@@ -447,8 +648,11 @@ func MustParse(source string, vars map[string]interface{}) *Query {
 //     groups: { name name id { widgets { name } } }
 //
 // Flatten does _not_ flatten out the inner queries, so the name above does not
-// get flattened out yet.
+// get flattened out yet. Selections are returned in the order their aliases
+// first appear, with the selections of fragments following those they are
+// spread next to.
 func Flatten(selectionSet *SelectionSet) []*Selection {
+	var aliases []string
 	grouped := make(map[string][]*Selection)
 
 	state := make(map[*SelectionSet]visitState)
@@ -459,6 +663,9 @@ func Flatten(selectionSet *SelectionSet) []*Selection {
 		}
 
 		for _, selection := range selectionSet.Selections {
+			if _, ok := grouped[selection.Alias]; !ok {
+				aliases = append(aliases, selection.Alias)
+			}
 			grouped[selection.Alias] = append(grouped[selection.Alias], selection)
 		}
 		for _, fragment := range selectionSet.Fragments {
@@ -471,7 +678,8 @@ func Flatten(selectionSet *SelectionSet) []*Selection {
 	visit(selectionSet)
 
 	var flattened []*Selection
-	for _, selections := range grouped {
+	for _, alias := range aliases {
+		selections := grouped[alias]
 		if len(selections) == 1 || selections[0].SelectionSet == nil {
 			flattened = append(flattened, selections[0])
 			continue
@@ -488,6 +696,7 @@ func Flatten(selectionSet *SelectionSet) []*Selection {
 			Alias:        selections[0].Alias,
 			Args:         selections[0].Args,
 			SelectionSet: merged,
+			loc:          selections[0].loc,
 		})
 	}
 
@@ -1,7 +1,10 @@
 package graphql_test
 
 import (
+	"encoding/json"
+	"errors"
 	"reflect"
+	"strings"
 	"testing"
 
 	. "github.com/samsarahq/thunder/graphql"
@@ -128,6 +131,7 @@ fragment Bar on Foo {
 		},
 	}
 
+	ClearLocations(query.SelectionSet)
 	if !reflect.DeepEqual(query, expected) {
 		t.Error("unexpected parse")
 	}
@@ -156,6 +160,7 @@ mutation foo($var: bar) {
 			},
 		},
 	}
+	ClearLocations(query.SelectionSet)
 	if !reflect.DeepEqual(query, expected) {
 		t.Error("unexpected parse")
 	}
@@ -208,6 +213,39 @@ func TestParseUnsupported(t *testing.T) {
 		t.Error("expected different names in fragment to fail", err)
 	}
 
+	_, err = Parse(`
+{
+	a { b(x: 1) }
+	a { b(x: 2) }
+}`, map[string]interface{}{})
+	if err == nil || err.Error() != "same alias with different args" {
+		t.Error("expected different args in merged selections to fail", err)
+	}
+
+	_, err = Parse(`
+{
+	a { ...Frag }
+	... on Foo { a { b: c } }
+}
+fragment Frag on A {
+	b: b
+}`, map[string]interface{}{})
+	if err == nil || err.Error() != "same alias with different name" {
+		t.Error("expected different names in merged fragments to fail", err)
+	}
+
+	_, err = Parse(`
+{
+	a { b { c: c } }
+	a { b { c: d } ...Frag }
+}
+fragment Frag on A {
+	b { c: e }
+}`, map[string]interface{}{})
+	if err == nil || err.Error() != "same alias with different name\nsame alias with different name" {
+		t.Error("expected each deep conflict to be reported once", err)
+	}
+
 	_, err = Parse(`
 {
 	a @test
@@ -247,6 +285,74 @@ fragment foo on Foo {
 	}
 }
 
+func TestParseErrorLocations(t *testing.T) {
+	_, err := Parse(`
+{
+	a: a
+	a: b
+	c @test
+	... missing
+}
+fragment unused on Foo {
+	x
+}`, map[string]interface{}{})
+
+	expected := QueryErrors{
+		{Message: "directives not supported", Locations: []Location{{Line: 5, Column: 4}}},
+		{Message: "unknown fragment", Locations: []Location{{Line: 6, Column: 2}}},
+		{Message: "unused fragment", Locations: []Location{{Line: 8, Column: 1}}},
+		{Message: "same alias with different name", Locations: []Location{{Line: 3, Column: 2}, {Line: 4, Column: 2}}},
+	}
+	if !reflect.DeepEqual(err, expected) {
+		t.Errorf("expected all errors with locations, but received %#v", err)
+	}
+	if _, ok := err.(SanitizedError); !ok {
+		t.Error("expected query errors to be sanitized")
+	}
+
+	_, err = Parse(`{ a(x: 1) }}`, map[string]interface{}{})
+	queryErrors, ok := err.(QueryErrors)
+	if !ok || len(queryErrors) != 1 || !reflect.DeepEqual(queryErrors[0].Locations, []Location{{Line: 1, Column: 12}}) {
+		t.Errorf("expected located syntax error, but received %#v", err)
+	}
+}
+
+func TestPrepareQueryErrorLocations(t *testing.T) {
+	schema := &Object{
+		Name: "Query",
+		Fields: map[string]*Field{
+			"number": {
+				Type: &Scalar{Type: "int64"},
+				ParseArguments: func(json interface{}) (interface{}, error) {
+					if len(json.(map[string]interface{})) != 0 {
+						return nil, errors.New("no args expected")
+					}
+					return nil, nil
+				},
+			},
+		},
+	}
+	query := MustParse(`
+{
+	number(x: 1)
+	unknown
+	scalar: number { value }
+	... on Query {
+		missing
+	}
+}`, nil)
+
+	expected := QueryErrors{
+		{Message: `error parsing args for "number": no args expected`, Locations: []Location{{Line: 3, Column: 2}}},
+		{Message: `unknown field "unknown"`, Locations: []Location{{Line: 4, Column: 2}}},
+		{Message: "scalar field must have no selections", Locations: []Location{{Line: 5, Column: 2}}},
+		{Message: `unknown field "missing"`, Locations: []Location{{Line: 7, Column: 3}}},
+	}
+	if err := PrepareQuery(schema, query.SelectionSet); !reflect.DeepEqual(err, expected) {
+		t.Errorf("expected all errors with locations, but received %#v", err)
+	}
+}
+
 func TestParseRequiredVariableDefinitionWithDefaultValue(t *testing.T) {
 	// Expect required variables to be provided.
 	_, err := Parse(`
@@ -259,6 +365,48 @@ query Operation($x: int64! = 2) {
 	}
 }
 
+func TestParseVariablesLikeLiterals(t *testing.T) {
+	source := `query Q($a: int64, $b: float64, $c: Filter) { field(a: $a, b: $b, c: $c) }`
+	query, err := Parse(source, map[string]interface{}{
+		"a": 2,
+		"b": json.Number("1.5"),
+		"c": map[string]interface{}{"ids": []interface{}{int64(3), uint8(4)}, "name": "x"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	literal, err := Parse(`{ field(a: 2, b: 1.5, c: {ids: [3, 4], name: "x"}) }`, map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(query.Selections[0].Args, literal.Selections[0].Args) {
+		t.Errorf("expected variables to match literals, but received %v and %v", query.Selections[0].Args, literal.Selections[0].Args)
+	}
+}
+
+func TestParseMaxInputDepth(t *testing.T) {
+	nested := func(depth int) string {
+		return strings.Repeat("[", depth) + strings.Repeat("]", depth)
+	}
+
+	if _, err := Parse(`{ field(a: `+nested(DefaultMaxInputDepth)+`) }`, map[string]interface{}{}); err != nil {
+		t.Errorf("expected input at the limit to parse, but got %v", err)
+	}
+	if _, err := Parse(`{ field(a: `+nested(DefaultMaxInputDepth+1)+`) }`, map[string]interface{}{}); err == nil || err.Error() != "input is nested too deeply" {
+		t.Errorf("expected input past the limit to fail, but got %v", err)
+	}
+
+	var value interface{} = []interface{}{}
+	for i := 1; i < DefaultMaxInputDepth; i++ {
+		value = map[string]interface{}{"a": value}
+	}
+	// The variable is nested one level inside the argument.
+	source := `query Q($a: Filter) { field(a: {b: $a}) }`
+	if _, err := Parse(source, map[string]interface{}{"a": value}); err == nil || err.Error() != "input is nested too deeply" {
+		t.Errorf("expected variable past the limit to fail, but got %v", err)
+	}
+}
+
 func TestParseFillInDefaultValues(t *testing.T) {
 	// Fill in default values when provided.
 	query, err := Parse(`
@@ -280,3 +428,137 @@ query Operation($x: int64 = 2) {
 		t.Errorf("expected 2, received %v", val)
 	}
 }
+
+func TestParseSkipAndInclude(t *testing.T) {
+	query, err := Parse(`
+query Operation($yes: Boolean!) {
+	a @skip(if: true)
+	b @skip(if: false)
+	c @include(if: $yes)
+	d @include(if: $yes) @skip(if: $yes)
+	... on Foo @skip(if: $yes) {
+		e
+	}
+	... Frag @include(if: $yes)
+	...Skipped @skip(if: true)
+}
+fragment Frag on Foo {
+	f
+}
+fragment Skipped on Foo {
+	g
+}`, map[string]interface{}{"yes": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, selection := range Flatten(query.SelectionSet) {
+		names = append(names, selection.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"b", "c", "f"}) {
+		t.Errorf("expected b, c and f to be included, but received %v", names)
+	}
+
+	for _, source := range []string{
+		`{ a @skip }`,
+		`{ a @skip(unless: true) }`,
+		`{ a @include(if: 1) }`,
+		`query Q($x: Boolean) { a @include(if: $x) }`,
+	} {
+		if _, err := Parse(source, nil); err == nil || !strings.Contains(err.Error(), `"if" argument`) {
+			t.Errorf("expected %s to fail with an if argument error, but received %v", source, err)
+		}
+	}
+}
+
+func TestQueryCache(t *testing.T) {
+	makeSchema := func() *Object {
+		return &Object{
+			Name: "Query",
+			Fields: map[string]*Field{
+				"mirror": {
+					Type: &Scalar{Type: "int64"},
+					ParseArguments: func(json interface{}) (interface{}, error) {
+						return json, nil
+					},
+				},
+			},
+		}
+	}
+	schema := makeSchema()
+	cache := NewQueryCache(1)
+
+	first, err := cache.Prepare(schema, `{ mirror(value: 1) }`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Selections[0].Args.(map[string]interface{})["value"] = float64(100)
+	again, err := cache.Prepare(schema, `{ mirror(value: 1) }`, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again == first || again.Selections[0] == first.Selections[0] {
+		t.Error("expected each request to receive its own copy of the query")
+	}
+	if args := again.Selections[0].Args; !reflect.DeepEqual(args, map[string]interface{}{"value": float64(1)}) {
+		t.Errorf("expected fresh args, but received %v", args)
+	}
+	if _, err := cache.Prepare(makeSchema(), `{ mirror(value: 1) }`, nil); err != nil {
+		t.Error(err)
+	}
+
+	source := `query Q($value: int64 = 5) { mirror(value: $value) ... on Query { alias: mirror(value: $value) } }`
+	var queries []*Query
+	for i, value := range []interface{}{float64(2), 3, nil} {
+		query, err := cache.Prepare(schema, source, map[string]interface{}{"value": value})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := map[string]interface{}{"value": []float64{2, 3, 5}[i]}
+		if args := query.Selections[0].Args; !reflect.DeepEqual(args, want) {
+			t.Errorf("expected variables to be bound, but received %v", args)
+		}
+		if args := query.Fragments[0].SelectionSet.Selections[0].Args; !reflect.DeepEqual(args, want) {
+			t.Errorf("expected variables to be bound in fragments, but received %v", args)
+		}
+		queries = append(queries, query)
+	}
+	if queries[0].Fragments[0] == queries[1].Fragments[0] {
+		t.Error("expected fragments to be copied")
+	}
+
+	// A cached query is not validated again, so a field removed from the
+	// schema it was prepared against is still served until it is purged.
+	delete(schema.Fields, "mirror")
+	if _, err := cache.Prepare(schema, source, map[string]interface{}{"value": 4}); err != nil {
+		t.Errorf("expected cached query not to be validated again, but received %v", err)
+	}
+	cache.Purge()
+	if _, err := cache.Prepare(schema, source, map[string]interface{}{"value": 4}); err == nil {
+		t.Error("expected purged query to be validated again")
+	}
+	schema = makeSchema()
+
+	// Skipped selections are validated when the query is cached, and skipped
+	// with the variables of each request.
+	source = `query Q($skip: Boolean!) { a: mirror(value: 1) @skip(if: $skip) ... on Query @include(if: $skip) { b: mirror(value: 2) } }`
+	for _, skip := range []bool{true, false, true} {
+		query, err := cache.Prepare(schema, source, map[string]interface{}{"skip": skip})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if skip && (len(query.Selections) != 0 || len(query.Fragments) != 1) {
+			t.Errorf("expected a to be skipped, but received %v", query.SelectionSet)
+		}
+		if !skip && (len(query.Selections) != 1 || len(query.Fragments) != 0) {
+			t.Errorf("expected the fragment to be skipped, but received %v", query.SelectionSet)
+		}
+	}
+	if _, err := cache.Prepare(schema, `{ unknown @skip(if: true) }`, nil); err == nil || err.Error() != `unknown field "unknown"` {
+		t.Errorf("expected skipped unknown field error, but received %v", err)
+	}
+
+	if _, err := cache.Prepare(schema, `{ unknown }`, nil); err == nil || err.Error() != `unknown field "unknown"` {
+		t.Errorf("expected unknown field error, but received %v", err)
+	}
+}
@@ -0,0 +1,220 @@
+package graphql
+
+import (
+	"container/list"
+	"sync"
+
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+)
+
+// A QueryCache caches parsed queries for Prepare, so that operations that are
+// served repeatedly skip parsing and validation. It holds a bounded number of
+// queries and evicts the least recently used. A QueryCache is safe for
+// concurrent use, and can be shared by the handlers serving a schema.
+type QueryCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[queryCacheKey]*list.Element
+}
+
+type queryCacheKey struct {
+	typ           Type
+	source        string
+	maxInputDepth int
+}
+
+type queryCacheEntry struct {
+	key queryCacheKey
+	// operation is the operation of the query, whose variables are defaulted
+	// for each request.
+	operation *ast.OperationDefinition
+	// prepared is the query parsed and prepared with the variables of the
+	// request that cached it. It is never returned, but bound again to the
+	// variables of each request, from the arguments and directives of the
+	// fields in nodes and the directives of the fragments in spreadDirectives.
+	// It keeps the selections skipped with @skip or @include, which are
+	// skipped when it is bound.
+	prepared         *Query
+	nodes            map[*Selection]*ast.Field
+	spreadDirectives map[*SelectionSet][][]*ast.Directive
+}
+
+// NewQueryCache creates a QueryCache holding up to size queries.
+func NewQueryCache(size int) *QueryCache {
+	return &QueryCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[queryCacheKey]*list.Element),
+	}
+}
+
+// Prepare parses source with vars, like Parse, and prepares it against typ,
+// like PrepareQuery. Like Parse, it can return the query along with an error
+// from preparing it.
+//
+// Queries are cached by typ and source, so that a schema swapped for another
+// never reuses the queries of the old one. A cached query is validated once,
+// and each call returns a copy of its selections with the arguments parsed
+// again from vars, so queries can be executed and modified concurrently.
+func (c *QueryCache) Prepare(typ Type, source string, vars map[string]interface{}) (*Query, error) {
+	return c.prepare(typ, source, vars, DefaultMaxInputDepth)
+}
+
+// prepare is Prepare with arguments nested up to maxInputDepth levels deep.
+func (c *QueryCache) prepare(typ Type, source string, vars map[string]interface{}, maxInputDepth int) (*Query, error) {
+	key := queryCacheKey{typ: typ, source: source, maxInputDepth: maxInputDepth}
+	if entry := c.get(key); entry != nil {
+		return entry.bind(vars, maxInputDepth)
+	}
+
+	document, err := parser.Parse(parser.ParseParams{Source: source})
+	if err != nil {
+		return nil, syntaxError(err)
+	}
+	state := newParseState(maxInputDepth)
+	state.keepSkipped = true
+	query, err := parseDocument(document, vars, state)
+	if err != nil {
+		return nil, err
+	}
+	if err := PrepareQuery(typ, query.SelectionSet); err != nil {
+		return query, err
+	}
+
+	entry := &queryCacheEntry{key: key, prepared: query, nodes: state.nodes, spreadDirectives: state.spreadDirectives}
+	for _, definition := range document.Definitions {
+		if operation, ok := definition.(*ast.OperationDefinition); ok {
+			entry.operation = operation
+		}
+	}
+	c.add(entry)
+	return entry.bind(vars, maxInputDepth)
+}
+
+// bind returns a copy of the prepared query with the arguments of its
+// selections bound to vars and parsed again, and the selections skipped with
+// @skip or @include removed, as Parse and PrepareQuery would for the same
+// source.
+func (e *queryCacheEntry) bind(vars map[string]interface{}, maxInputDepth int) (*Query, error) {
+	state := newParseState(maxInputDepth)
+	vars = defaultVariables(e.operation, vars, state)
+
+	var selections []*Selection
+	fragments := make(map[*Fragment]*Fragment)
+	var bind func(*SelectionSet) *SelectionSet
+	bind = func(selectionSet *SelectionSet) *SelectionSet {
+		if selectionSet == nil {
+			return nil
+		}
+		bound := &SelectionSet{}
+		for _, selection := range selectionSet.Selections {
+			copied := *selection
+			if node, ok := e.nodes[selection]; ok {
+				if include, ok := includeSelection(node.Directives, vars, state); !ok || !include {
+					continue
+				}
+				args, err := argsToJson(node.Arguments, vars, maxInputDepth)
+				if err != nil {
+					state.addError(err, node.Loc)
+					continue
+				}
+				copied.Args = args
+				state.nodes[&copied] = node
+			}
+			copied.SelectionSet = bind(selection.SelectionSet)
+			bound.Selections = append(bound.Selections, &copied)
+			selections = append(selections, &copied)
+		}
+		for i, fragment := range selectionSet.Fragments {
+			if directives := e.spreadDirectives[selectionSet]; directives != nil {
+				if include, ok := includeSelection(directives[i], vars, state); !ok || !include {
+					continue
+				}
+			}
+			copied, ok := fragments[fragment]
+			if !ok {
+				copied = &Fragment{On: fragment.On}
+				fragments[fragment] = copied
+				copied.SelectionSet = bind(fragment.SelectionSet)
+			}
+			bound.Fragments = append(bound.Fragments, copied)
+		}
+		return bound
+	}
+	selectionSet := bind(e.prepared.SelectionSet)
+	detectConflicts(selectionSet, state)
+	if len(state.errors) > 0 {
+		return nil, state.errors
+	}
+
+	for _, selection := range selections {
+		if state.nodes[selection] == nil || selection.parseArguments == nil {
+			continue
+		}
+		parsed, err := selection.parseArguments(selection.Args)
+		if err != nil {
+			state.addError(NewClientError(`error parsing args for "%s": %s`, selection.Name, err), selection.loc)
+			continue
+		}
+		selection.Args = parsed
+	}
+	if len(state.errors) > 0 {
+		return nil, state.errors
+	}
+
+	return &Query{Name: e.prepared.Name, Kind: e.prepared.Kind, SelectionSet: selectionSet}, nil
+}
+
+// Purge removes all queries from the cache.
+func (c *QueryCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	c.entries = make(map[queryCacheKey]*list.Element)
+}
+
+func (c *QueryCache) get(key queryCacheKey) *queryCacheEntry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*queryCacheEntry)
+}
+
+func (c *QueryCache) add(entry *queryCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[entry.key]; ok {
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[entry.key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*queryCacheEntry).key)
+	}
+}
+
+// parseAndPrepare parses source with vars and prepares it against typ, with
+// cache if it is not nil. Arguments can be nested maxInputDepth levels deep.
+// Like Parse, it can return the query along with an error.
+func parseAndPrepare(cache *QueryCache, typ Type, source string, vars map[string]interface{}, maxInputDepth int) (*Query, error) {
+	if cache != nil {
+		return cache.prepare(typ, source, vars, maxInputDepth)
+	}
+	document, err := parser.Parse(parser.ParseParams{Source: source})
+	if err != nil {
+		return nil, syntaxError(err)
+	}
+	query, err := parseDocument(document, vars, newParseState(maxInputDepth))
+	if err != nil {
+		return query, err
+	}
+	return query, PrepareQuery(typ, query.SelectionSet)
+}
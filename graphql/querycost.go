@@ -0,0 +1,116 @@
+package graphql
+
+import (
+	"math"
+	"strings"
+)
+
+// WithMaxDepth makes Execute reject queries that nest fields more than n
+// deep, such as { a { b { c } } } of depth 3, with a "query too deep" error,
+// before any field is resolved. Introspection fields, whose names start with
+// "__", are not counted.
+func WithMaxDepth(n int) ExecutorOption {
+	return func(e *Executor) {
+		e.maxDepth = n
+	}
+}
+
+// WithMaxCost makes Execute reject queries whose estimated cost exceeds n
+// with a "query too expensive" error, before any field is resolved, to protect
+// public endpoints from queries that are cheap to send but expensive to
+// serve. A field costs its Field.Cost, or 1 without one, plus the cost of its
+// selections, multiplied by its Field.CostMultiplier for fields returning many
+// values, such as the page size of a paginated field. Introspection fields,
+// whose names start with "__", are free.
+func WithMaxCost(n int) ExecutorOption {
+	return func(e *Executor) {
+		e.maxCost = n
+	}
+}
+
+// checkQueryCost returns an error if selectionSet on typ is deeper or more
+// expensive than the executor allows.
+func (e *Executor) checkQueryCost(typ Type, selectionSet *SelectionSet) error {
+	if e.maxDepth <= 0 && e.maxCost <= 0 {
+		return nil
+	}
+	depth, cost := queryCost(typ, selectionSet)
+	if e.maxDepth > 0 && depth > e.maxDepth {
+		return NewClientError("query too deep: depth %d exceeds the limit of %d", depth, e.maxDepth)
+	}
+	if e.maxCost > 0 && cost > e.maxCost {
+		return NewClientError("query too expensive: cost %d exceeds the limit of %d", cost, e.maxCost)
+	}
+	return nil
+}
+
+// queryCost returns the depth and estimated cost of the prepared selectionSet
+// on typ. The selections of an interface cost as much as those of its most
+// expensive object.
+func queryCost(typ Type, selectionSet *SelectionSet) (depth, cost int) {
+	if selectionSet == nil {
+		return 0, 0
+	}
+	switch typ := typ.(type) {
+	case *Object:
+		for _, selection := range Flatten(selectionSet) {
+			field, ok := typ.Fields[selection.Name]
+			if !ok || strings.HasPrefix(selection.Name, "__") {
+				continue
+			}
+			fieldDepth, fieldCost := queryCost(field.Type, selection.SelectionSet)
+			if field.CostMultiplier != nil {
+				fieldCost = mulCost(fieldCost, field.CostMultiplier(selection.Args))
+			}
+			if field.Cost != nil {
+				fieldCost = addCost(fieldCost, field.Cost(selection.Args))
+			} else {
+				fieldCost = addCost(fieldCost, 1)
+			}
+			if fieldDepth+1 > depth {
+				depth = fieldDepth + 1
+			}
+			cost = addCost(cost, fieldCost)
+		}
+	case *Interface:
+		for _, name := range typ.typeNames() {
+			object := typ.Types[name]
+			objectDepth, objectCost := queryCost(object, selectionSetFor(typ, object, selectionSet))
+			if objectDepth > depth {
+				depth = objectDepth
+			}
+			if objectCost > cost {
+				cost = objectCost
+			}
+		}
+	case *List:
+		return queryCost(typ.Type, selectionSet)
+	case *NonNull:
+		return queryCost(typ.Type, selectionSet)
+	}
+	return depth, cost
+}
+
+// addCost returns a + b for non-negative costs, saturating instead of
+// overflowing.
+func addCost(a, b int) int {
+	if b < 0 {
+		b = 0
+	}
+	if a > math.MaxInt32-b {
+		return math.MaxInt32
+	}
+	return a + b
+}
+
+// mulCost returns a * b for non-negative costs, saturating instead of
+// overflowing.
+func mulCost(a, b int) int {
+	if b < 0 {
+		b = 0
+	}
+	if b != 0 && a > math.MaxInt32/b {
+		return math.MaxInt32
+	}
+	return a * b
+}
@@ -0,0 +1,100 @@
+package graphql
+
+import (
+	"strings"
+
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/location"
+)
+
+// A Location is a position in the text of a query. Lines and columns are
+// counted from 1.
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// A QueryError is an error in a query, located at the tokens that caused it.
+type QueryError struct {
+	Message   string     `json:"message"`
+	Locations []Location `json:"locations,omitempty"`
+}
+
+func (e *QueryError) Error() string {
+	return e.Message
+}
+
+// QueryErrors are the errors found by Parse and PrepareQuery in a query, which
+// report every error they can find at once, rather than only the first.
+// QueryErrors are client errors, and their message is the messages of the
+// errors joined by newlines.
+type QueryErrors []*QueryError
+
+func (e QueryErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Message
+	}
+	return strings.Join(messages, "\n")
+}
+
+func (e QueryErrors) SanitizedError() string {
+	return e.Error()
+}
+
+// parseState collects the errors found while parsing or preparing a query,
+// along with the locations of the fragments that errors point at.
+type parseState struct {
+	errors    QueryErrors
+	fragments map[*Fragment]*ast.Location
+	// nodes are the fields of the query the selections were parsed from.
+	nodes map[*Selection]*ast.Field
+
+	// keepSkipped keeps the selections and fragments skipped with @skip or
+	// @include, for a cached query, which records the directives of the
+	// fragments it spreads by selection set in spreadDirectives.
+	keepSkipped      bool
+	spreadDirectives map[*SelectionSet][][]*ast.Directive
+	// skippedFragments are the named fragments whose spreads were skipped.
+	skippedFragments []*Fragment
+
+	// maxInputDepth limits the nesting of argument values, as for
+	// valueToJson.
+	maxInputDepth int
+}
+
+func newParseState(maxInputDepth int) *parseState {
+	return &parseState{
+		fragments:        make(map[*Fragment]*ast.Location),
+		nodes:            make(map[*Selection]*ast.Field),
+		spreadDirectives: make(map[*SelectionSet][][]*ast.Directive),
+		maxInputDepth:    maxInputDepth,
+	}
+}
+
+// addError records err, located at locs. Locations that are unknown, such as
+// those of fragments added by the query's caller, are skipped.
+func (s *parseState) addError(err error, locs ...*ast.Location) {
+	queryErr := &QueryError{Message: err.Error()}
+	for _, loc := range locs {
+		if loc == nil || loc.Source == nil {
+			continue
+		}
+		l := location.GetLocation(loc.Source, loc.Start)
+		queryErr.Locations = append(queryErr.Locations, Location{Line: l.Line, Column: l.Column})
+	}
+	s.errors = append(s.errors, queryErr)
+}
+
+// syntaxError converts an error returned by graphql-go's parser to
+// QueryErrors.
+func syntaxError(err error) QueryErrors {
+	queryErr := &QueryError{Message: err.Error()}
+	if gqlErr, ok := err.(*gqlerrors.Error); ok {
+		for _, l := range gqlErr.Locations {
+			queryErr.Locations = append(queryErr.Locations, Location{Line: l.Line, Column: l.Column})
+		}
+	}
+	return QueryErrors{queryErr}
+}
@@ -0,0 +1,91 @@
+package graphql
+
+import "strings"
+
+// querySizeLimits bounds the size of query documents, so that oversized
+// documents are rejected before they are parsed. Zero values mean no limit.
+type querySizeLimits struct {
+	maxBytes  int
+	maxTokens int
+}
+
+// check returns a ClientError if source exceeds the limits.
+func (l querySizeLimits) check(source string) error {
+	if l.maxBytes > 0 && len(source) > l.maxBytes {
+		return NewClientError("query is %d bytes, exceeding the limit of %d bytes", len(source), l.maxBytes)
+	}
+	if l.maxTokens > 0 && countTokens(source, l.maxTokens) > l.maxTokens {
+		return NewClientError("query exceeds the limit of %d tokens", l.maxTokens)
+	}
+	return nil
+}
+
+// countTokens counts the lexical tokens in a GraphQL document, skipping
+// whitespace, commas, and comments. It stops counting once more than max
+// tokens have been seen. Characters that are not valid GraphQL are counted as
+// tokens of their own and left for the parser to reject.
+func countTokens(source string, max int) int {
+	count := 0
+	for i := 0; i < len(source) && count <= max; {
+		c := source[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+			continue
+
+		case c == '#':
+			for i < len(source) && source[i] != '\n' && source[i] != '\r' {
+				i++
+			}
+			continue
+
+		case strings.HasPrefix(source[i:], `"""`):
+			i += 3
+			for i < len(source) && !strings.HasPrefix(source[i:], `"""`) {
+				if strings.HasPrefix(source[i:], `\"""`) {
+					i += 4
+				} else {
+					i++
+				}
+			}
+			i += 3
+
+		case c == '"':
+			i++
+			for i < len(source) && source[i] != '"' && source[i] != '\n' {
+				if source[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			i++
+
+		case strings.HasPrefix(source[i:], "..."):
+			i += 3
+
+		case isNameStart(c):
+			for i < len(source) && (isNameStart(source[i]) || isDigit(source[i])) {
+				i++
+			}
+
+		case c == '-' || isDigit(c):
+			i++
+			for i < len(source) && (isDigit(source[i]) || strings.IndexByte(".eE+-", source[i]) >= 0) {
+				i++
+			}
+
+		default:
+			i++
+		}
+		count++
+	}
+	return count
+}
+
+func isNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
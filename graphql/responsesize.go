@@ -0,0 +1,111 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"sync/atomic"
+)
+
+// checkResponseSize returns a ClientError if value encodes to more than
+// maxBytes of JSON.
+func checkResponseSize(value interface{}, maxBytes int) error {
+	if encodedSize(value, maxBytes) > maxBytes {
+		return responseTooLargeError(maxBytes)
+	}
+	return nil
+}
+
+func responseTooLargeError(maxBytes int) error {
+	return NewClientError("response too large, exceeding the limit of %d bytes", maxBytes)
+}
+
+// responseBudgetKey is the context key for the responseBudget of the query
+// being executed.
+type responseBudgetKey struct{}
+
+// A responseBudget counts the bytes of the keys and scalars of a response
+// while it is executed, so that execution stops as soon as the response is
+// known to exceed the limit of WithMaxResponseBytes. The count is a lower
+// bound of the encoded size, which checkResponseSize checks exactly once the
+// response is complete.
+type responseBudget struct {
+	used int64
+	max  int
+}
+
+// withResponseBudget returns a context that counts the response against max
+// bytes.
+func withResponseBudget(ctx context.Context, max int) context.Context {
+	return context.WithValue(ctx, responseBudgetKey{}, &responseBudget{max: max})
+}
+
+// responseBudgetFrom returns the responseBudget of ctx, or nil if there is
+// none.
+func responseBudgetFrom(ctx context.Context) *responseBudget {
+	budget, _ := ctx.Value(responseBudgetKey{}).(*responseBudget)
+	return budget
+}
+
+// charge counts n more bytes of the response, and returns an error once the
+// response exceeds the limit.
+func (b *responseBudget) charge(n int) error {
+	if atomic.AddInt64(&b.used, int64(n)) > int64(b.max) {
+		return responseTooLargeError(b.max)
+	}
+	return nil
+}
+
+// encodedSize returns the size of value encoded as JSON by encoding/json, as
+// returned by the executor. It stops counting once the size exceeds max, so
+// that an oversized response is not walked to its end.
+func encodedSize(value interface{}, max int) int {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		// Braces, a colon per key, and a comma between entries.
+		size := 2
+		first := true
+		for k, v := range value {
+			if !first {
+				size++
+			}
+			first = false
+			size += scalarSize(k) + 1
+			if size += encodedSize(v, max-size); size > max {
+				return size
+			}
+		}
+		return size
+	case []interface{}:
+		// Brackets, and a comma between elements.
+		size := 2
+		for i, v := range value {
+			if i > 0 {
+				size++
+			}
+			if size += encodedSize(v, max-size); size > max {
+				return size
+			}
+		}
+		return size
+	default:
+		return scalarSize(value)
+	}
+}
+
+func scalarSize(value interface{}) int {
+	switch value := value.(type) {
+	case nil:
+		return len("null")
+	case bool:
+		if value {
+			return len("true")
+		}
+		return len("false")
+	}
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		// Leave unencodable values for the caller to reject.
+		return 0
+	}
+	return len(bytes)
+}
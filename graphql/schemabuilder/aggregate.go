@@ -0,0 +1,299 @@
+package schemabuilder
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/samsarahq/thunder/reactive"
+)
+
+// AggregateFunc is a function computed by an Aggregate over the elements of a
+// list.
+type AggregateFunc int
+
+const (
+	// AggregateCount counts the elements.
+	AggregateCount AggregateFunc = iota
+	// AggregateSum sums a numeric field of the elements.
+	AggregateSum
+	// AggregateAverage averages a numeric field of the elements.
+	AggregateAverage
+	// AggregateMin finds the smallest value of a numeric field of the
+	// elements.
+	AggregateMin
+	// AggregateMax finds the largest value of a numeric field of the
+	// elements.
+	AggregateMax
+)
+
+// An Aggregate computes a field of a summary from the elements of a list.
+type Aggregate struct {
+	// Field is the name of the numeric Go field of the summary to set.
+	Field string
+	// Func is the function computed.
+	Func AggregateFunc
+	// Of is the name of the numeric Go field of the elements to aggregate.
+	// It is unused by AggregateCount.
+	Of string
+}
+
+// FieldFuncWithSummary registers a list field name resolved with f, like
+// FieldFunc, along with a companion field summaryName that aggregates the same
+// list into a struct of summary's type:
+//    type TransactionsSummary struct {
+//        Total int64
+//        Count int64
+//        Average *float64
+//    }
+//    user.FieldFuncWithSummary("transactions", fetchTransactions,
+//        "transactionsSummary", TransactionsSummary{},
+//        schemabuilder.Aggregate{Field: "Total", Func: schemabuilder.AggregateSum, Of: "Amount"},
+//        schemabuilder.Aggregate{Field: "Count", Func: schemabuilder.AggregateCount},
+//        schemabuilder.Aggregate{Field: "Average", Func: schemabuilder.AggregateAverage, Of: "Amount"})
+//
+// The function f takes an optional context, the object, and optional
+// arguments, and returns a slice and an optional error. Both fields take the
+// same arguments. When both are selected with the same arguments in a query
+// served by graphql.HTTPHandler or a connection, f is called once and its
+// result is shared. Averages, minimums, and maximums of an empty list are null
+// if their summary field is a pointer, and zero otherwise.
+func (s *Object) FieldFuncWithSummary(name string, f interface{}, summaryName string, summary interface{}, aggregates ...Aggregate) {
+	fn := reflect.ValueOf(f)
+	if fn.Kind() != reflect.Func {
+		panic("bad FieldFuncWithSummary: f should be a function")
+	}
+	fnType := fn.Type()
+	listType, returnsErr, err := summaryListType(fnType)
+	if err != nil {
+		panic(fmt.Sprintf("bad FieldFuncWithSummary %s: %s", name, err))
+	}
+	summaryType := reflect.TypeOf(summary)
+	if err := checkAggregates(listType.Elem(), summaryType, aggregates); err != nil {
+		panic(fmt.Sprintf("bad FieldFuncWithSummary %s: %s", name, err))
+	}
+
+	// The fields are resolved from a wrapper of f that takes a context, to
+	// share the list through reactive.Cache.
+	hasContext := fnType.NumIn() > 0 && fnType.In(0) == contextType
+	in := []reflect.Type{contextType}
+	for i := 0; i < fnType.NumIn(); i++ {
+		if i == 0 && hasContext {
+			continue
+		}
+		if fnType.In(i) == selectionSetType {
+			panic(fmt.Sprintf("bad FieldFuncWithSummary %s: f cannot take a selection set", name))
+		}
+		in = append(in, fnType.In(i))
+	}
+
+	shared := new(byte)
+	fetch := func(args []reflect.Value) (reflect.Value, reflect.Value) {
+		ctx := args[0].Interface().(context.Context)
+		call := args
+		if !hasContext {
+			call = args[1:]
+		}
+		compute := func(ctx context.Context) (interface{}, error) {
+			if hasContext {
+				call[0] = reflect.ValueOf(ctx)
+			}
+			out := fn.Call(call)
+			if returnsErr && !out[1].IsNil() {
+				return nil, out[1].Interface().(error)
+			}
+			return out[0].Interface(), nil
+		}
+
+		var list interface{}
+		var err error
+		if key, ok := makeSummaryKey(shared, args[1:]); ok {
+			list, err = reactive.Cache(ctx, key, compute)
+		} else {
+			list, err = compute(ctx)
+		}
+		if err != nil {
+			return reflect.Value{}, reflect.ValueOf(&err).Elem()
+		}
+		return reflect.ValueOf(list), reflect.Zero(errType)
+	}
+
+	listFn := reflect.MakeFunc(reflect.FuncOf(in, []reflect.Type{listType, errType}, false), func(args []reflect.Value) []reflect.Value {
+		list, err := fetch(args)
+		if !list.IsValid() {
+			return []reflect.Value{reflect.Zero(listType), err}
+		}
+		return []reflect.Value{list, err}
+	})
+	summaryFn := reflect.MakeFunc(reflect.FuncOf(in, []reflect.Type{summaryType, errType}, false), func(args []reflect.Value) []reflect.Value {
+		list, err := fetch(args)
+		if !list.IsValid() {
+			return []reflect.Value{reflect.Zero(summaryType), err}
+		}
+		return []reflect.Value{summarize(list, summaryType, aggregates), err}
+	})
+
+	s.FieldFunc(name, listFn.Interface())
+	s.FieldFunc(summaryName, summaryFn.Interface())
+}
+
+// summaryListType returns the slice type returned by a FieldFuncWithSummary
+// function of type fnType, and whether the function also returns an error.
+func summaryListType(fnType reflect.Type) (reflect.Type, bool, error) {
+	switch {
+	case fnType.NumOut() == 1:
+	case fnType.NumOut() == 2 && fnType.Out(1) == errType:
+	default:
+		return nil, false, fmt.Errorf("f should return a slice and an optional error")
+	}
+	listType := fnType.Out(0)
+	if listType.Kind() != reflect.Slice {
+		return nil, false, fmt.Errorf("f should return a slice, not %s", listType)
+	}
+	return listType, fnType.NumOut() == 2, nil
+}
+
+// checkAggregates checks that aggregates set numeric fields of summaryType
+// from numeric fields of elemType.
+func checkAggregates(elemType, summaryType reflect.Type, aggregates []Aggregate) error {
+	if summaryType == nil || summaryType.Kind() != reflect.Struct {
+		return fmt.Errorf("summary should be a struct, not %v", summaryType)
+	}
+	if elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+
+	for _, aggregate := range aggregates {
+		field, ok := summaryType.FieldByName(aggregate.Field)
+		if !ok || !isNumber(indirectType(field.Type)) {
+			return fmt.Errorf("summary %s should have a numeric field %s", summaryType, aggregate.Field)
+		}
+		if aggregate.Func == AggregateCount {
+			continue
+		}
+		if elemType.Kind() != reflect.Struct {
+			return fmt.Errorf("aggregates other than counts need a list of structs, not %s", elemType)
+		}
+		of, ok := elemType.FieldByName(aggregate.Of)
+		if !ok || !isNumber(of.Type) {
+			return fmt.Errorf("%s should have a numeric field %s", elemType, aggregate.Of)
+		}
+	}
+	return nil
+}
+
+func indirectType(typ reflect.Type) reflect.Type {
+	if typ.Kind() == reflect.Ptr {
+		return typ.Elem()
+	}
+	return typ
+}
+
+func isNumber(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
+// summaryKey is the reactive.Cache key for the list shared by the fields of a
+// FieldFuncWithSummary.
+type summaryKey struct {
+	shared *byte
+	args   [2]interface{}
+}
+
+// makeSummaryKey returns the key for the list of the FieldFuncWithSummary
+// shared called with args, if the args can be compared.
+func makeSummaryKey(shared *byte, args []reflect.Value) (summaryKey, bool) {
+	key := summaryKey{shared: shared}
+	if len(args) > len(key.args) {
+		return summaryKey{}, false
+	}
+	for i, arg := range args {
+		if !arg.Type().Comparable() {
+			return summaryKey{}, false
+		}
+		key.args[i] = arg.Interface()
+	}
+	return key, true
+}
+
+// summarize computes aggregates over list into a new summaryType.
+func summarize(list reflect.Value, summaryType reflect.Type, aggregates []Aggregate) reflect.Value {
+	summary := reflect.New(summaryType).Elem()
+	for _, aggregate := range aggregates {
+		dest := summary.FieldByName(aggregate.Field)
+
+		if aggregate.Func == AggregateCount {
+			setNumber(dest, float64(list.Len()))
+			continue
+		}
+
+		var result float64
+		var n int
+		for i := 0; i < list.Len(); i++ {
+			elem := list.Index(i)
+			if elem.Kind() == reflect.Ptr {
+				if elem.IsNil() {
+					continue
+				}
+				elem = elem.Elem()
+			}
+			value := toFloat(elem.FieldByName(aggregate.Of))
+
+			switch {
+			case n == 0:
+				result = value
+			case aggregate.Func == AggregateSum || aggregate.Func == AggregateAverage:
+				result += value
+			case aggregate.Func == AggregateMin && value < result:
+				result = value
+			case aggregate.Func == AggregateMax && value > result:
+				result = value
+			}
+			n++
+		}
+
+		if n == 0 && aggregate.Func != AggregateSum {
+			// Leave the field null or zero.
+			continue
+		}
+		if aggregate.Func == AggregateAverage {
+			result /= float64(n)
+		}
+		setNumber(dest, result)
+	}
+	return summary
+}
+
+func toFloat(value reflect.Value) float64 {
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint())
+	default:
+		return value.Float()
+	}
+}
+
+// setNumber sets the numeric or pointer to numeric dest to value.
+func setNumber(dest reflect.Value, value float64) {
+	if dest.Kind() == reflect.Ptr {
+		dest.Set(reflect.New(dest.Type().Elem()))
+		dest = dest.Elem()
+	}
+	switch dest.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		dest.SetInt(int64(value))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		dest.SetUint(uint64(value))
+	default:
+		dest.SetFloat(value)
+	}
+}
@@ -0,0 +1,130 @@
+package schemabuilder
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/samsarahq/thunder/graphql"
+)
+
+// ArgInfo describes an argument of a FieldFunc, for tools such as form
+// generators that need more detail than introspection provides.
+type ArgInfo struct {
+	Name     string
+	GoType   reflect.Type
+	Type     graphql.Type // The argument's GraphQL type, wrapped in NonNull if required.
+	Nullable bool
+
+	// EnumValues are the sorted values of an enum argument, or of the
+	// elements of a list of enums.
+	EnumValues []string
+	// Constraints are the argument's constraints as written in its tag, such
+	// as "min=0".
+	Constraints []string
+	// Fields describe the fields of an input object argument, or of the
+	// elements of a list of input objects.
+	Fields []ArgInfo
+}
+
+// FieldArguments describes the arguments of the FieldFunc fieldName on the
+// object registered as objectName, such as "Query". Arguments are sorted by
+// name, and arguments set from the context are omitted.
+func (s *Schema) FieldArguments(objectName, fieldName string) ([]ArgInfo, error) {
+	object, ok := s.objects[objectName]
+	if !ok {
+		return nil, fmt.Errorf("unknown object %s", objectName)
+	}
+	m, ok := object.Methods[fieldName]
+	if !ok {
+		return nil, fmt.Errorf("unknown field %s on object %s", fieldName, objectName)
+	}
+	if m.Versions != nil {
+		// The versions of a field have the same arguments, so describe the
+		// first version's.
+		var versions []string
+		for version := range m.Versions {
+			versions = append(versions, version)
+		}
+		sort.Strings(versions)
+		first := *m
+		first.Fn = m.Versions[versions[0]]
+		m = &first
+	}
+
+	sb := newSchemaBuilder(s)
+	funcCtx := &funcContext{typ: reflect.TypeOf(object.Type)}
+	if _, err := funcCtx.getFuncVal(m); err != nil {
+		return nil, err
+	}
+
+	in := funcCtx.consumeContextAndSource(funcCtx.getFuncInputTypes())
+	if len(in) == 0 || in[0] == selectionSetType {
+		return nil, nil
+	}
+	if in[0].Kind() != reflect.Struct {
+		return nil, fmt.Errorf("expected struct but received type %s", in[0])
+	}
+	return sb.argInfos(in[0])
+}
+
+func (sb *schemaBuilder) argInfos(typ reflect.Type) ([]ArgInfo, error) {
+	var infos []ArgInfo
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name, constraints, ok, err := parseArgField(typ, field)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+
+		_, argType, err := sb.makeArgParser(field.Type)
+		if err != nil {
+			return nil, err
+		}
+
+		info := ArgInfo{
+			Name:   name,
+			GoType: field.Type,
+			Type:   argType,
+		}
+		_, nonNull := argType.(*graphql.NonNull)
+		info.Nullable = !nonNull
+		for _, constraint := range constraints {
+			info.Constraints = append(info.Constraints, constraint.spec)
+		}
+
+		// Describe the element type of lists.
+		inner, innerGoType := argType, field.Type
+		for {
+			if nonNull, ok := inner.(*graphql.NonNull); ok {
+				inner = nonNull.Type
+			}
+			for innerGoType.Kind() == reflect.Ptr {
+				innerGoType = innerGoType.Elem()
+			}
+			list, ok := inner.(*graphql.List)
+			if !ok {
+				break
+			}
+			inner, innerGoType = list.Type, innerGoType.Elem()
+		}
+
+		switch inner := inner.(type) {
+		case *graphql.Enum:
+			info.EnumValues = append([]string(nil), inner.Values...)
+			sort.Strings(info.EnumValues)
+		case *graphql.InputObject:
+			if info.Fields, err = sb.argInfos(innerGoType); err != nil {
+				return nil, err
+			}
+		}
+
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos, nil
+}
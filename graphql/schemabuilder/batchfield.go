@@ -0,0 +1,160 @@
+package schemabuilder
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/samsarahq/thunder/batch"
+)
+
+// BatchFieldFunc registers a field name resolved for many objects at once,
+// to avoid loading a field such as the organization of each of a list of users
+// with a query per user. The function f takes a context, a slice of objects,
+// and optional arguments, and returns the field's values with an error, either
+// as a slice in the order of the objects or as a map keyed by object:
+//    user.BatchFieldFunc("organization", func(ctx context.Context, users []*User) (map[*User]*Organization, error) {
+//        return db.OrganizationsOf(ctx, users)
+//    })
+//
+// When the field is selected on several objects with the same arguments in a
+// query served by graphql.HTTPHandler or a connection, their resolutions are
+// combined with package batch into a single call to f. Objects missing from a
+// map have the zero value. Without batching, f is called with each object
+// alone. The arguments must be comparable, as they tell which resolutions can
+// be combined.
+func (s *Object) BatchFieldFunc(name string, f interface{}, options ...FieldFuncOption) {
+	fn := reflect.ValueOf(f)
+	if fn.Kind() != reflect.Func {
+		panic("bad BatchFieldFunc: f should be a function")
+	}
+	fnType := fn.Type()
+	sourceType, argsType, resultType, err := batchFieldTypes(fnType)
+	if err != nil {
+		panic(fmt.Sprintf("bad BatchFieldFunc %s: %s", name, err))
+	}
+	keyed := fnType.Out(0).Kind() == reflect.Map
+
+	// The field is resolved with a wrapper of f that resolves a single
+	// object.
+	in := []reflect.Type{contextType, sourceType}
+	if argsType != nil {
+		in = append(in, argsType)
+	}
+
+	load := func(ctx context.Context, calls []batchFieldCall) ([]interface{}, error) {
+		sources := reflect.MakeSlice(fnType.In(1), len(calls), len(calls))
+		for i, call := range calls {
+			sources.Index(i).Set(call.source)
+		}
+		in := []reflect.Value{reflect.ValueOf(ctx), sources}
+		if argsType != nil {
+			in = append(in, calls[0].args)
+		}
+
+		out := fn.Call(in)
+		if !out[1].IsNil() {
+			return nil, out[1].Interface().(error)
+		}
+		results := make([]interface{}, len(calls))
+		if keyed {
+			for i, call := range calls {
+				value := out[0].MapIndex(call.source)
+				if !value.IsValid() {
+					value = reflect.Zero(resultType)
+				}
+				results[i] = value.Interface()
+			}
+			return results, nil
+		}
+		if out[0].Len() != len(calls) {
+			return nil, fmt.Errorf("%s returned %d results for %d objects", name, out[0].Len(), len(calls))
+		}
+		for i := range results {
+			results[i] = out[0].Index(i).Interface()
+		}
+		return results, nil
+	}
+
+	loader := &batch.Func{
+		Name: name,
+		Many: func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			calls := make([]batchFieldCall, len(args))
+			for i, arg := range args {
+				calls[i] = arg.(batchFieldCall)
+			}
+			return load(ctx, calls)
+		},
+		// Func shards by arguments, so every call in a batch has the same
+		// arguments.
+		Shard: func(arg interface{}) interface{} {
+			if args := arg.(batchFieldCall).args; args.IsValid() {
+				return args.Interface()
+			}
+			return nil
+		},
+	}
+
+	wrapper := reflect.MakeFunc(reflect.FuncOf(in, []reflect.Type{resultType, errType}, false), func(args []reflect.Value) []reflect.Value {
+		ctx := args[0].Interface().(context.Context)
+		call := batchFieldCall{source: args[1]}
+		if argsType != nil {
+			call.args = args[2]
+		}
+
+		var result interface{}
+		var err error
+		if batch.HasBatching(ctx) {
+			result, err = loader.Invoke(ctx, call)
+		} else {
+			var results []interface{}
+			if results, err = load(ctx, []batchFieldCall{call}); err == nil {
+				result = results[0]
+			}
+		}
+		if err != nil {
+			return []reflect.Value{reflect.Zero(resultType), reflect.ValueOf(&err).Elem()}
+		}
+		if result == nil {
+			return []reflect.Value{reflect.Zero(resultType), reflect.Zero(errType)}
+		}
+		return []reflect.Value{reflect.ValueOf(result), reflect.Zero(errType)}
+	})
+
+	s.FieldFunc(name, wrapper.Interface(), options...)
+}
+
+// batchFieldCall is a resolution of a BatchFieldFunc field for an object.
+type batchFieldCall struct {
+	source reflect.Value
+	args   reflect.Value
+}
+
+// batchFieldTypes returns the types of the objects, arguments, and results of
+// a BatchFieldFunc function of type fnType. The arguments type is nil if the
+// function takes none.
+func batchFieldTypes(fnType reflect.Type) (sourceType, argsType, resultType reflect.Type, err error) {
+	n := fnType.NumIn()
+	if n < 2 || n > 3 || fnType.In(0) != contextType || fnType.In(1).Kind() != reflect.Slice {
+		return nil, nil, nil, fmt.Errorf("f should take a context, a slice of objects, and optional arguments")
+	}
+	sourceType = fnType.In(1).Elem()
+	if n == 3 {
+		argsType = fnType.In(2)
+		if !argsType.Comparable() {
+			return nil, nil, nil, fmt.Errorf("arguments %s should be comparable", argsType)
+		}
+	}
+
+	if fnType.NumOut() != 2 || fnType.Out(1) != errType {
+		return nil, nil, nil, fmt.Errorf("f should return results and an error")
+	}
+	out := fnType.Out(0)
+	switch {
+	case out.Kind() == reflect.Slice:
+	case out.Kind() == reflect.Map && out.Key() == sourceType:
+	default:
+		return nil, nil, nil, fmt.Errorf("f should return a slice of results or a map of results by object, not %s", out)
+	}
+	return sourceType, argsType, out.Elem(), nil
+}
@@ -0,0 +1,145 @@
+package schemabuilder
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/samsarahq/thunder/batch"
+)
+
+// connectionArgsKey is the context key for the ConnectionArgs of the paginated
+// field being resolved.
+type connectionArgsKey struct{}
+
+var connectionArgsType = reflect.TypeOf(ConnectionArgs{})
+
+// BatchPaginateFieldFunc registers a paginated field, like PaginateFieldFunc,
+// whose nodes are loaded for many objects at once, for nested connections such
+// as the posts of a list of users. The function f takes a context, a slice of
+// objects, optional arguments, and the pagination arguments, and returns the
+// nodes of each object, in the same order, and an optional error:
+//    user.BatchPaginateFieldFunc("posts", func(ctx context.Context, users []*User, args PostArgs, page schemabuilder.ConnectionArgs) ([][]*Post, error) {
+//        return db.LatestPostsPerUser(ctx, userIDs(users), args.Filter, page.First)
+//    })
+//
+// When the field is selected on several objects with the same arguments in a
+// query served by graphql.HTTPHandler or a connection, their invocations are
+// combined with package batch into a single call to f. Each list of nodes is
+// then paginated as for PaginateFieldFunc, so f can limit each object's nodes
+// to the requested page. Returning one more node than page.First lets
+// hasNextPage be reported, and since totalCount counts the nodes returned, the
+// CountFunc option should compute it for limited pages.
+func (o *Object) BatchPaginateFieldFunc(name string, f interface{}, options ...PaginationOption) {
+	fn := reflect.ValueOf(f)
+	if fn.Kind() != reflect.Func {
+		panic("bad BatchPaginateFieldFunc: f should be a function")
+	}
+	fnType := fn.Type()
+	parentType, argsType, nodesType, err := batchPaginateTypes(fnType)
+	if err != nil {
+		panic(fmt.Sprintf("bad BatchPaginateFieldFunc %s: %s", name, err))
+	}
+
+	// The field is paginated with a wrapper of f that loads the nodes of a
+	// single object.
+	in := []reflect.Type{contextType, parentType}
+	if argsType != nil {
+		in = append(in, argsType)
+	}
+
+	load := func(ctx context.Context, requests []batchPageRequest) ([]interface{}, error) {
+		first := requests[0]
+		parents := reflect.MakeSlice(fnType.In(1), len(requests), len(requests))
+		for i, request := range requests {
+			parents.Index(i).Set(request.parent)
+		}
+		call := []reflect.Value{reflect.ValueOf(ctx), parents}
+		if argsType != nil {
+			call = append(call, first.args)
+		}
+		call = append(call, reflect.ValueOf(first.page))
+
+		out := fn.Call(call)
+		if !out[1].IsNil() {
+			return nil, out[1].Interface().(error)
+		}
+		if out[0].Len() != len(requests) {
+			return nil, fmt.Errorf("%s returned %d lists of nodes for %d objects", name, out[0].Len(), len(requests))
+		}
+		results := make([]interface{}, len(requests))
+		for i := range results {
+			results[i] = out[0].Index(i).Interface()
+		}
+		return results, nil
+	}
+
+	loader := &batch.Func{
+		Name: name,
+		Many: func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			requests := make([]batchPageRequest, len(args))
+			for i, arg := range args {
+				requests[i] = arg.(batchPageRequest)
+			}
+			return load(ctx, requests)
+		},
+		// Objects are batched by selection, whose arguments are parsed once
+		// and so are the same values.
+		Shard: func(arg interface{}) interface{} {
+			return arg.(batchPageRequest).page
+		},
+	}
+
+	wrapper := reflect.MakeFunc(reflect.FuncOf(in, []reflect.Type{nodesType, errType}, false), func(args []reflect.Value) []reflect.Value {
+		ctx := args[0].Interface().(context.Context)
+		page, _ := ctx.Value(connectionArgsKey{}).(ConnectionArgs)
+		request := batchPageRequest{parent: args[1], page: page}
+		if argsType != nil {
+			request.args = args[2]
+		}
+
+		var nodes interface{}
+		var err error
+		if batch.HasBatching(ctx) {
+			nodes, err = loader.Invoke(ctx, request)
+		} else {
+			var results []interface{}
+			if results, err = load(ctx, []batchPageRequest{request}); err == nil {
+				nodes = results[0]
+			}
+		}
+		if err != nil {
+			return []reflect.Value{reflect.Zero(nodesType), reflect.ValueOf(&err).Elem()}
+		}
+		return []reflect.Value{reflect.ValueOf(nodes), reflect.Zero(errType)}
+	})
+
+	o.PaginateFieldFunc(name, wrapper.Interface(), options...)
+}
+
+// batchPageRequest is an invocation of a BatchPaginateFieldFunc for an object.
+type batchPageRequest struct {
+	parent reflect.Value
+	args   reflect.Value
+	page   ConnectionArgs
+}
+
+// batchPaginateTypes returns the types of the objects, arguments, and nodes of
+// a BatchPaginateFieldFunc function of type fnType. The arguments type is nil
+// if the function takes none.
+func batchPaginateTypes(fnType reflect.Type) (parentType, argsType, nodesType reflect.Type, err error) {
+	n := fnType.NumIn()
+	if n < 3 || n > 4 || fnType.In(0) != contextType || fnType.In(n-1) != connectionArgsType {
+		return nil, nil, nil, fmt.Errorf("f should take a context, a slice of objects, optional arguments, and ConnectionArgs")
+	}
+	if fnType.In(1).Kind() != reflect.Slice {
+		return nil, nil, nil, fmt.Errorf("f should take a slice of objects, not %s", fnType.In(1))
+	}
+	if n == 4 {
+		argsType = fnType.In(2)
+	}
+	if fnType.NumOut() != 2 || fnType.Out(1) != errType || fnType.Out(0).Kind() != reflect.Slice || fnType.Out(0).Elem().Kind() != reflect.Slice {
+		return nil, nil, nil, fmt.Errorf("f should return a slice of slices of nodes and an error")
+	}
+	return fnType.In(1).Elem(), argsType, fnType.Out(0).Elem(), nil
+}
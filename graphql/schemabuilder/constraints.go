@@ -0,0 +1,164 @@
+package schemabuilder
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// An argConstraint is a declarative check on a scalar or list argument,
+// specified in a struct tag such as `graphql:"age,min=0,max=150"`.
+type argConstraint struct {
+	// spec is the constraint as written in the tag, used in error messages.
+	spec  string
+	check func(value reflect.Value) bool
+}
+
+// isConstraintTag returns true if tag looks like a constraint specification
+// rather than a flag such as "key".
+func isConstraintTag(tag string) bool {
+	return strings.Contains(tag, "=")
+}
+
+// parseArgConstraints parses the constraint specifications in tags for an
+// argument field of type typ.
+//
+// A pattern may contain commas, so once a pattern constraint is seen the rest
+// of the tag is used as the regular expression; pattern must therefore come
+// last.
+func parseArgConstraints(typ reflect.Type, tags []string) ([]argConstraint, error) {
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	var constraints []argConstraint
+	for i, tag := range tags {
+		parts := strings.SplitN(tag, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("unexpected tag %s after constraints", tag)
+		}
+		name, arg := parts[0], parts[1]
+
+		if name == "pattern" {
+			arg = strings.Join(append([]string{arg}, tags[i+1:]...), ",")
+			tag = "pattern=" + arg
+		}
+
+		constraint, err := parseArgConstraint(typ, name, arg)
+		if err != nil {
+			return nil, fmt.Errorf("bad constraint %s: %s", tag, err)
+		}
+		constraint.spec = tag
+		constraints = append(constraints, constraint)
+
+		if name == "pattern" {
+			break
+		}
+	}
+	return constraints, nil
+}
+
+func parseArgConstraint(typ reflect.Type, name, arg string) (argConstraint, error) {
+	switch name {
+	case "min", "max":
+		bound, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return argConstraint{}, fmt.Errorf("%s is not a number", arg)
+		}
+		asFloat, ok := numberGetter(typ)
+		if !ok {
+			return argConstraint{}, fmt.Errorf("%s requires a number, not %s", name, typ)
+		}
+		if name == "min" {
+			return argConstraint{check: func(value reflect.Value) bool {
+				return asFloat(value) >= bound
+			}}, nil
+		}
+		return argConstraint{check: func(value reflect.Value) bool {
+			return asFloat(value) <= bound
+		}}, nil
+
+	case "minLength", "maxLength":
+		bound, err := strconv.Atoi(arg)
+		if err != nil || bound < 0 {
+			return argConstraint{}, fmt.Errorf("%s is not a non-negative integer", arg)
+		}
+		if typ.Kind() != reflect.String {
+			return argConstraint{}, fmt.Errorf("%s requires a string, not %s", name, typ)
+		}
+		if name == "minLength" {
+			return argConstraint{check: func(value reflect.Value) bool {
+				return utf8.RuneCountInString(value.String()) >= bound
+			}}, nil
+		}
+		return argConstraint{check: func(value reflect.Value) bool {
+			return utf8.RuneCountInString(value.String()) <= bound
+		}}, nil
+
+	case "minItems", "maxItems":
+		bound, err := strconv.Atoi(arg)
+		if err != nil || bound < 0 {
+			return argConstraint{}, fmt.Errorf("%s is not a non-negative integer", arg)
+		}
+		if typ.Kind() != reflect.Slice {
+			return argConstraint{}, fmt.Errorf("%s requires a list, not %s", name, typ)
+		}
+		if name == "minItems" {
+			return argConstraint{check: func(value reflect.Value) bool {
+				return value.Len() >= bound
+			}}, nil
+		}
+		return argConstraint{check: func(value reflect.Value) bool {
+			return value.Len() <= bound
+		}}, nil
+
+	case "pattern":
+		re, err := regexp.Compile(arg)
+		if err != nil {
+			return argConstraint{}, err
+		}
+		if typ.Kind() != reflect.String {
+			return argConstraint{}, fmt.Errorf("pattern requires a string, not %s", typ)
+		}
+		return argConstraint{check: func(value reflect.Value) bool {
+			return re.MatchString(value.String())
+		}}, nil
+
+	default:
+		return argConstraint{}, fmt.Errorf("unknown constraint %s", name)
+	}
+}
+
+// numberGetter returns a function that reads a value of type typ as a float64.
+func numberGetter(typ reflect.Type) (func(reflect.Value) float64, bool) {
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(value reflect.Value) float64 { return float64(value.Int()) }, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return func(value reflect.Value) float64 { return float64(value.Uint()) }, true
+	case reflect.Float32, reflect.Float64:
+		return func(value reflect.Value) float64 { return value.Float() }, true
+	default:
+		return nil, false
+	}
+}
+
+// checkArgConstraints checks a parsed argument value against constraints.
+// Optional arguments that were not provided are not checked.
+func checkArgConstraints(value reflect.Value, constraints []argConstraint) error {
+	if value.Kind() == reflect.Ptr {
+		if value.IsNil() {
+			return nil
+		}
+		value = value.Elem()
+	}
+	for _, constraint := range constraints {
+		if !constraint.check(value) {
+			return fmt.Errorf("violates constraint %s", constraint.spec)
+		}
+	}
+	return nil
+}
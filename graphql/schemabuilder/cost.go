@@ -0,0 +1,68 @@
+package schemabuilder
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Cost returns an option for a FieldFunc that sets the estimated cost of
+// resolving the field to n, as checked with graphql.WithMaxCost, for fields
+// more expensive than the default cost of 1, or free fields of cost 0:
+//    query.FieldFunc("search", func(args SearchArgs) []*Result { ... }, schemabuilder.Cost(10))
+func Cost(n int) FieldFuncOption {
+	return func(m *method) {
+		m.Cost = &n
+	}
+}
+
+// CostFunc returns an option for a FieldFunc that estimates the cost of
+// resolving the field from its arguments with f, which takes the arguments of
+// the field's function and returns the cost:
+//    query.FieldFunc("users", func(args UsersArgs) []*User { ... }, schemabuilder.CostFunc(func(args UsersArgs) int {
+//        return int(args.Limit)
+//    }))
+//
+// Paginated fields multiply the cost of their selections by the page size,
+// first or last, without an option.
+func CostFunc(f interface{}) FieldFuncOption {
+	return func(m *method) {
+		m.CostFn = f
+	}
+}
+
+// buildCostFunc returns the graphql.Field.Cost of a field registered with m,
+// whose arguments are of type argsType, or nil if it takes none. It is nil if
+// m has the default cost.
+func buildCostFunc(m *method, argsType reflect.Type) (func(args interface{}) int, error) {
+	if m.CostFn == nil {
+		if m.Cost == nil {
+			return nil, nil
+		}
+		cost := *m.Cost
+		return func(args interface{}) int {
+			return cost
+		}, nil
+	}
+
+	fn := reflect.ValueOf(m.CostFn)
+	fnType := fn.Type()
+	if fnType.Kind() != reflect.Func || argsType == nil || fnType.NumIn() != 1 || fnType.In(0) != argsType || fnType.NumOut() != 1 || fnType.Out(0) != reflect.TypeOf(0) {
+		return nil, fmt.Errorf("cost func %s should take the field's arguments and return an int", fnType)
+	}
+	return func(args interface{}) int {
+		return int(fn.Call([]reflect.Value{reflect.ValueOf(args)})[0].Int())
+	}, nil
+}
+
+// pageSize returns the number of nodes a paginated field with args returns
+// at most, first or last, or 1 if neither is set.
+func pageSize(args interface{}) int {
+	connectionArgs, _ := args.(ConnectionArgs)
+	switch {
+	case connectionArgs.First != nil:
+		return int(*connectionArgs.First)
+	case connectionArgs.Last != nil:
+		return int(*connectionArgs.Last)
+	}
+	return 1
+}
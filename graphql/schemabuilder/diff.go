@@ -0,0 +1,302 @@
+package schemabuilder
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/samsarahq/thunder/graphql"
+)
+
+// A ChangeKind classifies a Change between two schemas.
+type ChangeKind string
+
+const (
+	TypeAdded             ChangeKind = "TYPE_ADDED"
+	TypeRemoved           ChangeKind = "TYPE_REMOVED"
+	TypeKindChanged       ChangeKind = "TYPE_KIND_CHANGED"
+	FieldAdded            ChangeKind = "FIELD_ADDED"
+	FieldRemoved          ChangeKind = "FIELD_REMOVED"
+	FieldTypeChanged      ChangeKind = "FIELD_TYPE_CHANGED"
+	ArgAdded              ChangeKind = "ARG_ADDED"
+	ArgRemoved            ChangeKind = "ARG_REMOVED"
+	ArgTypeChanged        ChangeKind = "ARG_TYPE_CHANGED"
+	InputFieldAdded       ChangeKind = "INPUT_FIELD_ADDED"
+	InputFieldRemoved     ChangeKind = "INPUT_FIELD_REMOVED"
+	InputFieldTypeChanged ChangeKind = "INPUT_FIELD_TYPE_CHANGED"
+	EnumValueAdded        ChangeKind = "ENUM_VALUE_ADDED"
+	EnumValueRemoved      ChangeKind = "ENUM_VALUE_REMOVED"
+)
+
+// A Change is a difference between two schemas, as found by Diff.
+type Change struct {
+	Kind ChangeKind
+	// Path locates the change, such as "User", "User.email", or
+	// "Query.users(limit)".
+	Path string
+	// Breaking is true if the change can break existing clients.
+	Breaking    bool
+	Description string
+}
+
+// Diff returns the changes from the old schema to the new one, sorted by
+// path, for gating breaking changes in CI. Changes are classified as in the
+// GraphQL ecosystem:
+//
+// Removing a type, field, argument, input field, or enum value is breaking,
+// as is changing a type's kind. Changing a field's type is breaking unless
+// the new type only makes the field non-null. Changing the type of an argument
+// or input field is breaking unless the new type only makes it nullable.
+// Adding a non-null argument or input field is breaking, since arguments and
+// input fields of non-null types are required. Other additions are not.
+func Diff(old, new *graphql.Schema) []Change {
+	oldTypes := schemaTypes(old)
+	newTypes := schemaTypes(new)
+
+	var changes []Change
+	add := func(kind ChangeKind, path string, breaking bool, format string, args ...interface{}) {
+		changes = append(changes, Change{Kind: kind, Path: path, Breaking: breaking, Description: fmt.Sprintf(format, args...)})
+	}
+
+	for name, oldType := range oldTypes {
+		newType, ok := newTypes[name]
+		if !ok {
+			add(TypeRemoved, name, true, "type %s was removed", name)
+			continue
+		}
+		if typeKind(oldType) != typeKind(newType) {
+			add(TypeKindChanged, name, true, "type %s changed from %s to %s", name, typeKind(oldType), typeKind(newType))
+			continue
+		}
+
+		switch oldType := oldType.(type) {
+		case *graphql.Object, *graphql.Interface:
+			oldFields, newFields := typeFields(oldType), typeFields(newType)
+			for fieldName, oldField := range oldFields {
+				path := name + "." + fieldName
+				newField, ok := newFields[fieldName]
+				if !ok {
+					add(FieldRemoved, path, true, "field %s was removed", path)
+					continue
+				}
+				if !safeOutputChange(oldField.Type, newField.Type) {
+					add(FieldTypeChanged, path, true, "field %s changed type from %s to %s", path, oldField.Type, newField.Type)
+				} else if oldField.Type.String() != newField.Type.String() {
+					add(FieldTypeChanged, path, false, "field %s changed type from %s to %s", path, oldField.Type, newField.Type)
+				}
+
+				for argName, oldArg := range oldField.Args {
+					argPath := fmt.Sprintf("%s(%s)", path, argName)
+					newArg, ok := newField.Args[argName]
+					if !ok {
+						add(ArgRemoved, argPath, true, "argument %s was removed", argPath)
+						continue
+					}
+					if !safeInputChange(oldArg, newArg) {
+						add(ArgTypeChanged, argPath, true, "argument %s changed type from %s to %s", argPath, oldArg, newArg)
+					} else if oldArg.String() != newArg.String() {
+						add(ArgTypeChanged, argPath, false, "argument %s changed type from %s to %s", argPath, oldArg, newArg)
+					}
+				}
+				for argName, newArg := range newField.Args {
+					if _, ok := oldField.Args[argName]; !ok {
+						argPath := fmt.Sprintf("%s(%s)", path, argName)
+						_, required := newArg.(*graphql.NonNull)
+						add(ArgAdded, argPath, required, "argument %s of type %s was added", argPath, newArg)
+					}
+				}
+			}
+			for fieldName := range newFields {
+				if _, ok := oldFields[fieldName]; !ok {
+					path := name + "." + fieldName
+					add(FieldAdded, path, false, "field %s was added", path)
+				}
+			}
+
+		case *graphql.InputObject:
+			newType := newType.(*graphql.InputObject)
+			for fieldName, oldField := range oldType.InputFields {
+				path := name + "." + fieldName
+				newField, ok := newType.InputFields[fieldName]
+				if !ok {
+					add(InputFieldRemoved, path, true, "input field %s was removed", path)
+					continue
+				}
+				if !safeInputChange(oldField, newField) {
+					add(InputFieldTypeChanged, path, true, "input field %s changed type from %s to %s", path, oldField, newField)
+				} else if oldField.String() != newField.String() {
+					add(InputFieldTypeChanged, path, false, "input field %s changed type from %s to %s", path, oldField, newField)
+				}
+			}
+			for fieldName, newField := range newType.InputFields {
+				if _, ok := oldType.InputFields[fieldName]; !ok {
+					path := name + "." + fieldName
+					_, required := newField.(*graphql.NonNull)
+					add(InputFieldAdded, path, required, "input field %s of type %s was added", path, newField)
+				}
+			}
+
+		case *graphql.Enum:
+			newValues := make(map[string]bool)
+			for _, value := range newType.(*graphql.Enum).Values {
+				newValues[value] = true
+			}
+			oldValues := make(map[string]bool)
+			for _, value := range oldType.Values {
+				oldValues[value] = true
+				if !newValues[value] {
+					path := name + "." + value
+					add(EnumValueRemoved, path, true, "enum value %s was removed", path)
+				}
+			}
+			for _, value := range newType.(*graphql.Enum).Values {
+				if !oldValues[value] {
+					path := name + "." + value
+					add(EnumValueAdded, path, false, "enum value %s was added", path)
+				}
+			}
+		}
+	}
+	for name := range newTypes {
+		if _, ok := oldTypes[name]; !ok {
+			add(TypeAdded, name, false, "type %s was added", name)
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Path != changes[j].Path {
+			return changes[i].Path < changes[j].Path
+		}
+		return changes[i].Kind < changes[j].Kind
+	})
+	return changes
+}
+
+// schemaTypes returns the named types reachable from the roots of schema,
+// by name.
+func schemaTypes(schema *graphql.Schema) map[string]graphql.Type {
+	types := make(map[string]graphql.Type)
+	var visit func(graphql.Type)
+	visit = func(typ graphql.Type) {
+		switch typ := typ.(type) {
+		case *graphql.NonNull:
+			visit(typ.Type)
+			return
+		case *graphql.List:
+			visit(typ.Type)
+			return
+		case nil:
+			return
+		}
+
+		name := typ.String()
+		if _, ok := types[name]; ok {
+			return
+		}
+		types[name] = typ
+
+		switch typ := typ.(type) {
+		case *graphql.Object:
+			for _, field := range typ.Fields {
+				visit(field.Type)
+				for _, arg := range field.Args {
+					visit(arg)
+				}
+			}
+			for _, iface := range typ.Interfaces {
+				visit(iface)
+			}
+		case *graphql.Interface:
+			for _, field := range typ.Fields {
+				visit(field.Type)
+				for _, arg := range field.Args {
+					visit(arg)
+				}
+			}
+			for _, object := range typ.Types {
+				visit(object)
+			}
+		case *graphql.InputObject:
+			for _, field := range typ.InputFields {
+				visit(field)
+			}
+		}
+	}
+	visit(schema.Query)
+	visit(schema.Mutation)
+	return types
+}
+
+// typeFields returns the fields of an object or interface.
+func typeFields(typ graphql.Type) map[string]*graphql.Field {
+	if iface, ok := typ.(*graphql.Interface); ok {
+		return iface.Fields
+	}
+	return typ.(*graphql.Object).Fields
+}
+
+func typeKind(typ graphql.Type) string {
+	switch typ.(type) {
+	case *graphql.Object:
+		return "OBJECT"
+	case *graphql.Interface:
+		return "INTERFACE"
+	case *graphql.InputObject:
+		return "INPUT_OBJECT"
+	case *graphql.Enum:
+		return "ENUM"
+	default:
+		return "SCALAR"
+	}
+}
+
+// safeOutputChange returns true if changing a field's type from old to new
+// cannot break clients, because new is old or only makes old non-null.
+func safeOutputChange(old, new graphql.Type) bool {
+	switch old := old.(type) {
+	case *graphql.NonNull:
+		newNonNull, ok := new.(*graphql.NonNull)
+		return ok && safeOutputChange(old.Type, newNonNull.Type)
+	case *graphql.List:
+		if newNonNull, ok := new.(*graphql.NonNull); ok {
+			new = newNonNull.Type
+		}
+		newList, ok := new.(*graphql.List)
+		return ok && safeOutputChange(old.Type, newList.Type)
+	default:
+		if newNonNull, ok := new.(*graphql.NonNull); ok {
+			new = newNonNull.Type
+		}
+		return isNamedType(new) && old.String() == new.String()
+	}
+}
+
+// safeInputChange returns true if changing an argument or input field's type
+// from old to new cannot break clients, because new is old or only makes old
+// nullable.
+func safeInputChange(old, new graphql.Type) bool {
+	switch new := new.(type) {
+	case *graphql.NonNull:
+		oldNonNull, ok := old.(*graphql.NonNull)
+		return ok && safeInputChange(oldNonNull.Type, new.Type)
+	case *graphql.List:
+		if oldNonNull, ok := old.(*graphql.NonNull); ok {
+			old = oldNonNull.Type
+		}
+		oldList, ok := old.(*graphql.List)
+		return ok && safeInputChange(oldList.Type, new.Type)
+	default:
+		if oldNonNull, ok := old.(*graphql.NonNull); ok {
+			old = oldNonNull.Type
+		}
+		return isNamedType(old) && old.String() == new.String()
+	}
+}
+
+func isNamedType(typ graphql.Type) bool {
+	switch typ.(type) {
+	case *graphql.NonNull, *graphql.List:
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,111 @@
+package schemabuilder
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/samsarahq/thunder/graphql"
+)
+
+// Example returns an option for a FieldFunc that documents an example of the
+// field's value, for documentation tooling. The example must be of the type
+// the function returns, or of the type it points to:
+//    user.FieldFunc("email", func(u *User) string { return u.Email }, schemabuilder.Example("alice@example.com"))
+//
+// GraphQL introspection has no place for examples, so they are exposed on
+// graphql.Field and by Examples instead.
+func Example(value interface{}) FieldFuncOption {
+	return func(m *method) {
+		m.Example = value
+	}
+}
+
+// ArgExample returns an option for a FieldFunc that documents an example of
+// the argument name, like Example. The example must be of the type of the
+// argument's field in the arguments struct, or of the type it points to.
+func ArgExample(name string, value interface{}) FieldFuncOption {
+	return func(m *method) {
+		if m.ArgExamples == nil {
+			m.ArgExamples = make(map[string]interface{})
+		}
+		m.ArgExamples[name] = value
+	}
+}
+
+// Examples returns the examples documented with Example and ArgExample on the
+// fields reachable from the roots of schema, by path as for Diff, such as
+// "User.email" or "Query.users(limit)".
+func Examples(schema *graphql.Schema) map[string]interface{} {
+	examples := make(map[string]interface{})
+	for name, typ := range schemaTypes(schema) {
+		object, ok := typ.(*graphql.Object)
+		if !ok {
+			continue
+		}
+		for fieldName, field := range object.Fields {
+			path := name + "." + fieldName
+			if field.Example != nil {
+				examples[path] = field.Example
+			}
+			for argName, example := range field.ArgExamples {
+				examples[fmt.Sprintf("%s(%s)", path, argName)] = example
+			}
+		}
+	}
+	return examples
+}
+
+// checkExamples checks that the examples of m are of the types of the
+// function's result and arguments.
+func (funcCtx *funcContext) checkExamples(m *method, argParser *argParser) error {
+	if m.Example != nil {
+		if !funcCtx.hasRet {
+			return fmt.Errorf("example requires a result")
+		}
+		out := funcCtx.funcType.Out(0)
+		if funcCtx.isLazy {
+			out = out.Out(0)
+		}
+		if !exampleOfType(m.Example, out) {
+			return fmt.Errorf("example %v is a %T, not a %s", m.Example, m.Example, out)
+		}
+	}
+
+	for name, example := range m.ArgExamples {
+		field, ok := argStructField(argParser, name)
+		if !ok {
+			return fmt.Errorf("example of unknown argument %s", name)
+		}
+		if !exampleOfType(example, field.Type) {
+			return fmt.Errorf("example %v of argument %s is a %T, not a %s", example, name, example, field.Type)
+		}
+	}
+	return nil
+}
+
+// exampleOfType returns true if example can be a value of typ, or of the type
+// typ points to.
+func exampleOfType(example interface{}, typ reflect.Type) bool {
+	exampleType := reflect.TypeOf(example)
+	if exampleType.AssignableTo(typ) {
+		return true
+	}
+	return typ.Kind() == reflect.Ptr && exampleType.AssignableTo(typ.Elem())
+}
+
+// argStructField returns the field of the arguments struct parsed by
+// argParser that holds the argument name.
+func argStructField(argParser *argParser, name string) (reflect.StructField, bool) {
+	if argParser == nil {
+		return reflect.StructField{}, false
+	}
+	typ := argParser.Type
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		fieldName, _, ok, err := parseArgField(typ, field)
+		if err == nil && ok && fieldName == name {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
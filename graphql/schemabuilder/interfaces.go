@@ -0,0 +1,202 @@
+package schemabuilder
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/samsarahq/thunder/graphql"
+)
+
+// Interface is embedded in a struct to make it a GraphQL interface, whose
+// objects are the struct's other fields, pointers to the objects' structs. The
+// interface's fields are the fields its objects share, with the same types and
+// arguments:
+//    type Node struct {
+//        schemabuilder.Interface
+//        *User
+//        *Post
+//    }
+//
+// A value of the interface is the object of its one non-nil field, and is null
+// if all are nil. Fields returning the struct return the interface, and queries
+// select the objects' other fields with fragments such as "... on User". The
+// interface is named after the struct, or as registered with Schema.Object,
+// and cannot have methods of its own.
+type Interface struct{}
+
+var interfaceMarkerType = reflect.TypeOf(Interface{})
+
+// isInterface returns true if the struct typ embeds Interface.
+func isInterface(typ reflect.Type) bool {
+	for i := 0; i < typ.NumField(); i++ {
+		if field := typ.Field(i); field.Anonymous && field.Type == interfaceMarkerType {
+			return true
+		}
+	}
+	return false
+}
+
+// interfaceArgs are the arguments of an interface's field, as parsed by the
+// field of each of its objects, by object name.
+type interfaceArgs map[string]interface{}
+
+// pendingInterface is an interface whose fields are built once its objects
+// are, by finishInterfaces.
+type pendingInterface struct {
+	iface   *graphql.Interface
+	objects []*graphql.Object
+}
+
+// buildInterface builds the interface of the struct typ embedding Interface.
+func (sb *schemaBuilder) buildInterface(typ reflect.Type, name, description string) error {
+	iface := &graphql.Interface{
+		Name:        name,
+		Description: description,
+		Fields:      make(map[string]*graphql.Field),
+		Types:       make(map[string]*graphql.Object),
+	}
+	sb.types[typ] = iface
+
+	var objects []*graphql.Object
+	var indexes []int
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.Anonymous && field.Type == interfaceMarkerType {
+			continue
+		}
+		if field.PkgPath != "" || field.Type.Kind() != reflect.Ptr || field.Type.Elem().Kind() != reflect.Struct {
+			return fmt.Errorf("bad interface %s: field %s should be an exported pointer to an object", name, field.Name)
+		}
+		fieldType, err := sb.getType(field.Type)
+		if err != nil {
+			return err
+		}
+		object, ok := fieldType.(*graphql.Object)
+		if !ok {
+			return fmt.Errorf("bad interface %s: field %s should be a pointer to an object, not %s", name, field.Name, fieldType)
+		}
+		if _, ok := iface.Types[object.Name]; ok {
+			return fmt.Errorf("bad interface %s: duplicate object %s", name, object.Name)
+		}
+		iface.Types[object.Name] = object
+		objects = append(objects, object)
+		indexes = append(indexes, i)
+	}
+	if len(objects) == 0 {
+		return fmt.Errorf("bad interface %s: should have objects", name)
+	}
+
+	iface.ResolveType = func(value interface{}) (*graphql.Object, interface{}, error) {
+		v := reflect.ValueOf(value)
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return nil, nil, nil
+			}
+			v = v.Elem()
+		}
+		var object *graphql.Object
+		var resolved interface{}
+		for i, index := range indexes {
+			field := v.Field(index)
+			if field.IsNil() {
+				continue
+			}
+			if object != nil {
+				return nil, nil, fmt.Errorf("%s should have one object, but has %s and %s", name, object.Name, objects[i].Name)
+			}
+			object, resolved = objects[i], field.Interface()
+		}
+		return object, resolved, nil
+	}
+
+	sb.interfaces = append(sb.interfaces, pendingInterface{iface: iface, objects: objects})
+	return nil
+}
+
+// finishInterfaces builds the fields of the interfaces built so far, once the
+// fields of their objects are.
+func (sb *schemaBuilder) finishInterfaces() error {
+	for _, pending := range sb.interfaces {
+		iface, objects := pending.iface, pending.objects
+
+		var names []string
+		for name := range objects[0].Fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			fields := make(map[string]*graphql.Field, len(objects))
+			for _, object := range objects {
+				field, ok := object.Fields[name]
+				if !ok || sameFieldTypes(objects[0].Fields[name], field) != nil {
+					break
+				}
+				fields[object.Name] = field
+			}
+			if len(fields) < len(objects) {
+				continue
+			}
+			iface.Fields[name] = interfaceField(objects[0].Fields[name], fields)
+		}
+		if len(iface.Fields) == 0 {
+			return fmt.Errorf("bad interface %s: its objects share no fields", iface.Name)
+		}
+
+		for _, object := range objects {
+			object.Interfaces = append(object.Interfaces, iface)
+		}
+	}
+	sb.interfaces = nil
+	return nil
+}
+
+// interfaceField returns the field of an interface shared by the fields of its
+// objects, by object name, which resolve it. The field parses its arguments
+// with each object's field, so that the objects' fields can be resolved
+// whichever object a value is.
+func interfaceField(first *graphql.Field, fields map[string]*graphql.Field) *graphql.Field {
+	field := *first
+	field.Resolve = nil
+	field.ParseArguments = func(args interface{}) (interface{}, error) {
+		parsed := make(interfaceArgs, len(fields))
+		for name, field := range fields {
+			value, err := field.ParseArguments(args)
+			if err != nil {
+				return nil, err
+			}
+			parsed[name] = value
+		}
+		return parsed, nil
+	}
+
+	for name, objectField := range fields {
+		name, resolve := name, objectField.Resolve
+		objectField.Resolve = func(ctx context.Context, source, args interface{}, selectionSet *graphql.SelectionSet) (interface{}, error) {
+			if parsed, ok := args.(interfaceArgs); ok {
+				args = parsed[name]
+			}
+			return resolve(ctx, source, args, selectionSet)
+		}
+		objectField.Cost = objectArgsFunc(name, objectField.Cost)
+		objectField.CostMultiplier = objectArgsFunc(name, objectField.CostMultiplier)
+	}
+	return &field
+}
+
+// objectArgsFunc wraps f, a function of the arguments of the field of the
+// object name, to also take the arguments of an interface's field. It is nil
+// if f is.
+func objectArgsFunc(name string, f func(args interface{}) int) func(args interface{}) int {
+	if f == nil {
+		return nil
+	}
+	return func(args interface{}) int {
+		if parsed, ok := args.(interfaceArgs); ok {
+			args = parsed[name]
+		}
+		return f(args)
+	}
+}
@@ -0,0 +1,87 @@
+package schemabuilder
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+
+	"github.com/samsarahq/thunder/graphql"
+)
+
+// jsonTypes are the types exposed as the JSON scalar, for arbitrary JSON
+// values such as user-defined metadata.
+var jsonTypes = map[reflect.Type]bool{
+	reflect.TypeOf(json.RawMessage{}):          true,
+	reflect.TypeOf(map[string]interface{}{}):   true,
+	reflect.TypeOf((*interface{})(nil)).Elem(): true,
+}
+
+// isJSONType returns true if typ is exposed as the JSON scalar. Fields of
+// these types return any JSON value as is, and arguments of these types accept
+// any JSON value, delivered decoded as by encoding/json or, for
+// json.RawMessage, encoded. Both are nullable.
+func isJSONType(typ reflect.Type) bool {
+	return jsonTypes[typ]
+}
+
+func (sb *schemaBuilder) jsonScalar() *graphql.Scalar {
+	return &graphql.Scalar{Type: "JSON", SpecifiedByURL: sb.scalarSpecs["JSON"], Serialize: serializeJSON}
+}
+
+// serializeJSON returns a JSON value as the generic maps, slices, and scalars
+// that the executor returns, so that it is encoded and diffed like the rest of
+// the response. Numbers are kept as json.Number, so that they are returned
+// verbatim. Values that are not valid JSON fail.
+func serializeJSON(value interface{}) (interface{}, error) {
+	raw, ok := value.(json.RawMessage)
+	if !ok {
+		var err error
+		if raw, err = json.Marshal(value); err != nil {
+			return nil, err
+		}
+	}
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var decoded interface{}
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil, errors.New("not valid JSON")
+	}
+	if decoder.More() {
+		return nil, errors.New("not valid JSON")
+	}
+	return decoded, nil
+}
+
+// jsonArgParser returns the parser of JSON arguments of type typ.
+func jsonArgParser(typ reflect.Type) *argParser {
+	return &argParser{
+		FromJSON: func(value interface{}, dest reflect.Value) error {
+			if value == nil {
+				return nil
+			}
+			switch typ {
+			case reflect.TypeOf(json.RawMessage{}):
+				raw, err := json.Marshal(value)
+				if err != nil {
+					return err
+				}
+				dest.Set(reflect.ValueOf(json.RawMessage(raw)))
+			case reflect.TypeOf(map[string]interface{}{}):
+				asMap, ok := value.(map[string]interface{})
+				if !ok {
+					return errors.New("not an object")
+				}
+				dest.Set(reflect.ValueOf(asMap))
+			default:
+				dest.Set(reflect.ValueOf(value))
+			}
+			return nil
+		},
+		Type: typ,
+	}
+}
@@ -0,0 +1,106 @@
+package schemabuilder
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/samsarahq/thunder/graphql"
+)
+
+// MutationInput describes a call to a field on the mutation root.
+type MutationInput struct {
+	Ctx  context.Context
+	Name string
+	Args interface{}
+}
+
+type MutationMiddlewareFunc func(input *MutationInput, next MutationNextFunc) (interface{}, error)
+type MutationNextFunc func(input *MutationInput) (interface{}, error)
+
+// AddMutationMiddleware registers a middleware that wraps every field on the
+// mutation root, but not query fields or the fields of mutation results.
+// Middlewares run in the order they are added, and see the field's name and
+// parsed arguments, which makes them suitable for auditing writes.
+func (s *Schema) AddMutationMiddleware(middleware MutationMiddlewareFunc) {
+	s.mutationMiddlewares = append(s.mutationMiddlewares, middleware)
+}
+
+func wrapMutationFields(mutation *graphql.Object, middlewares []MutationMiddlewareFunc) {
+	if len(middlewares) == 0 {
+		return
+	}
+
+	for name, field := range mutation.Fields {
+		name, resolve := name, field.Resolve
+		field.Resolve = func(ctx context.Context, source, args interface{}, selectionSet *graphql.SelectionSet) (interface{}, error) {
+			var run func(index int, input *MutationInput) (interface{}, error)
+			run = func(index int, input *MutationInput) (interface{}, error) {
+				if index >= len(middlewares) {
+					return resolve(input.Ctx, source, input.Args, selectionSet)
+				}
+				return middlewares[index](input, func(input *MutationInput) (interface{}, error) {
+					return run(index+1, input)
+				})
+			}
+
+			return run(0, &MutationInput{Ctx: ctx, Name: name, Args: args})
+		}
+	}
+}
+
+// FieldInput describes a resolution of a field of an object, whose value is
+// Source.
+type FieldInput struct {
+	Ctx    context.Context
+	Object string
+	Name   string
+	Source interface{}
+	Args   interface{}
+	// Field is the field being resolved, with its type and options.
+	Field *graphql.Field
+}
+
+type FieldMiddlewareFunc func(input *FieldInput, next FieldNextFunc) (interface{}, error)
+type FieldNextFunc func(input *FieldInput) (interface{}, error)
+
+// AddFieldMiddleware registers a middleware that wraps the resolution of every
+// field of every object, including the roots, for concerns such as per-field
+// authorization or redacting errors. Middlewares run in the order they are
+// added, before any mutation middleware, and see the object, its field, and
+// the field's parsed arguments. For a field whose function returns a lazy
+// func, next returns the func before it is called.
+func (s *Schema) AddFieldMiddleware(middleware FieldMiddlewareFunc) {
+	s.fieldMiddlewares = append(s.fieldMiddlewares, middleware)
+}
+
+func wrapFields(types map[reflect.Type]graphql.Type, middlewares []FieldMiddlewareFunc) {
+	if len(middlewares) == 0 {
+		return
+	}
+
+	for _, typ := range types {
+		object, ok := typ.(*graphql.Object)
+		if !ok {
+			continue
+		}
+		for name, field := range object.Fields {
+			objectName, name, field, resolve := object.Name, name, field, field.Resolve
+			if resolve == nil {
+				continue
+			}
+			field.Resolve = func(ctx context.Context, source, args interface{}, selectionSet *graphql.SelectionSet) (interface{}, error) {
+				var run func(index int, input *FieldInput) (interface{}, error)
+				run = func(index int, input *FieldInput) (interface{}, error) {
+					if index >= len(middlewares) {
+						return resolve(input.Ctx, input.Source, input.Args, selectionSet)
+					}
+					return middlewares[index](input, func(input *FieldInput) (interface{}, error) {
+						return run(index+1, input)
+					})
+				}
+
+				return run(0, &FieldInput{Ctx: ctx, Object: objectName, Name: name, Source: source, Args: args, Field: field})
+			}
+		}
+	}
+}
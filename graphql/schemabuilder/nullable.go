@@ -0,0 +1,114 @@
+package schemabuilder
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+
+	"github.com/samsarahq/thunder/graphql"
+)
+
+// A nullWrapper describes a struct type that wraps a nullable scalar, such as
+// sql.NullString, with the indices of its value and Valid fields.
+type nullWrapper struct {
+	value int
+	valid int
+}
+
+// defaultNullWrappers are the wrappers of database/sql, which are recognized
+// without being registered.
+var defaultNullWrappers = map[reflect.Type]nullWrapper{
+	reflect.TypeOf(sql.NullString{}):  mustNullWrapper(reflect.TypeOf(sql.NullString{})),
+	reflect.TypeOf(sql.NullInt64{}):   mustNullWrapper(reflect.TypeOf(sql.NullInt64{})),
+	reflect.TypeOf(sql.NullFloat64{}): mustNullWrapper(reflect.TypeOf(sql.NullFloat64{})),
+	reflect.TypeOf(sql.NullBool{}):    mustNullWrapper(reflect.TypeOf(sql.NullBool{})),
+}
+
+// NullWrapper registers a struct type that wraps a nullable scalar, like the
+// sql.Null* types, so that fields of its type are exposed as the nullable
+// scalar. The struct should have a Valid bool field and one other exported
+// field holding the value, and is returned as null when Valid is false:
+//    type NullUUID struct {
+//        UUID  string
+//        Valid bool
+//    }
+//    schema.NullWrapper(NullUUID{})
+//
+// The wrappers of database/sql, such as sql.NullString and sql.NullInt64, are
+// recognized without being registered.
+func (s *Schema) NullWrapper(val interface{}) {
+	typ := reflect.TypeOf(val)
+	wrapper, err := getNullWrapper(typ)
+	if err != nil {
+		panic(err.Error())
+	}
+	if s.nullWrappers == nil {
+		s.nullWrappers = make(map[reflect.Type]nullWrapper)
+	}
+	s.nullWrappers[typ] = wrapper
+}
+
+func mustNullWrapper(typ reflect.Type) nullWrapper {
+	wrapper, err := getNullWrapper(typ)
+	if err != nil {
+		panic(err.Error())
+	}
+	return wrapper
+}
+
+// getNullWrapper finds the value and Valid fields of the wrapper typ.
+func getNullWrapper(typ reflect.Type) (nullWrapper, error) {
+	if typ.Kind() != reflect.Struct {
+		return nullWrapper{}, fmt.Errorf("null wrapper %s should be a struct", typ)
+	}
+
+	wrapper := nullWrapper{value: -1, valid: -1}
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		if field.Name == "Valid" && field.Type.Kind() == reflect.Bool {
+			wrapper.valid = i
+			continue
+		}
+		if wrapper.value != -1 {
+			return nullWrapper{}, fmt.Errorf("null wrapper %s should have a single value field", typ)
+		}
+		if _, ok := getScalar(field.Type); !ok {
+			return nullWrapper{}, fmt.Errorf("null wrapper %s should wrap a scalar, not %s", typ, field.Type)
+		}
+		wrapper.value = i
+	}
+	if wrapper.valid == -1 || wrapper.value == -1 {
+		return nullWrapper{}, fmt.Errorf("null wrapper %s should have a Valid bool field and a value field", typ)
+	}
+	return wrapper, nil
+}
+
+// getNullWrapperType returns the nullable scalar type of t if it is a
+// registered or default null wrapper.
+func (sb *schemaBuilder) getNullWrapperType(t reflect.Type) (*graphql.Scalar, bool) {
+	wrapper, ok := sb.nullWrappers[t]
+	if !ok {
+		wrapper, ok = defaultNullWrappers[t]
+	}
+	if !ok {
+		return nil, false
+	}
+
+	scalar, _ := sb.getScalarType(t.Field(wrapper.value).Type)
+	serialize := scalar.Serialize
+	scalar.Serialize = func(value interface{}) (interface{}, error) {
+		v := reflect.ValueOf(value)
+		if !v.Field(wrapper.valid).Bool() {
+			return nil, nil
+		}
+		inner := v.Field(wrapper.value).Interface()
+		if serialize != nil {
+			return serialize(inner)
+		}
+		return inner, nil
+	}
+	return scalar, true
+}
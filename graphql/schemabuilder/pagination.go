@@ -14,6 +14,9 @@ type Connection struct {
 	TotalCount int64
 	Edges      []Edge
 	PageInfo   PageInfo
+
+	// count, if set, computes the total count in place of TotalCount.
+	count func(ctx context.Context) (int64, error)
 }
 
 // PageInfo contains information for pagination on a connection type. The list of Pages is used for
@@ -254,7 +257,15 @@ func getConnection(key string, nodes []interface{}, args ConnectionArgs) (Connec
 		if keyValue.Kind() == reflect.Ptr {
 			keyValue = keyValue.Elem()
 		}
-		keyString := []byte(fmt.Sprintf("%v", keyValue.FieldByName(key).Interface()))
+		keyField, ok := keyValue.Type().FieldByName(key)
+		if !ok {
+			return Connection{}, fmt.Errorf("key field %s doesn't exist on struct", key)
+		}
+		keyFieldValue, ok := fieldByIndex(keyValue, keyField.Index)
+		if !ok {
+			return Connection{}, fmt.Errorf("key field %s is promoted through a nil embedded struct pointer", key)
+		}
+		keyString := []byte(fmt.Sprintf("%v", keyFieldValue.Interface()))
 		cursorVal := base64.StdEncoding.EncodeToString(keyString)
 		if (int64(i) % lim) == 0 {
 			pages = append(pages, cursorVal)
@@ -285,12 +296,16 @@ func getConnection(key string, nodes []interface{}, args ConnectionArgs) (Connec
 // Connection Spec. The field is registered as a Connection Type and first, last, before and after
 // are automatically added as arguments to the function. The return type to the function must be a
 // list. The element of the list is wrapped as a Node Type.
-func (o *Object) PaginateFieldFunc(name string, f interface{}) {
-	o.paginatedFields = append(o.paginatedFields,
-		paginationObject{
-			Name: name,
-			Fn:   f,
-		})
+func (o *Object) PaginateFieldFunc(name string, f interface{}, options ...PaginationOption) {
+	p := paginationObject{
+		Name: name,
+		Fn:   f,
+	}
+	for _, option := range options {
+		option(&p)
+	}
+	o.paginatedFields = append(o.paginatedFields, p)
+	o.fieldOrder = append(o.fieldOrder, name)
 }
 
 func (funcCtx *funcContext) consumePaginatedArgs(sb *schemaBuilder, in []reflect.Type) (*argParser, graphql.Type, []reflect.Type, error) {
@@ -338,10 +353,10 @@ func (sb *schemaBuilder) getKeyFieldOnStruct(nodeType reflect.Type) (string, err
 
 // buildPaginatedField corresponds to buildFunction on a paginated type. It wraps the return result
 // of f in a connection type.
-func (sb *schemaBuilder) buildPaginatedField(typ reflect.Type, f interface{}) (*graphql.Field, error) {
+func (sb *schemaBuilder) buildPaginatedField(typ reflect.Type, field paginationObject) (*graphql.Field, error) {
 	funcCtx := &funcContext{typ: typ}
 
-	fun, err := funcCtx.getFuncVal(&method{Fn: f})
+	fun, err := funcCtx.getFuncVal(&method{Fn: field.Fn})
 	if err != nil {
 		return nil, err
 	}
@@ -349,6 +364,11 @@ func (sb *schemaBuilder) buildPaginatedField(typ reflect.Type, f interface{}) (*
 	in := funcCtx.getFuncInputTypes()
 	in = funcCtx.consumeContextAndSource(in)
 
+	var userArgsType reflect.Type
+	if len(in) > 0 && in[0] != selectionSetType {
+		userArgsType = in[0]
+	}
+
 	argParser, argType, in, err := funcCtx.consumePaginatedArgs(sb, in)
 	if err != nil {
 		return nil, err
@@ -384,6 +404,14 @@ func (sb *schemaBuilder) buildPaginatedField(typ reflect.Type, f interface{}) (*
 		return nil, err
 	}
 
+	var count func(ctx context.Context, source, args interface{}) (int64, error)
+	if field.CountFn != nil {
+		if count, err = buildCountFunc(typ, field.CountFn, userArgsType); err != nil {
+			return nil, fmt.Errorf("bad count func: %s", err)
+		}
+		retType = countConnType(retType)
+	}
+
 	args, err := funcCtx.argsTypeMap(argType)
 
 	ret := &graphql.Field{
@@ -398,23 +426,99 @@ func (sb *schemaBuilder) buildPaginatedField(typ reflect.Type, f interface{}) (*
 				argsVal = reflect.ValueOf(val.Args).Elem().Interface()
 			}
 
-			in := funcCtx.prepareResolveArgs(source, argsVal, ctx)
+			// BatchPaginateFieldFunc reads the pagination arguments from the
+			// context.
+			ctx = context.WithValue(ctx, connectionArgsKey{}, val)
+			in := funcCtx.prepareResolveArgs(source, argsVal, selectionSet, ctx)
 
 			// Call the function.
 			out := fun.Call(in)
 
-			return funcCtx.extractPaginatedRetAndErr(nodeKey, out, args, retType)
+			result, err := funcCtx.extractPaginatedRetAndErr(nodeKey, out, args, retType)
+			if err != nil || count == nil {
+				return result, err
+			}
+			connection := result.(Connection)
+			connection.count = func(ctx context.Context) (int64, error) {
+				return count(ctx, source, argsVal)
+			}
+			return connection, nil
 
 		},
 		Args:           args,
 		Type:           retType,
 		ParseArguments: argParser.Parse,
 		Expensive:      funcCtx.hasContext,
+		CostMultiplier: pageSize,
 	}
 
 	return ret, nil
 }
 
+// buildCountFunc wraps the CountFunc f of a paginated field on typ whose
+// arguments are of type argsType, or nil if it takes none.
+func buildCountFunc(typ reflect.Type, f interface{}, argsType reflect.Type) (func(ctx context.Context, source, args interface{}) (int64, error), error) {
+	funcCtx := &funcContext{typ: typ}
+
+	fun, err := funcCtx.getFuncVal(&method{Fn: f})
+	if err != nil {
+		return nil, err
+	}
+
+	in := funcCtx.getFuncInputTypes()
+	in = funcCtx.consumeContextAndSource(in)
+	if len(in) > 0 && in[0] == argsType {
+		funcCtx.hasArgs = true
+		in = in[1:]
+	}
+	if len(in) != 0 {
+		return nil, fmt.Errorf("%s arguments should be [context][, [*]%s][, args] with the paginated func's args", funcCtx.funcType, typ)
+	}
+
+	out := funcCtx.funcType
+	if out.NumOut() < 1 || out.NumOut() > 2 || out.Out(0) != reflect.TypeOf(int64(0)) || (out.NumOut() == 2 && out.Out(1) != errType) {
+		return nil, fmt.Errorf("%s return values should be int64[, error]", funcCtx.funcType)
+	}
+
+	return func(ctx context.Context, source, args interface{}) (int64, error) {
+		out := fun.Call(funcCtx.prepareResolveArgs(source, args, nil, ctx))
+		if len(out) == 2 && !out[1].IsNil() {
+			return 0, out[1].Interface().(error)
+		}
+		return out[0].Int(), nil
+	}, nil
+}
+
+// countConnType returns a copy of a connection type whose totalCount field calls
+// the connection's count function. The copy keeps connections of the same node
+// type without a count function from resolving totalCount as expensive.
+func countConnType(connType graphql.Type) graphql.Type {
+	object := *connType.(*graphql.NonNull).Type.(*graphql.Object)
+	fields := make(map[string]*graphql.Field, len(object.Fields))
+	for name, field := range object.Fields {
+		fields[name] = field
+	}
+	fields["totalCount"] = countField(fields["totalCount"])
+	object.Fields = fields
+	return &graphql.NonNull{Type: &object}
+}
+
+// countField wraps the totalCount field of a connection to call the
+// connection's count function, if it has one.
+func countField(field *graphql.Field) *graphql.Field {
+	return &graphql.Field{
+		Resolve: func(ctx context.Context, source, args interface{}, selectionSet *graphql.SelectionSet) (interface{}, error) {
+			if connection, ok := source.(Connection); ok && connection.count != nil {
+				return connection.count(ctx)
+			}
+			return field.Resolve(ctx, source, args, selectionSet)
+		},
+		Type:           field.Type,
+		ParseArguments: field.ParseArguments,
+		Expensive:      true,
+	}
+}
+
 func (funcCtx *funcContext) extractPaginatedRetAndErr(nodeKey string, out []reflect.Value, args interface{}, retType graphql.Type) (interface{}, error) {
 	var result interface{}
 	connectionArgs, _ := args.(ConnectionArgs)
@@ -495,6 +599,11 @@ func (sb *schemaBuilder) buildPaginatedArgParser(originalArgType reflect.Type) (
 	var nestedArgType graphql.Type
 	var err error
 	if originalArgType != nil {
+		for i := 0; i < originalArgType.NumField(); i++ {
+			if originalArgType.Field(i).Tag.Get("context") != "" {
+				return nil, nil, fmt.Errorf("context arguments are not supported on paginated fields")
+			}
+		}
 		nestedArgParser, nestedArgType, err = sb.makeStructParser(originalArgType)
 		if err != nil {
 			return nil, nil, fmt.Errorf("failed to build args for paginated field")
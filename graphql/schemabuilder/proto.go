@@ -0,0 +1,148 @@
+package schemabuilder
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/samsarahq/thunder/graphql"
+)
+
+// RegisterProto registers a message generated by protoc-gen-go as an object,
+// named after its Go type. Its fields are read from the generated struct tags
+// rather than from graphql tags: each field is named after its json_name,
+// internal XXX_ fields are skipped, and proto3 optional fields, which are
+// generated as pointers, are nullable.
+//
+// Each case of a oneof is exposed as a nullable field that is set only when
+// the case is. The cases are found with the message's XXX_OneofWrappers
+// method if it has one, and can otherwise be passed as oneofWrappers, such as
+// &pb.Contact_Email{}. Messages nested in msg should be registered too.
+//
+// RegisterProto does not import the protobuf runtime, so msg can be any
+// pointer to a generated message struct.
+func (s *Schema) RegisterProto(msg interface{}, oneofWrappers ...interface{}) *Object {
+	typ := reflect.TypeOf(msg)
+	if typ.Kind() != reflect.Ptr || typ.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("proto message %T should be a pointer to a struct", msg))
+	}
+
+	if wrappers, ok := msg.(interface {
+		XXX_OneofWrappers() []interface{}
+	}); ok {
+		oneofWrappers = append(wrappers.XXX_OneofWrappers(), oneofWrappers...)
+	}
+
+	object := s.Object(typ.Elem().Name(), reflect.Zero(typ.Elem()).Interface())
+	object.proto = true
+	object.oneofWrappers = append(object.oneofWrappers, oneofWrappers...)
+	return object
+}
+
+// protoFieldName returns the GraphQL name of a field with the protobuf tag
+// tag, which looks like "bytes,2,opt,name=user_id,json=userId,proto3".
+func protoFieldName(tag string) string {
+	var name, jsonName string
+	for _, part := range strings.Split(tag, ",") {
+		if strings.HasPrefix(part, "name=") {
+			name = strings.TrimPrefix(part, "name=")
+		} else if strings.HasPrefix(part, "json=") {
+			jsonName = strings.TrimPrefix(part, "json=")
+		}
+	}
+	if jsonName != "" {
+		return jsonName
+	}
+	return name
+}
+
+// buildProtoFields adds a field to object for every field of the proto
+// message typ, and for every case of its oneofs.
+func (sb *schemaBuilder) buildProtoFields(typ reflect.Type, object *graphql.Object, oneofWrappers []interface{}) error {
+	addField := func(name string, field *graphql.Field) error {
+		if _, ok := object.Fields[name]; ok {
+			return fmt.Errorf("bad type %s: two fields named %s", typ, name)
+		}
+		object.Fields[name] = field
+		if sb.preserveFieldOrder {
+			object.FieldOrder = append(object.FieldOrder, name)
+		}
+		return nil
+	}
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		if tag := field.Tag.Get("protobuf"); tag != "" {
+			name := protoFieldName(tag)
+			built, err := sb.buildField(field)
+			if err != nil {
+				return fmt.Errorf("bad field %s on type %s: %s", name, typ, err)
+			}
+			if err := addField(name, built); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if field.Tag.Get("protobuf_oneof") == "" {
+			// Internal fields, such as XXX_unrecognized.
+			continue
+		}
+
+		found := false
+		for _, wrapper := range oneofWrappers {
+			wrapperType := reflect.TypeOf(wrapper)
+			if !wrapperType.Implements(field.Type) {
+				continue
+			}
+			found = true
+
+			caseField := wrapperType.Elem().Field(0)
+			name := protoFieldName(caseField.Tag.Get("protobuf"))
+			built, err := sb.buildOneofField(field, wrapperType, caseField)
+			if err != nil {
+				return fmt.Errorf("bad oneof field %s on type %s: %s", name, typ, err)
+			}
+			if err := addField(name, built); err != nil {
+				return err
+			}
+		}
+		if !found {
+			return fmt.Errorf("bad type %s: no wrappers registered for oneof %s", typ, field.Name)
+		}
+	}
+	return nil
+}
+
+// buildOneofField builds a nullable field for the case wrapperType of the
+// oneof field, which resolves to the case's value if the oneof is set to it.
+func (sb *schemaBuilder) buildOneofField(field reflect.StructField, wrapperType reflect.Type, caseField reflect.StructField) (*graphql.Field, error) {
+	retType, err := sb.getType(caseField.Type)
+	if err != nil {
+		return nil, err
+	}
+	if nonNull, ok := retType.(*graphql.NonNull); ok {
+		retType = nonNull.Type
+	}
+
+	return &graphql.Field{
+		Resolve: func(ctx context.Context, source, args interface{}, selectionSet *graphql.SelectionSet) (interface{}, error) {
+			value := reflect.ValueOf(source)
+			if value.Kind() == reflect.Ptr {
+				value = value.Elem()
+			}
+			oneof := value.FieldByIndex(field.Index)
+			if oneof.IsNil() || oneof.Elem().Type() != wrapperType || oneof.Elem().IsNil() {
+				return nil, nil
+			}
+			return oneof.Elem().Elem().Field(0).Interface(), nil
+		},
+		Type:           retType,
+		ParseArguments: nilParseArguments,
+	}, nil
+}
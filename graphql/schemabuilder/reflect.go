@@ -7,8 +7,11 @@ import (
 	"errors"
 	"fmt"
 	"reflect"
+	"regexp"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"unicode"
 
@@ -187,7 +190,7 @@ var scalarArgParsers = map[reflect.Type]*argParser{
 			}
 			bytes, err := base64.StdEncoding.DecodeString(asString)
 			if err != nil {
-				return err
+				return errors.New("not a base64 string")
 			}
 			dest.Set(reflect.ValueOf(bytes).Convert(dest.Type()))
 			return nil
@@ -232,6 +235,44 @@ func getScalarArgParser(typ reflect.Type) (*argParser, graphql.Type, bool) {
 	return nil, nil, false
 }
 
+// wrapCoerceStringParser wraps the parser of a bool or number scalar to also
+// accept its value as a string, such as "true" or "42".
+func wrapCoerceStringParser(inner *argParser) *argParser {
+	kind := inner.Type.Kind()
+	switch kind {
+	case reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+	default:
+		return inner
+	}
+
+	return &argParser{
+		FromJSON: func(value interface{}, dest reflect.Value) error {
+			asString, ok := value.(string)
+			if !ok {
+				return inner.FromJSON(value, dest)
+			}
+
+			if kind == reflect.Bool {
+				asBool, err := strconv.ParseBool(asString)
+				if err != nil {
+					return fmt.Errorf("cannot coerce %q to a bool", asString)
+				}
+				return inner.FromJSON(asBool, dest)
+			}
+
+			asFloat, err := strconv.ParseFloat(asString, 64)
+			if err != nil {
+				return fmt.Errorf("cannot coerce %q to a number", asString)
+			}
+			return inner.FromJSON(asFloat, dest)
+		},
+		Type: inner.Type,
+	}
+}
+
 func (sb *schemaBuilder) getEnumArgParser(typ reflect.Type) (*argParser, graphql.Type, error) {
 	var values []string
 	for mapping := range sb.enumMappings[typ].Map {
@@ -248,7 +289,7 @@ func (sb *schemaBuilder) getEnumArgParser(typ reflect.Type) (*argParser, graphql
 		}
 		dest.Set(reflect.ValueOf(val).Convert(dest.Type()))
 		return nil
-	}, Type: typ}, &graphql.Enum{Type: typ.Name(), Values: values, ReverseMap: sb.enumMappings[typ].ReverseMap}, nil
+	}, Type: typ}, &graphql.Enum{Type: typ.Name(), Values: values, ReverseMap: sb.enumMappings[typ].ReverseMap, ValueDirectives: sb.enumMappings[typ].Directives}, nil
 
 }
 
@@ -259,12 +300,17 @@ func init() {
 }
 
 type argField struct {
-	field    reflect.StructField
-	parser   *argParser
-	optional bool
+	field       reflect.StructField
+	parser      *argParser
+	optional    bool
+	constraints []argConstraint
 }
 
 func (sb *schemaBuilder) makeArgParser(typ reflect.Type) (*argParser, graphql.Type, error) {
+	if isJSONType(typ) {
+		return jsonArgParser(typ), sb.jsonScalar(), nil
+	}
+
 	if typ.Kind() == reflect.Ptr {
 		parser, argType, err := sb.makeArgParserInner(typ.Elem())
 		if err != nil {
@@ -281,17 +327,56 @@ func (sb *schemaBuilder) makeArgParser(typ reflect.Type) (*argParser, graphql.Ty
 }
 
 func (sb *schemaBuilder) makeArgParserInner(typ reflect.Type) (*argParser, graphql.Type, error) {
+	// JSON types behind a pointer, such as *json.RawMessage, are parsed as
+	// their JSON type.
+	if isJSONType(typ) {
+		return jsonArgParser(typ), sb.jsonScalar(), nil
+	}
+
+	if scalar, ok := sb.getCustomScalarType(typ); ok {
+		return sb.customScalarArgParser(typ), scalar, nil
+	}
+
+	if reflect.PtrTo(typ).Implements(unmarshalerType) {
+		if typ.Name() == "" {
+			return nil, nil, fmt.Errorf("bad arg type %s: an Unmarshaler should be a named type", typ)
+		}
+		return unmarshalerArgParser(typ), &graphql.Scalar{Type: typ.Name(), SpecifiedByURL: sb.scalarSpecs[typ.Name()]}, nil
+	}
+
 	if sb.enumMappings[typ] != nil {
 		parser, argType, _ := sb.getEnumArgParser(typ)
 		return parser, argType, nil
 	}
 
+	if sb.idTypes[typ] {
+		scalar, _ := sb.getScalarType(typ)
+		return &argParser{FromJSON: parseID, Type: typ}, scalar, nil
+	}
+
+	if isTimeType(typ) {
+		if parser, ok := sb.timeArgParser(typ); ok {
+			scalar, _ := sb.getScalarType(typ)
+			return parser, scalar, nil
+		}
+	}
+
 	if parser, argType, ok := getScalarArgParser(typ); ok {
+		scalar := argType.(*graphql.Scalar)
+		scalar.SpecifiedByURL = sb.scalarSpecs[scalar.Type]
+		if sb.coerceStringArgs {
+			parser = wrapCoerceStringParser(parser)
+		}
 		return parser, argType, nil
 	}
 
 	switch typ.Kind() {
 	case reflect.Struct:
+		for i := 0; i < typ.NumField(); i++ {
+			if typ.Field(i).Tag.Get("context") != "" {
+				return nil, nil, fmt.Errorf("bad arg type %s: context arguments are only supported on the arguments struct itself", typ)
+			}
+		}
 		parser, argType, err := sb.makeStructParser(typ)
 		if err != nil {
 			return nil, nil, err
@@ -326,6 +411,78 @@ func wrapPtrParser(inner *argParser) *argParser {
 	}
 }
 
+// An Unmarshaler is an argument type that parses its own value, such as a
+// DateRange parsed from a string. An argument of a type whose pointer
+// implements Unmarshaler is exposed as a scalar named after the type, and
+// UnmarshalGraphQL is called with its value as decoded from JSON, instead of
+// parsing the value by reflection. An error fails the argument.
+type Unmarshaler interface {
+	UnmarshalGraphQL(value interface{}) error
+}
+
+var unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+
+func unmarshalerArgParser(typ reflect.Type) *argParser {
+	return &argParser{
+		FromJSON: func(value interface{}, dest reflect.Value) error {
+			ptr := reflect.New(typ)
+			if err := ptr.Interface().(Unmarshaler).UnmarshalGraphQL(value); err != nil {
+				return err
+			}
+			dest.Set(ptr.Elem())
+			return nil
+		},
+		Type: typ,
+	}
+}
+
+// parseArgField parses the tags of a field of the arguments struct typ. It
+// returns false for fields that are not set by clients.
+func parseArgField(typ reflect.Type, field reflect.StructField) (string, []argConstraint, bool, error) {
+	if field.PkgPath != "" && !field.Anonymous {
+		return "", nil, false, nil
+	}
+	if field.Anonymous {
+		return "", nil, false, fmt.Errorf("bad arg type %s: anonymous fields not supported", typ)
+	}
+	if field.Tag.Get("context") != "" {
+		// Set from the context when resolving; see Schema.ContextArg.
+		return "", nil, false, nil
+	}
+	tags := strings.Split(field.Tag.Get("graphql"), ",")
+	var name string
+	if len(tags) > 0 {
+		name = tags[0]
+	}
+	if name == "" {
+		name = makeGraphql(field.Name)
+	}
+	if name == "-" {
+		return "", nil, false, nil
+	}
+
+	var key bool
+	var constraints []argConstraint
+
+	if len(tags) > 1 {
+		for i, tag := range tags[1:] {
+			if isConstraintTag(tag) {
+				var err error
+				if constraints, err = parseArgConstraints(field.Type, tags[1+i:]); err != nil {
+					return "", nil, false, fmt.Errorf("bad arg type %s: field %s: %s", typ, name, err)
+				}
+				break
+			}
+			if tag != "key" || key {
+				return "", nil, false, fmt.Errorf("bad type %s: field %s has unexpected tag %s", typ, name, tag)
+			}
+			key = true
+		}
+	}
+
+	return name, constraints, true, nil
+}
+
 func (sb *schemaBuilder) makeStructParser(typ reflect.Type) (*argParser, graphql.Type, error) {
 	fields := make(map[string]argField)
 	argType := &graphql.InputObject{
@@ -342,35 +499,14 @@ func (sb *schemaBuilder) makeStructParser(typ reflect.Type) (*argParser, graphql
 
 	for i := 0; i < typ.NumField(); i++ {
 		field := typ.Field(i)
-		if field.PkgPath != "" && !field.Anonymous {
-			continue
-		}
-		if field.Anonymous {
-			return nil, nil, fmt.Errorf("bad arg type %s: anonymous fields not supported", typ)
-		}
-		tags := strings.Split(field.Tag.Get("graphql"), ",")
-		var name string
-		if len(tags) > 0 {
-			name = tags[0]
-		}
-		if name == "" {
-			name = makeGraphql(field.Name)
+		name, constraints, ok, err := parseArgField(typ, field)
+		if err != nil {
+			return nil, nil, err
 		}
-		if name == "-" {
+		if !ok {
 			continue
 		}
 
-		var key bool
-
-		if len(tags) > 1 {
-			for _, tag := range tags[1:] {
-				if tag != "key" || key {
-					return nil, nil, fmt.Errorf("bad type %s: field %s has unexpected tag %s", typ, name, tag)
-				}
-				key = true
-			}
-		}
-
 		if _, ok := fields[name]; ok {
 			return nil, nil, fmt.Errorf("bad arg type %s: duplicate field %s", typ, name)
 		}
@@ -380,8 +516,9 @@ func (sb *schemaBuilder) makeStructParser(typ reflect.Type) (*argParser, graphql
 		}
 
 		fields[name] = argField{
-			field:  field,
-			parser: parser,
+			field:       field,
+			parser:      parser,
+			constraints: constraints,
 		}
 		argType.InputFields[name] = fieldArgTyp
 	}
@@ -399,6 +536,9 @@ func (sb *schemaBuilder) makeStructParser(typ reflect.Type) (*argParser, graphql
 				if err := field.parser.FromJSON(value, fieldDest); err != nil {
 					return fmt.Errorf("%s: %s", name, err)
 				}
+				if err := checkArgConstraints(fieldDest, field.constraints); err != nil {
+					return fmt.Errorf("%s: %s", name, err)
+				}
 			}
 			for name := range asMap {
 				if _, ok := fields[name]; !ok {
@@ -429,7 +569,7 @@ func (sb *schemaBuilder) makeSliceParser(typ reflect.Type) (*argParser, graphql.
 
 			for i, value := range asSlice {
 				if err := inner.FromJSON(value, dest.Index(i)); err != nil {
-					return err
+					return fmt.Errorf("%d: %s", i, err)
 				}
 			}
 
@@ -440,14 +580,32 @@ func (sb *schemaBuilder) makeSliceParser(typ reflect.Type) (*argParser, graphql.
 }
 
 type schemaBuilder struct {
-	types        map[reflect.Type]graphql.Type
-	objects      map[reflect.Type]*Object
-	enumMappings map[reflect.Type]*EnumMapping
+	types         map[reflect.Type]graphql.Type
+	objects       map[reflect.Type]*Object
+	enumMappings  map[reflect.Type]*EnumMapping
+	scalarSpecs   map[string]string
+	contextArgs   map[string]ContextArgExtractor
+	idTypes       map[reflect.Type]bool
+	nullWrappers  map[reflect.Type]nullWrapper
+	customScalars map[reflect.Type]customScalar
+
+	coerceStringArgs       bool
+	preserveFieldOrder     bool
+	promoteEmbeddedStructs bool
+	timeFormat             string
+	timeInUTC              bool
+	versionFunc            func(ctx context.Context) string
+
+	// interfaces are the interfaces whose fields are not built yet.
+	interfaces []pendingInterface
 }
 
 type EnumMapping struct {
 	Map        map[string]interface{}
 	ReverseMap map[interface{}]string
+	// Directives are the directives applied to values with
+	// Schema.EnumValueDirective, by value.
+	Directives map[string][]graphql.Directive
 }
 
 var errType reflect.Type
@@ -487,6 +645,13 @@ func (funcCtx *funcContext) consumeContextAndSource(in []reflect.Type) []reflect
 		funcCtx.hasSource = true
 		funcCtx.isPtrFunc = in[0] == ptr
 		in = in[1:]
+	} else if len(in) > 0 && in[0].Kind() == reflect.Interface && ptr.Implements(in[0]) {
+		// A source of an interface type that the object implements, so that
+		// one function can be shared by several objects. The source is passed
+		// as a pointer if only the pointer type implements the interface.
+		funcCtx.hasSource = true
+		funcCtx.isPtrFunc = !funcCtx.typ.Implements(in[0])
+		in = in[1:]
 	}
 
 	return in
@@ -501,7 +666,13 @@ func (funcCtx *funcContext) parseReturnSignature(m *method) (err error) {
 
 	if len(out) > 0 && out[0] != errType {
 		funcCtx.hasRet = true
+		funcCtx.isLazy = isLazyFunc(out[0])
 		out = out[1:]
+
+		if len(out) > 0 && out[0] == reflect.TypeOf(true) {
+			funcCtx.hasPresence = true
+			out = out[1:]
+		}
 	}
 
 	if len(out) > 0 && out[0] == errType {
@@ -510,7 +681,21 @@ func (funcCtx *funcContext) parseReturnSignature(m *method) (err error) {
 	}
 
 	if len(out) != 0 {
-		err = fmt.Errorf("%s return values should [result][, error]", funcCtx.funcType)
+		err = fmt.Errorf("%s return values should [result][, ok][, error]", funcCtx.funcType)
+		return
+	}
+
+	if m.Flatten && funcCtx.isLazy {
+		err = fmt.Errorf("%s returns a lazy result, so it cannot be flattened", funcCtx.funcType)
+		return
+	}
+	if funcCtx.hasPresence && funcCtx.isLazy {
+		err = fmt.Errorf("%s returns a lazy result, so it cannot also return an ok bool", funcCtx.funcType)
+		return
+	}
+
+	if funcCtx.hasPresence && m.MarkedNonNullable {
+		err = fmt.Errorf("%s returns an ok bool, so it cannot be marked non-nullable", funcCtx.funcType)
 		return
 	}
 
@@ -522,6 +707,62 @@ func (funcCtx *funcContext) parseReturnSignature(m *method) (err error) {
 
 }
 
+// contextArg is a field of an arguments struct that is set from the context.
+type contextArg struct {
+	name    string
+	index   []int
+	extract ContextArgExtractor
+}
+
+// getContextArgs finds the fields of the arguments struct typ that are set
+// from the context.
+func (sb *schemaBuilder) getContextArgs(typ reflect.Type) ([]contextArg, error) {
+	var args []contextArg
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name := field.Tag.Get("context")
+		if name == "" {
+			continue
+		}
+		extract, ok := sb.contextArgs[name]
+		if !ok {
+			return nil, fmt.Errorf("bad arg type %s: field %s uses unregistered context argument %s", typ, field.Name, name)
+		}
+		args = append(args, contextArg{name: name, index: field.Index, extract: extract})
+	}
+	return args, nil
+}
+
+// setContextArgs returns a copy of args with its context-sourced fields set.
+func (funcCtx *funcContext) setContextArgs(ctx context.Context, args interface{}) (interface{}, error) {
+	value := reflect.New(reflect.TypeOf(args)).Elem()
+	value.Set(reflect.ValueOf(args))
+
+	for _, arg := range funcCtx.contextArgs {
+		extracted, err := arg.extract(ctx)
+		if err != nil {
+			return nil, err
+		}
+		field := value.FieldByIndex(arg.index)
+		extractedValue := reflect.ValueOf(extracted)
+		if !extractedValue.IsValid() {
+			extractedValue = reflect.Zero(field.Type())
+		}
+		if !extractedValue.Type().AssignableTo(field.Type()) {
+			return nil, fmt.Errorf("context argument %s is a %s, not a %s", arg.name, extractedValue.Type(), field.Type())
+		}
+		field.Set(extractedValue)
+	}
+	return value.Interface(), nil
+}
+
+// isLazyFunc returns true if typ is a func() (T, error), which a resolver can
+// return to compute its result lazily.
+func isLazyFunc(typ reflect.Type) bool {
+	return typ.Kind() == reflect.Func && typ.NumIn() == 0 && typ.NumOut() == 2 &&
+		typ.Out(0) != errType && typ.Out(1) == errType
+}
+
 func (funcCtx *funcContext) argsTypeMap(argType graphql.Type) (map[string]graphql.Type, error) {
 
 	args := make(map[string]graphql.Type)
@@ -576,11 +817,27 @@ func (funcCtx *funcContext) getReturnType(sb *schemaBuilder, m *method) (graphql
 	var retType graphql.Type
 	if funcCtx.hasRet {
 		var err error
-		retType, err = sb.getType(funcCtx.funcType.Out(0))
+		out := funcCtx.funcType.Out(0)
+		if funcCtx.isLazy {
+			out = out.Out(0)
+		}
+		retType, err = sb.getType(out)
 		if err != nil {
 			return nil, err
 		}
 
+		if funcCtx.hasPresence {
+			// The ok bool makes the result nullable.
+			if nonNull, ok := retType.(*graphql.NonNull); ok {
+				retType = nonNull.Type
+			}
+			switch retType.(type) {
+			case *graphql.Scalar, *graphql.Object:
+			default:
+				return nil, fmt.Errorf("%s returns an ok bool, which is only supported for scalar and object results", funcCtx.funcType)
+			}
+		}
+
 		if m.MarkedNonNullable {
 			if _, ok := retType.(*graphql.NonNull); !ok {
 				retType = &graphql.NonNull{Type: retType}
@@ -596,21 +853,37 @@ func (funcCtx *funcContext) getReturnType(sb *schemaBuilder, m *method) (graphql
 	return retType, nil
 }
 
-func (funcCtx *funcContext) extractResultAndErr(out []reflect.Value, retType graphql.Type) (interface{}, error) {
+func (funcCtx *funcContext) extractResultAndErr(ctx context.Context, out []reflect.Value, retType graphql.Type) (interface{}, error) {
 
 	var result interface{}
 	if funcCtx.hasRet {
 		result = out[0].Interface()
 		out = out[1:]
+
+		if funcCtx.hasPresence {
+			if !out[0].Bool() {
+				// Return a nil pointer, which is executed as null.
+				result = reflect.Zero(reflect.PtrTo(funcCtx.funcType.Out(0))).Interface()
+			}
+			out = out[1:]
+		}
 	} else {
 		result = true
 	}
 	if funcCtx.hasError {
 		if err := out[0]; !err.IsNil() {
-			return nil, err.Interface().(error)
+			return funcCtx.resultError(ctx, err.Interface().(error))
 		}
 	}
 
+	if funcCtx.isLazy {
+		return funcCtx.makeLazy(ctx, reflect.ValueOf(result), retType)
+	}
+
+	return funcCtx.checkNonNull(result, retType)
+}
+
+func (funcCtx *funcContext) checkNonNull(result interface{}, retType graphql.Type) (interface{}, error) {
 	if _, ok := retType.(*graphql.NonNull); ok {
 		resultValue := reflect.ValueOf(result)
 		if resultValue.Kind() == reflect.Ptr && resultValue.IsNil() {
@@ -619,7 +892,36 @@ func (funcCtx *funcContext) extractResultAndErr(out []reflect.Value, retType gra
 	}
 
 	return result, nil
+}
+
+// resultError returns the result of a function that failed with err. A field
+// of an optional backend resolves to null, with err added as a warning, unless
+// ctx is done.
+func (funcCtx *funcContext) resultError(ctx context.Context, err error) (interface{}, error) {
+	if funcCtx.optionalBackend && ctx.Err() == nil {
+		graphql.AddWarning(ctx, err)
+		return nil, nil
+	}
+	return nil, err
+}
+
+// makeLazy wraps a func() (T, error) returned by a resolver in a graphql.Lazy.
+// A nil func is treated as a null result.
+func (funcCtx *funcContext) makeLazy(ctx context.Context, fun reflect.Value, retType graphql.Type) (interface{}, error) {
+	if fun.IsNil() {
+		if _, ok := retType.(*graphql.NonNull); ok {
+			return nil, fmt.Errorf("%s is marked non-nullable but returned a nil func", funcCtx.funcType)
+		}
+		return reflect.Zero(fun.Type().Out(0)).Interface(), nil
+	}
 
+	return graphql.Lazy(func() (interface{}, error) {
+		out := fun.Call(nil)
+		if err := out[1]; !err.IsNil() {
+			return funcCtx.resultError(ctx, err.Interface().(error))
+		}
+		return funcCtx.checkNonNull(out[0].Interface(), retType)
+	}), nil
 }
 
 // funcContext is used to parse the function signature in buildFunction.
@@ -630,14 +932,20 @@ type funcContext struct {
 	hasSelectionSet bool
 	hasRet          bool
 	hasError        bool
+	hasPresence     bool
+	isLazy          bool
+	// optionalBackend is set for the functions of optional backends, whose
+	// errors are reported as warnings.
+	optionalBackend bool
+
+	contextArgs []contextArg
 
-	funcType     reflect.Type
-	isPtrFunc    bool
-	typ          reflect.Type
-	selectionSet *graphql.SelectionSet
+	funcType  reflect.Type
+	isPtrFunc bool
+	typ       reflect.Type
 }
 
-func (funcCtx *funcContext) prepareResolveArgs(source interface{}, args interface{}, ctx context.Context) []reflect.Value {
+func (funcCtx *funcContext) prepareResolveArgs(source interface{}, args interface{}, selectionSet *graphql.SelectionSet, ctx context.Context) []reflect.Value {
 
 	in := make([]reflect.Value, 0, funcCtx.funcType.NumIn())
 	if funcCtx.hasContext {
@@ -665,7 +973,7 @@ func (funcCtx *funcContext) prepareResolveArgs(source interface{}, args interfac
 		in = append(in, reflect.ValueOf(args))
 	}
 	if funcCtx.hasSelectionSet {
-		in = append(in, reflect.ValueOf(funcCtx.selectionSet))
+		in = append(in, reflect.ValueOf(selectionSet))
 	}
 
 	return in
@@ -688,6 +996,11 @@ func (sb *schemaBuilder) buildFunction(typ reflect.Type, m *method) (*graphql.Fi
 		return nil, err
 	}
 	funcCtx.hasArgs = argParser != nil
+	if funcCtx.hasArgs {
+		if funcCtx.contextArgs, err = sb.getContextArgs(argParser.Type); err != nil {
+			return nil, err
+		}
+	}
 
 	in = funcCtx.consumeSelectionSet(in)
 
@@ -713,24 +1026,95 @@ func (sb *schemaBuilder) buildFunction(typ reflect.Type, m *method) (*graphql.Fi
 		return nil, err
 	}
 
+	if m.ListConcurrency != 0 {
+		if m.ListConcurrency < 0 {
+			return nil, fmt.Errorf("list concurrency should be positive, not %d", m.ListConcurrency)
+		}
+		if !isListType(retType) {
+			return nil, fmt.Errorf("list concurrency requires a list result, not %s", retType)
+		}
+	}
+	var argsType reflect.Type
+	if funcCtx.hasArgs {
+		argsType = argParser.Type
+	}
+	cost, err := buildCostFunc(m, argsType)
+	if err != nil {
+		return nil, err
+	}
+	if m.TimeFormat != "" {
+		if retType, err = sb.withTimeFormat(retType, m.TimeFormat); err != nil {
+			return nil, err
+		}
+	}
+	if _, ok := retType.(*graphql.NonNull); ok && m.OptionalBackend {
+		return nil, fmt.Errorf("optional backend requires a nullable result, not %s", retType)
+	}
+	if err := funcCtx.checkExamples(m, argParser); err != nil {
+		return nil, err
+	}
+	funcCtx.optionalBackend = m.OptionalBackend
+
 	return &graphql.Field{
 		Resolve: func(ctx context.Context, source, args interface{}, selectionSet *graphql.SelectionSet) (interface{}, error) {
 			// Set up function arguments.
+			if len(funcCtx.contextArgs) > 0 {
+				var err error
+				if args, err = funcCtx.setContextArgs(ctx, args); err != nil {
+					return nil, err
+				}
+			}
 
-			in := funcCtx.prepareResolveArgs(source, args, ctx)
+			in := funcCtx.prepareResolveArgs(source, args, selectionSet, ctx)
 			// Call the function.
 			out := fun.Call(in)
 
-			return funcCtx.extractResultAndErr(out, retType)
+			return funcCtx.extractResultAndErr(ctx, out, retType)
 
 		},
 		Args:           args,
 		Type:           retType,
 		ParseArguments: argParser.Parse,
 		Expensive:      funcCtx.hasContext,
+		Pure:           m.Pure,
+
+		ListConcurrency: m.ListConcurrency,
+		Audiences:       m.Audiences,
+		Example:         m.Example,
+		ArgExamples:     m.ArgExamples,
+		Feature:         m.Feature,
+		Cost:            cost,
+
+		DeprecationReason: m.DeprecationReason,
+		Directives:        m.Directives,
 	}, nil
 }
 
+// isListType returns true if typ is a list or a non-null list.
+func isListType(typ graphql.Type) bool {
+	if nonNull, ok := typ.(*graphql.NonNull); ok {
+		typ = nonNull.Type
+	}
+	_, ok := typ.(*graphql.List)
+	return ok
+}
+
+// fieldByIndex returns the nested field of value corresponding to index, like
+// reflect.Value.FieldByIndex. Instead of panicking when the path steps through
+// a nil embedded struct pointer, fieldByIndex returns false.
+func fieldByIndex(value reflect.Value, index []int) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				return reflect.Value{}, false
+			}
+			value = value.Elem()
+		}
+		value = value.Field(x)
+	}
+	return value, true
+}
+
 func (sb *schemaBuilder) buildField(field reflect.StructField) (*graphql.Field, error) {
 	retType, err := sb.getType(field.Type)
 	if err != nil {
@@ -743,7 +1127,15 @@ func (sb *schemaBuilder) buildField(field reflect.StructField) (*graphql.Field,
 			if value.Kind() == reflect.Ptr {
 				value = value.Elem()
 			}
-			return value.FieldByIndex(field.Index).Interface(), nil
+			fieldValue, ok := fieldByIndex(value, field.Index)
+			if !ok {
+				// The field is promoted through a nil embedded pointer.
+				if _, ok := retType.(*graphql.NonNull); ok {
+					return nil, fmt.Errorf("%s is promoted through a nil embedded struct pointer", field.Name)
+				}
+				return reflect.Zero(field.Type).Interface(), nil
+			}
+			return fieldValue.Interface(), nil
 		},
 		Type:           retType,
 		ParseArguments: nilParseArguments,
@@ -760,12 +1152,36 @@ func (sb *schemaBuilder) buildStruct(typ reflect.Type) error {
 	var methods Methods
 	var paginatedFields []paginationObject
 	var objectKey string
+	var deprecationReason string
+	var directives []graphql.Directive
+	var defaultField graphql.DefaultResolver
+	var onResolveStart graphql.ResolveStartHook
+	var onResolveEnd graphql.ResolveEndHook
+	var fieldOrder []string
+	var proto bool
+	var oneofWrappers []interface{}
 	if object, ok := sb.objects[typ]; ok {
 		name = object.Name
 		description = object.Description
 		methods = object.Methods
 		objectKey = object.key
 		paginatedFields = object.paginatedFields
+		deprecationReason = object.deprecationReason
+		directives = object.directives
+		defaultField = object.defaultField
+		onResolveStart = object.onResolveStart
+		onResolveEnd = object.onResolveEnd
+		fieldOrder = object.fieldOrder
+		proto = object.proto
+		oneofWrappers = object.oneofWrappers
+	}
+
+	if deprecationReason != "" {
+		notice := fmt.Sprintf("DEPRECATED: %s", deprecationReason)
+		if description != "" {
+			notice += "\n\n" + description
+		}
+		description = notice
 	}
 
 	if name == "" {
@@ -775,57 +1191,31 @@ func (sb *schemaBuilder) buildStruct(typ reflect.Type) error {
 		}
 	}
 
+	if isInterface(typ) {
+		if len(methods) > 0 || len(paginatedFields) > 0 {
+			return fmt.Errorf("bad interface %s: should have no methods", name)
+		}
+		return sb.buildInterface(typ, name, description)
+	}
+
 	object := &graphql.Object{
-		Name:        name,
-		Description: description,
-		Fields:      make(map[string]*graphql.Field),
+		Name:              name,
+		Description:       description,
+		Fields:            make(map[string]*graphql.Field),
+		DeprecationReason: deprecationReason,
+		Directives:        directives,
+		DefaultResolve:    defaultField,
+		OnResolveStart:    onResolveStart,
+		OnResolveEnd:      onResolveEnd,
 	}
 	sb.types[typ] = object
 
-	for i := 0; i < typ.NumField(); i++ {
-		field := typ.Field(i)
-		if field.PkgPath != "" {
-			continue
-		}
-
-		tags := strings.Split(field.Tag.Get("graphql"), ",")
-		var name string
-		if len(tags) > 0 {
-			name = tags[0]
-		}
-		if name == "" {
-			name = makeGraphql(field.Name)
-		}
-		if name == "-" {
-			continue
-		}
-
-		var key bool
-
-		if len(tags) > 1 {
-			for _, tag := range tags[1:] {
-				if tag != "key" || key {
-					return fmt.Errorf("bad type %s: field %s has unexpected tag %s", typ, name, tag)
-				}
-				key = true
-			}
-		}
-
-		if _, ok := object.Fields[name]; ok {
-			return fmt.Errorf("bad type %s: two fields named %s", typ, name)
-		}
-
-		built, err := sb.buildField(field)
-		if err != nil {
-			return fmt.Errorf("bad field %s on type %s: %s", name, typ, err)
-		}
-		object.Fields[name] = built
-		if key {
-			if object.Key != nil {
-				return fmt.Errorf("bad type %s: multiple key fields", typ)
-			}
-			object.Key = built.Resolve
+	if proto {
+		if err := sb.buildProtoFields(typ, object, oneofWrappers); err != nil {
+			return err
 		}
+	} else if err := sb.buildStructFields(typ, object); err != nil {
+		return err
 	}
 
 	var names []string
@@ -834,24 +1224,51 @@ func (sb *schemaBuilder) buildStruct(typ reflect.Type) error {
 	}
 	sort.Strings(names)
 
+	flattened := make(map[string]*graphql.Field)
 	for _, name := range names {
 		method := methods[name]
 
-		built, err := sb.buildFunction(typ, method)
+		var built *graphql.Field
+		var err error
+		if method.Versions != nil {
+			built, err = sb.buildVersionedFunction(typ, method)
+		} else {
+			built, err = sb.buildFunction(typ, method)
+		}
 		if err != nil {
 			return fmt.Errorf("bad method %s on type %s: %s", name, typ, err)
 		}
+		if method.Flatten {
+			flattened[name] = built
+			continue
+		}
 		object.Fields[name] = built
 	}
 
 	for _, field := range paginatedFields {
-		typedField, err := sb.buildPaginatedField(typ, field.Fn)
+		typedField, err := sb.buildPaginatedField(typ, field)
 		if err != nil {
 			return err
 		}
 		object.Fields[field.Name] = typedField
 	}
 
+	flattenedNames := make(map[string][]string)
+	for _, name := range names {
+		wrapper, ok := flattened[name]
+		if !ok {
+			continue
+		}
+		fieldNames, err := flattenField(object, wrapper)
+		if err != nil {
+			return fmt.Errorf("bad method %s on type %s: %s", name, typ, err)
+		}
+		flattenedNames[name] = fieldNames
+	}
+	if len(flattened) > 0 {
+		object.OnResolveStart = withFlattenedValues(object.OnResolveStart)
+	}
+
 	if objectKey != "" {
 		keyPtr, ok := object.Fields[objectKey]
 		if !ok {
@@ -860,6 +1277,292 @@ func (sb *schemaBuilder) buildStruct(typ reflect.Type) error {
 		object.Key = keyPtr.Resolve
 	}
 
+	if sb.preserveFieldOrder {
+		object.FieldOrder = appendFieldOrder(object.FieldOrder, fieldOrder, flattenedNames, object.Fields)
+	}
+
+	return nil
+}
+
+// flattenField adds the fields of the object returned by wrapper to object,
+// resolving them on wrapper's result, and returns their names.
+func flattenField(object *graphql.Object, wrapper *graphql.Field) ([]string, error) {
+	if len(wrapper.Args) > 0 {
+		return nil, errors.New("flattened fields cannot take arguments")
+	}
+
+	typ := wrapper.Type
+	nonNull, required := typ.(*graphql.NonNull)
+	if required {
+		typ = nonNull.Type
+	}
+	inner, ok := typ.(*graphql.Object)
+	if !ok {
+		return nil, fmt.Errorf("flattened fields should return an object, not %s", typ)
+	}
+
+	names := inner.FieldOrder
+	if len(names) == 0 {
+		for name := range inner.Fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	for _, name := range names {
+		if _, ok := object.Fields[name]; ok {
+			return nil, fmt.Errorf("flattened field %s collides with an existing field", name)
+		}
+
+		field := inner.Fields[name]
+		fieldType := field.Type
+		if nonNull, ok := fieldType.(*graphql.NonNull); ok && !required {
+			// The field is null when the flattened object is.
+			fieldType = nonNull.Type
+		}
+
+		// The field keeps its metadata, and inherits the wrapper's
+		// restrictions unless it has its own.
+		flattenedField := *field
+		if len(flattenedField.Audiences) == 0 {
+			flattenedField.Audiences = wrapper.Audiences
+		}
+		if len(flattenedField.Versions) == 0 {
+			flattenedField.Versions, flattenedField.Version = wrapper.Versions, wrapper.Version
+		}
+		if flattenedField.Feature == "" {
+			flattenedField.Feature = wrapper.Feature
+		}
+		if flattenedField.DeprecationReason == "" {
+			flattenedField.DeprecationReason = wrapper.DeprecationReason
+		}
+
+		resolve := field.Resolve
+		flattenedField.Resolve = func(ctx context.Context, source, args interface{}, selectionSet *graphql.SelectionSet) (interface{}, error) {
+			value, err := resolveFlattened(ctx, wrapper, source)
+			if err != nil {
+				return nil, err
+			}
+			if value == nil {
+				return nil, nil
+			}
+			if v := reflect.ValueOf(value); v.Kind() == reflect.Ptr && v.IsNil() {
+				return nil, nil
+			}
+			return resolve(ctx, value, args, selectionSet)
+		}
+		flattenedField.Type = fieldType
+		flattenedField.Expensive = wrapper.Expensive || field.Expensive
+		flattenedField.Pure = wrapper.Pure && field.Pure
+		object.Fields[name] = &flattenedField
+	}
+	return names, nil
+}
+
+// flattenedValuesKey is the context key for the flattenedValues of the
+// object value whose fields are being resolved.
+type flattenedValuesKey struct{}
+
+// flattenedValues memoizes the results of the flattened fields of an object
+// value, so that a flattened field is resolved once however many of its
+// fields are selected.
+type flattenedValues struct {
+	mu      sync.Mutex
+	results map[*graphql.Field]*flattenedValue
+}
+
+type flattenedValue struct {
+	once  sync.Once
+	value interface{}
+	err   error
+}
+
+// withFlattenedValues wraps the OnResolveStart hook start of an object with
+// flattened fields to memoize them for each of the object's values.
+func withFlattenedValues(start graphql.ResolveStartHook) graphql.ResolveStartHook {
+	return func(ctx context.Context, source interface{}) (context.Context, error) {
+		if start != nil {
+			var err error
+			if ctx, err = start(ctx, source); err != nil {
+				return nil, err
+			}
+		}
+		return context.WithValue(ctx, flattenedValuesKey{}, &flattenedValues{results: make(map[*graphql.Field]*flattenedValue)}), nil
+	}
+}
+
+// resolveFlattened resolves the flattened field wrapper on source, once per
+// object value.
+func resolveFlattened(ctx context.Context, wrapper *graphql.Field, source interface{}) (interface{}, error) {
+	values, ok := ctx.Value(flattenedValuesKey{}).(*flattenedValues)
+	if !ok {
+		return wrapper.Resolve(ctx, source, nil, nil)
+	}
+	values.mu.Lock()
+	result, ok := values.results[wrapper]
+	if !ok {
+		result = &flattenedValue{}
+		values.results[wrapper] = result
+	}
+	values.mu.Unlock()
+
+	result.once.Do(func() {
+		result.value, result.err = wrapper.Resolve(ctx, source, nil, nil)
+	})
+	return result.value, result.err
+}
+
+// appendFieldOrder appends the names of fields registered with FieldFunc and
+// PaginateFieldFunc to order, which holds the struct's fields in declaration
+// order, replacing flattened fields with the fields they contribute. Fields
+// set through the deprecated Methods map follow, sorted by name.
+func appendFieldOrder(order []string, registered []string, flattened map[string][]string, fields map[string]*graphql.Field) []string {
+	seen := make(map[string]bool)
+	for _, name := range order {
+		seen[name] = true
+	}
+	for _, name := range registered {
+		names, ok := flattened[name]
+		if !ok {
+			names = []string{name}
+		}
+		for _, name := range names {
+			if _, ok := fields[name]; ok && !seen[name] {
+				seen[name] = true
+				order = append(order, name)
+			}
+		}
+	}
+
+	var rest []string
+	for name := range fields {
+		if !seen[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	return append(order, rest...)
+}
+
+// isPromotable returns true if field is an embedded struct (or struct pointer)
+// whose fields should be promoted into the embedding object, as in Go. An
+// embedded struct with an explicit graphql name is exposed as a regular field.
+func isPromotable(field reflect.StructField, name string) bool {
+	if !field.Anonymous || name != "" {
+		return false
+	}
+	typ := field.Type
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if _, ok := getScalar(typ); ok {
+		return false
+	}
+	return typ.Kind() == reflect.Struct
+}
+
+// buildStructFields adds a field to object for every exported field on typ.
+// With PromoteEmbeddedStructs, the fields of embedded structs are promoted
+// instead of exposed as fields of their own, and resolved breadth first as Go
+// resolves them: a field shadows the fields of the same name deeper in the
+// struct, and fields of the same name at the same depth are ambiguous.
+func (sb *schemaBuilder) buildStructFields(typ reflect.Type, object *graphql.Object) error {
+	type embedded struct {
+		typ   reflect.Type
+		index []int
+	}
+	type levelField struct {
+		name  string
+		field reflect.StructField
+		key   bool
+	}
+
+	resolved := make(map[string]bool)
+	visited := make(map[reflect.Type]bool)
+	current := []embedded{{typ: typ}}
+	for len(current) > 0 {
+		var next []embedded
+		var fields []levelField
+		counts := make(map[string]int)
+
+		for _, e := range current {
+			if visited[e.typ] {
+				// Promoted at a shallower depth already.
+				continue
+			}
+			for i := 0; i < e.typ.NumField(); i++ {
+				field := e.typ.Field(i)
+				if field.PkgPath != "" {
+					continue
+				}
+				field.Index = append(append([]int(nil), e.index...), i)
+
+				tags := strings.Split(field.Tag.Get("graphql"), ",")
+				var name string
+				if len(tags) > 0 {
+					name = tags[0]
+				}
+				if sb.promoteEmbeddedStructs && isPromotable(field, name) {
+					embeddedType := field.Type
+					if embeddedType.Kind() == reflect.Ptr {
+						embeddedType = embeddedType.Elem()
+					}
+					next = append(next, embedded{typ: embeddedType, index: field.Index})
+					continue
+				}
+				if name == "" {
+					name = makeGraphql(field.Name)
+				}
+				if name == "-" {
+					continue
+				}
+
+				var key bool
+
+				if len(tags) > 1 {
+					for _, tag := range tags[1:] {
+						if tag != "key" || key {
+							return fmt.Errorf("bad type %s: field %s has unexpected tag %s", typ, name, tag)
+						}
+						key = true
+					}
+				}
+
+				if resolved[name] {
+					// Shadowed by a field closer to the root.
+					continue
+				}
+				counts[name]++
+				fields = append(fields, levelField{name: name, field: field, key: key})
+			}
+		}
+		for _, e := range current {
+			visited[e.typ] = true
+		}
+
+		for _, f := range fields {
+			if counts[f.name] > 1 {
+				return fmt.Errorf("bad type %s: two fields named %s", typ, f.name)
+			}
+			resolved[f.name] = true
+
+			built, err := sb.buildField(f.field)
+			if err != nil {
+				return fmt.Errorf("bad field %s on type %s: %s", f.name, typ, err)
+			}
+			object.Fields[f.name] = built
+			if sb.preserveFieldOrder {
+				object.FieldOrder = append(object.FieldOrder, f.name)
+			}
+			if f.key {
+				if object.Key != nil {
+					return fmt.Errorf("bad type %s: multiple key fields", typ)
+				}
+				object.Key = built.Resolve
+			}
+		}
+		current = next
+	}
 	return nil
 }
 
@@ -905,16 +1608,38 @@ func (sb *schemaBuilder) getEnum(typ reflect.Type) (string, []string, bool) {
 func (sb *schemaBuilder) getType(t reflect.Type) (graphql.Type, error) {
 	// Support scalars and optional scalars. Scalars have precedence over structs
 	// to have eg. time.Time function as a scalar.
+	if scalar, ok := sb.getCustomScalarType(t); ok {
+		return &graphql.NonNull{Type: scalar}, nil
+	}
+	if t.Kind() == reflect.Ptr {
+		if scalar, ok := sb.getCustomScalarType(t.Elem()); ok {
+			return scalar, nil
+		}
+	}
 	if typ, values, ok := sb.getEnum(t); ok {
-		return &graphql.NonNull{Type: &graphql.Enum{Type: typ, Values: values, ReverseMap: sb.enumMappings[t].ReverseMap}}, nil
+		return &graphql.NonNull{Type: &graphql.Enum{Type: typ, Values: values, ReverseMap: sb.enumMappings[t].ReverseMap, ValueDirectives: sb.enumMappings[t].Directives}}, nil
 	}
 
-	if typ, ok := getScalar(t); ok {
-		return &graphql.NonNull{Type: &graphql.Scalar{Type: typ}}, nil
+	if isJSONType(t) {
+		return sb.jsonScalar(), nil
+	}
+	if scalar, ok := sb.getMarshalerType(t); ok {
+		return &graphql.NonNull{Type: scalar}, nil
+	}
+	if t.Kind() == reflect.Ptr {
+		if scalar, ok := sb.getMarshalerType(t.Elem()); ok {
+			return scalar, nil
+		}
+	}
+	if scalar, ok := sb.getNullWrapperType(t); ok {
+		return scalar, nil
+	}
+	if scalar, ok := sb.getScalarType(t); ok {
+		return &graphql.NonNull{Type: scalar}, nil
 	}
 	if t.Kind() == reflect.Ptr {
-		if typ, ok := getScalar(t.Elem()); ok {
-			return &graphql.Scalar{Type: typ}, nil // XXX: prefix typ with "*"
+		if scalar, ok := sb.getScalarType(t.Elem()); ok {
+			return scalar, nil // XXX: prefix typ with "*"
 		}
 	}
 
@@ -951,9 +1676,62 @@ func (sb *schemaBuilder) getType(t reflect.Type) (graphql.Type, error) {
 	}
 }
 
+var marshalerType = reflect.TypeOf((*graphql.Marshaler)(nil)).Elem()
+
+// getMarshalerType returns a scalar named after t if t or *t implements
+// graphql.Marshaler, so that its values are returned by MarshalGraphQL rather
+// than as objects or the scalars of their kind.
+func (sb *schemaBuilder) getMarshalerType(t reflect.Type) (*graphql.Scalar, bool) {
+	if t.Name() == "" || !reflect.PtrTo(t).Implements(marshalerType) {
+		return nil, false
+	}
+	return &graphql.Scalar{Type: t.Name(), SpecifiedByURL: sb.scalarSpecs[t.Name()], Serialize: marshalValue}, true
+}
+
+// marshalValue calls MarshalGraphQL on a value whose pointer type implements
+// graphql.Marshaler, which the executor cannot call on the value itself.
+func marshalValue(value interface{}) (interface{}, error) {
+	v := reflect.ValueOf(value)
+	ptr := reflect.New(v.Type())
+	ptr.Elem().Set(v)
+	return ptr.Interface().(graphql.Marshaler).MarshalGraphQL()
+}
+
+// getScalarType returns the scalar type of t, which is ID if t was registered
+// with Schema.IDType.
+func (sb *schemaBuilder) getScalarType(t reflect.Type) (*graphql.Scalar, bool) {
+	if sb.idTypes[t] {
+		return &graphql.Scalar{Type: "ID", SpecifiedByURL: sb.scalarSpecs["ID"], Serialize: serializeID}, true
+	}
+	name, ok := getScalar(t)
+	if !ok {
+		return nil, false
+	}
+	scalar := &graphql.Scalar{Type: name, SpecifiedByURL: sb.scalarSpecs[name]}
+	if isTimeType(t) {
+		scalar.Serialize = sb.timeSerializer()
+	}
+	return scalar, true
+}
+
 type Schema struct {
-	objects   map[string]*Object
-	enumTypes map[reflect.Type]*EnumMapping
+	objects     map[string]*Object
+	enumTypes   map[reflect.Type]*EnumMapping
+	scalarSpecs map[string]string
+
+	idTypes       map[reflect.Type]bool
+	nullWrappers  map[reflect.Type]nullWrapper
+	customScalars map[reflect.Type]customScalar
+
+	mutationMiddlewares    []MutationMiddlewareFunc
+	fieldMiddlewares       []FieldMiddlewareFunc
+	coerceStringArgs       bool
+	preserveFieldOrder     bool
+	promoteEmbeddedStructs bool
+	timeFormat             string
+	timeInUTC              bool
+	versionFunc            func(ctx context.Context) string
+	contextArgs            map[string]ContextArgExtractor
 }
 
 func NewSchema() *Schema {
@@ -990,6 +1768,201 @@ func (s *Schema) Enum(val interface{}, enumMap interface{}) {
 	s.enumTypes[typ] = &EnumMapping{Map: eMap, ReverseMap: rMap}
 }
 
+// EnumValueDirective applies the directive name with args to value of the enum
+// type of val, which must have been registered with Enum, as metadata printed
+// by SDL. A "deprecated" directive with a "reason" also marks the value as
+// deprecated in introspection:
+//    s.EnumValueDirective(enumType(1), "one", "deprecated", map[string]interface{}{"reason": "use two"})
+func (s *Schema) EnumValueDirective(val interface{}, value string, name string, args map[string]interface{}) {
+	mapping, ok := s.enumTypes[reflect.TypeOf(val)]
+	if !ok {
+		panic(fmt.Sprintf("%T is not a registered enum type", val))
+	}
+	if _, ok := mapping.Map[value]; !ok {
+		panic(fmt.Sprintf("%s is not a value of enum type %T", value, val))
+	}
+	if mapping.Directives == nil {
+		mapping.Directives = make(map[string][]graphql.Directive)
+	}
+	mapping.Directives[value] = append(mapping.Directives[value], graphql.Directive{Name: name, Args: args})
+}
+
+// SpecifiedBy records a URL to the specification of a scalar type, which is
+// reported as the scalar's specifiedByURL in introspection. The val should be
+// any value of the scalar type. For example:
+// s.SpecifiedBy(time.Time{}, "https://tools.ietf.org/html/rfc3339")
+func (s *Schema) SpecifiedBy(val interface{}, url string) {
+	name, ok := getScalar(reflect.TypeOf(val))
+	if !ok {
+		panic(fmt.Sprintf("%T is not a scalar type", val))
+	}
+	if s.scalarSpecs == nil {
+		s.scalarSpecs = make(map[string]string)
+	}
+	s.scalarSpecs[name] = url
+}
+
+var enumValueNameRegexp = regexp.MustCompile(`^[_A-Za-z][_0-9A-Za-z]*$`)
+
+// StringerEnum registers an enumType in the schema like Enum, naming each
+// value with its String method. The values should be a slice of all values of
+// the enumType, which must implement fmt.Stringer, as generated by stringer:
+// s.StringerEnum([]enumType{one, two, three})
+//
+// StringerEnum panics if two values have the same name, or if a name is not a
+// valid GraphQL name. The latter catches values that stringer does not know
+// about, such as gaps in a non-contiguous set of constants, which stringer
+// names like "enumType(4)".
+func (s *Schema) StringerEnum(values interface{}) {
+	v := reflect.ValueOf(values)
+	if v.Kind() != reflect.Slice || v.Len() == 0 {
+		panic("stringer enum not passed a non-empty slice")
+	}
+
+	enumMap := make(map[string]interface{})
+	for i := 0; i < v.Len(); i++ {
+		value := v.Index(i).Interface()
+		stringer, ok := value.(fmt.Stringer)
+		if !ok {
+			panic(fmt.Sprintf("stringer enum value %v of type %T does not implement fmt.Stringer", value, value))
+		}
+		name := stringer.String()
+		if !enumValueNameRegexp.MatchString(name) {
+			panic(fmt.Sprintf("stringer enum value %v has invalid name %q", v.Index(i), name))
+		}
+		if other, ok := enumMap[name]; ok {
+			panic(fmt.Sprintf("stringer enum values %v and %v are both named %s", other, value, name))
+		}
+		enumMap[name] = value
+	}
+
+	s.Enum(v.Index(0).Interface(), enumMap)
+}
+
+// A ContextArgExtractor computes the value of an argument from the context.
+type ContextArgExtractor func(ctx context.Context) (interface{}, error)
+
+// ContextArg registers an extractor for arguments that come from the context
+// rather than the client, such as the ID of the authenticated user. A field of
+// a FieldFunc's arguments struct tagged `context:"name"` is hidden from
+// clients and introspection, and is set by the extractor registered for name
+// before the FieldFunc is called.
+//
+// For example, with an extractor registered as
+// s.ContextArg("tenantID", func(ctx context.Context) (interface{}, error) {
+//	return tenantFromContext(ctx)
+// })
+// a FieldFunc can read the tenant from its arguments:
+// func(args struct {
+//	TenantID int64 `context:"tenantID"`
+//	Name     string
+// }) ...
+func (s *Schema) ContextArg(name string, extractor ContextArgExtractor) {
+	if s.contextArgs == nil {
+		s.contextArgs = make(map[string]ContextArgExtractor)
+	}
+	s.contextArgs[name] = extractor
+}
+
+// IDType declares that fields and arguments of val's type use the ID scalar.
+// The type must be a string or integer type, such as a named type for user
+// keys. ID arguments accept both strings and numbers, and ID fields are
+// always returned as strings:
+//    type UserID int64
+//    schema.IDType(UserID(0))
+func (s *Schema) IDType(val interface{}) {
+	typ := reflect.TypeOf(val)
+	switch typ.Kind() {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	default:
+		panic(fmt.Sprintf("ID type %s should be a string or integer type", typ))
+	}
+	if s.idTypes == nil {
+		s.idTypes = make(map[reflect.Type]bool)
+	}
+	s.idTypes[typ] = true
+}
+
+// serializeID returns the string of an ID value.
+func serializeID(value interface{}) (interface{}, error) {
+	v := reflect.ValueOf(value)
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, nil
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	default:
+		return nil, fmt.Errorf("bad ID %v", value)
+	}
+}
+
+// parseID parses an ID argument, given as a string or a number, into dest.
+func parseID(value interface{}, dest reflect.Value) error {
+	var asString string
+	switch value := value.(type) {
+	case string:
+		asString = value
+	case float64:
+		asString = strconv.FormatFloat(value, 'f', -1, 64)
+	default:
+		return errors.New("not a string or number")
+	}
+
+	switch dest.Kind() {
+	case reflect.String:
+		dest.SetString(asString)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		asInt, err := strconv.ParseInt(asString, 10, dest.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("bad ID %q", asString)
+		}
+		dest.SetInt(asInt)
+	default:
+		asUint, err := strconv.ParseUint(asString, 10, dest.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("bad ID %q", asString)
+		}
+		dest.SetUint(asUint)
+	}
+	return nil
+}
+
+// CoerceStringArgs makes the schema accept strings such as "42" and "true"
+// for bool and number arguments, for legacy clients that send all arguments
+// as strings. Strings that do not parse as the expected type are still
+// rejected.
+func (s *Schema) CoerceStringArgs() {
+	s.coerceStringArgs = true
+}
+
+// PromoteEmbeddedStructs makes the fields of structs embedded in objects,
+// directly or through a pointer, fields of the embedding object, as Go
+// promotes them, instead of exposing each embedded struct as a field named
+// after its type. Embedded structs with a graphql tag naming them are still
+// exposed as fields of their own. Fields promoted through a nil pointer are
+// null, or fail if non-null.
+func (s *Schema) PromoteEmbeddedStructs() {
+	s.promoteEmbeddedStructs = true
+}
+
+// PreserveFieldOrder makes introspection list the fields of objects in the
+// order they were registered, instead of alphabetically. Struct fields come
+// first in declaration order, followed by fields registered with FieldFunc
+// and PaginateFieldFunc.
+func (s *Schema) PreserveFieldOrder() {
+	s.preserveFieldOrder = true
+}
+
 func getEnumMap(enumMap interface{}, typ reflect.Type) (map[string]interface{}, map[interface{}]string) {
 	rMap := make(map[interface{}]string)
 	eMap := make(map[string]interface{})
@@ -1046,12 +2019,29 @@ func (s *Schema) Mutation() *Object {
 	return s.Object("Mutation", mutation{})
 }
 
-func (s *Schema) Build() (*graphql.Schema, error) {
-	sb := &schemaBuilder{
-		types:        make(map[reflect.Type]graphql.Type),
-		objects:      make(map[reflect.Type]*Object),
-		enumMappings: s.enumTypes,
+// newSchemaBuilder creates a schemaBuilder for the types and settings of s.
+func newSchemaBuilder(s *Schema) *schemaBuilder {
+	return &schemaBuilder{
+		types:         make(map[reflect.Type]graphql.Type),
+		objects:       make(map[reflect.Type]*Object),
+		enumMappings:  s.enumTypes,
+		scalarSpecs:   s.scalarSpecs,
+		contextArgs:   s.contextArgs,
+		idTypes:       s.idTypes,
+		nullWrappers:  s.nullWrappers,
+		customScalars: s.customScalars,
+
+		coerceStringArgs:       s.coerceStringArgs,
+		preserveFieldOrder:     s.preserveFieldOrder,
+		promoteEmbeddedStructs: s.promoteEmbeddedStructs,
+		timeFormat:             s.timeFormat,
+		timeInUTC:              s.timeInUTC,
+		versionFunc:            s.versionFunc,
 	}
+}
+
+func (s *Schema) Build() (*graphql.Schema, error) {
+	sb := newSchemaBuilder(s)
 
 	for _, object := range s.objects {
 		typ := reflect.TypeOf(object.Type)
@@ -1074,6 +2064,11 @@ func (s *Schema) Build() (*graphql.Schema, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := sb.finishInterfaces(); err != nil {
+		return nil, err
+	}
+	wrapMutationFields(mutationTyp.(*graphql.Object), s.mutationMiddlewares)
+	wrapFields(sb.types, s.fieldMiddlewares)
 	return &graphql.Schema{
 		Query:    queryTyp,
 		Mutation: mutationTyp,
@@ -1,13 +1,23 @@
 package schemabuilder
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/samsarahq/thunder/batch"
 	"github.com/samsarahq/thunder/graphql"
 	"github.com/samsarahq/thunder/internal"
 	"github.com/stretchr/testify/assert"
@@ -226,6 +236,62 @@ func TestNoMapArg(t *testing.T) {
 
 }
 
+type color int32
+
+const (
+	red color = iota
+	green
+	blue
+)
+
+func (c color) String() string {
+	switch c {
+	case red:
+		return "red"
+	case green:
+		return "green"
+	case blue:
+		return "blue"
+	default:
+		return fmt.Sprintf("color(%d)", int32(c))
+	}
+}
+
+func TestStringerEnum(t *testing.T) {
+	schema := NewSchema()
+	schema.StringerEnum([]color{red, green, blue})
+	schema.Query().FieldFunc("mix", func(args struct{ Color color }) color {
+		return args.Color + 1
+	})
+	builtSchema := schema.MustBuild()
+
+	q := graphql.MustParse(`{ mix(color: red) }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	e := graphql.Executor{}
+	result, err := e.Execute(context.Background(), builtSchema.Query, nil, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[string]interface{}{"mix": "green"}, result)
+
+	for _, c := range []struct {
+		values   []color
+		expected string
+	}{
+		{[]color{red, color(4)}, `stringer enum value color(4) has invalid name "color(4)"`},
+		{[]color{red, green, red}, "stringer enum values red and red are both named red"},
+	} {
+		func() {
+			defer func() {
+				assert.Equal(t, c.expected, recover())
+			}()
+			NewSchema().StringerEnum(c.values)
+		}()
+	}
+}
+
 func TestEnumMapInterfaceArg(t *testing.T) {
 
 	schema := NewSchema()
@@ -583,3 +649,2208 @@ func TestBadArguments(t *testing.T) {
 		t.Errorf("expected non-struct args argument to fail, but received %s", err.Error())
 	}
 }
+
+type constrainedArgs struct {
+	Age      int64   `graphql:"age,min=0,max=150"`
+	Name     *string `graphql:"name,minLength=1,maxLength=5"`
+	Email    string  `graphql:"email,pattern=^[a-z]{1,10}@example\\.com$"`
+	Optional *int32  `graphql:",min=10"`
+}
+
+func TestArgConstraints(t *testing.T) {
+	sb := &schemaBuilder{}
+	parser, _, err := sb.makeArgParser(reflect.TypeOf(constrainedArgs{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name := "bob"
+	testArgParseOk(t, parser, internal.ParseJSON(`
+		{"age": 0, "name": "bob", "email": "bob@example.com"}
+	`), constrainedArgs{
+		Age:   0,
+		Name:  &name,
+		Email: "bob@example.com",
+	})
+
+	for _, input := range []string{
+		`{"age": -1, "email": "bob@example.com"}`,
+		`{"age": 151, "email": "bob@example.com"}`,
+		`{"age": 10, "name": "", "email": "bob@example.com"}`,
+		`{"age": 10, "name": "robert", "email": "bob@example.com"}`,
+		`{"age": 10, "email": "bob@example.org"}`,
+		`{"age": 10, "email": "bob@example.com", "optional": 9}`,
+	} {
+		testArgParseBad(t, parser, internal.ParseJSON(input))
+	}
+
+	if _, err := parser.Parse(internal.ParseJSON(`{"age": 200, "email": "bob@example.com"}`)); err == nil || err.Error() != "age: violates constraint max=150" {
+		t.Errorf("expected max constraint error, but received %v", err)
+	}
+
+	for _, typ := range []interface{}{
+		struct {
+			A string `graphql:"a,min=1"`
+		}{},
+		struct {
+			A int64 `graphql:"a,maxLength=1"`
+		}{},
+		struct {
+			A int64 `graphql:"a,min=abc"`
+		}{},
+		struct {
+			A string `graphql:"a,pattern=("`
+		}{},
+		struct {
+			A string `graphql:"a,unknown=1"`
+		}{},
+	} {
+		if _, _, err := sb.makeArgParser(reflect.TypeOf(typ)); err == nil || !strings.Contains(err.Error(), "bad constraint") {
+			t.Errorf("expected bad constraint on %T to fail, but received %v", typ, err)
+		}
+	}
+}
+
+type itemArgs struct {
+	Name     string `graphql:"name,minLength=1"`
+	Quantity int64  `graphql:"quantity,min=1"`
+}
+
+type bulkArgs struct {
+	Items []itemArgs `graphql:"items,minItems=1,maxItems=2"`
+}
+
+func TestListArgConstraints(t *testing.T) {
+	sb := &schemaBuilder{}
+	parser, _, err := sb.makeArgParser(reflect.TypeOf(bulkArgs{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testArgParseOk(t, parser, internal.ParseJSON(`
+		{"items": [{"name": "a", "quantity": 1}, {"name": "b", "quantity": 2}]}
+	`), bulkArgs{Items: []itemArgs{{Name: "a", Quantity: 1}, {Name: "b", Quantity: 2}}})
+
+	for input, expected := range map[string]string{
+		`{"items": []}`: "items: violates constraint minItems=1",
+		`{"items": [{"name": "a", "quantity": 1}, {"name": "b", "quantity": 1}, {"name": "c", "quantity": 1}]}`: "items: violates constraint maxItems=2",
+		`{"items": [{"name": "a", "quantity": 1}, {"name": "b", "quantity": 0}]}`:                               "items: 1: quantity: violates constraint min=1",
+	} {
+		if _, err := parser.Parse(internal.ParseJSON(input)); err == nil || err.Error() != expected {
+			t.Errorf("expected %s for %s, but received %v", expected, input, err)
+		}
+	}
+
+	if _, _, err := sb.makeArgParser(reflect.TypeOf(struct {
+		A string `graphql:"a,minItems=1"`
+	}{})); err == nil || !strings.Contains(err.Error(), "bad constraint") {
+		t.Errorf("expected minItems on a string to fail, but received %v", err)
+	}
+}
+
+type legacyArgs struct {
+	Count    int64
+	Ratio    float64
+	Enabled  bool
+	Optional *int32
+	Name     string
+}
+
+func TestCoerceStringArgs(t *testing.T) {
+	sb := &schemaBuilder{}
+	parser, _, err := sb.makeArgParser(reflect.TypeOf(legacyArgs{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testArgParseBad(t, parser, internal.ParseJSON(`{"count": "42", "ratio": 0.5, "enabled": true, "name": "a"}`))
+
+	sb = &schemaBuilder{coerceStringArgs: true}
+	parser, _, err = sb.makeArgParser(reflect.TypeOf(legacyArgs{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	three := int32(3)
+	testArgParseOk(t, parser, internal.ParseJSON(`
+		{"count": "42", "ratio": "0.5", "enabled": "true", "optional": "3", "name": "7"}
+	`), legacyArgs{Count: 42, Ratio: 0.5, Enabled: true, Optional: &three, Name: "7"})
+	testArgParseOk(t, parser, internal.ParseJSON(`
+		{"count": 42, "ratio": 0.5, "enabled": false, "name": "a"}
+	`), legacyArgs{Count: 42, Ratio: 0.5, Name: "a"})
+
+	if _, err := parser.Parse(internal.ParseJSON(`{"count": "many", "ratio": 0.5, "enabled": true, "name": "a"}`)); err == nil || err.Error() != `count: cannot coerce "many" to a number` {
+		t.Errorf("expected coercion error, but received %v", err)
+	}
+	testArgParseBad(t, parser, internal.ParseJSON(`{"count": 1, "ratio": 0.5, "enabled": "yes please", "name": "a"}`))
+}
+
+type userID int64
+
+func TestIDType(t *testing.T) {
+	schema := NewSchema()
+	schema.IDType(userID(0))
+	query := schema.Query()
+	query.FieldFunc("user", func(args struct{ Id userID }) userID {
+		return args.Id
+	})
+	query.FieldFunc("missing", func() *userID {
+		return nil
+	})
+	builtSchema := schema.MustBuild()
+
+	field := builtSchema.Query.(*graphql.Object).Fields["user"]
+	assert.Equal(t, "ID!", field.Type.String())
+	assert.Equal(t, "ID!", field.Args["id"].String())
+
+	q := graphql.MustParse(`
+		{
+			fromString: user(id: "42")
+			fromNumber: user(id: 7)
+			missing
+		}
+	`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+
+	e := graphql.Executor{}
+	result, err := e.Execute(context.Background(), builtSchema.Query, nil, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, internal.ParseJSON(`
+		{"fromString": "42", "fromNumber": "7", "missing": null}
+	`), internal.AsJSON(result))
+
+	q = graphql.MustParse(`{ user(id: "abc") }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err == nil || !strings.Contains(err.Error(), `bad ID "abc"`) {
+		t.Errorf("expected bad ID error, but received %v", err)
+	}
+
+	assert.Panics(t, func() { NewSchema().IDType(1.5) })
+}
+
+func TestScalar(t *testing.T) {
+	schema := NewSchema()
+	schema.Scalar("DateTime", time.Time{}, func(value interface{}) (interface{}, error) {
+		return value.(time.Time).Format(time.RFC3339), nil
+	}, func(value interface{}) (interface{}, error) {
+		s, ok := value.(string)
+		if !ok {
+			return nil, errors.New("not a string")
+		}
+		return time.Parse(time.RFC3339, s)
+	})
+	query := schema.Query()
+	query.FieldFunc("later", func(args struct {
+		At    time.Time
+		Until *time.Time
+	}) time.Time {
+		return args.At.Add(time.Hour)
+	})
+	query.FieldFunc("never", func() *time.Time {
+		return nil
+	})
+	builtSchema := schema.MustBuild()
+
+	field := builtSchema.Query.(*graphql.Object).Fields["later"]
+	assert.Equal(t, "DateTime!", field.Type.String())
+	assert.Equal(t, "DateTime!", field.Args["at"].String())
+	assert.Equal(t, "DateTime", field.Args["until"].String())
+
+	q := graphql.MustParse(`{ later(at: "2020-01-02T03:04:05Z") never }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	e := graphql.Executor{}
+	result, err := e.Execute(context.Background(), builtSchema.Query, nil, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, internal.ParseJSON(`{"later": "2020-01-02T04:04:05Z", "never": null}`), internal.AsJSON(result))
+
+	q = graphql.MustParse(`{ later(at: 5) }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err == nil || !strings.Contains(err.Error(), "not a string") {
+		t.Errorf("expected unmarshal error, but received %v", err)
+	}
+
+	assert.Panics(t, func() { NewSchema().Scalar("DateTime", time.Time{}, nil, nil) })
+	assert.Panics(t, func() { NewSchema().Scalar("DateTime", &time.Time{}, marshalValue, marshalValue) })
+}
+
+type nullUUID struct {
+	UUID  string
+	Valid bool
+}
+
+type Row struct {
+	Name   sql.NullString
+	Count  sql.NullInt64
+	Ratio  sql.NullFloat64
+	Active sql.NullBool
+	UUID   nullUUID
+}
+
+func TestNullWrapper(t *testing.T) {
+	schema := NewSchema()
+	schema.NullWrapper(nullUUID{})
+	schema.Object("Row", Row{})
+	query := schema.Query()
+	query.FieldFunc("rows", func() []Row {
+		return []Row{
+			{
+				Name:   sql.NullString{String: "a", Valid: true},
+				Count:  sql.NullInt64{Int64: 3, Valid: true},
+				Ratio:  sql.NullFloat64{Float64: 0.5, Valid: true},
+				Active: sql.NullBool{Bool: false, Valid: true},
+				UUID:   nullUUID{UUID: "5b2f", Valid: true},
+			},
+			{},
+		}
+	})
+	builtSchema := schema.MustBuild()
+
+	row := builtSchema.Query.(*graphql.Object).Fields["rows"].Type.(*graphql.NonNull).Type.(*graphql.List).Type.(*graphql.NonNull).Type.(*graphql.Object)
+	for name, typ := range map[string]string{"name": "string", "count": "int64", "ratio": "float64", "active": "bool", "uUID": "string"} {
+		assert.Equal(t, typ, row.Fields[name].Type.String(), name)
+	}
+
+	q := graphql.MustParse(`{ rows { name count ratio active uUID } }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	e := graphql.Executor{}
+	result, err := e.Execute(context.Background(), builtSchema.Query, nil, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, internal.ParseJSON(`
+		{"rows": [
+			{"name": "a", "count": 3, "ratio": 0.5, "active": false, "uUID": "5b2f"},
+			{"name": null, "count": null, "ratio": null, "active": null, "uUID": null}
+		]}
+	`), internal.AsJSON(result))
+
+	assert.Panics(t, func() { NewSchema().NullWrapper(struct{ Valid bool }{}) })
+	assert.Panics(t, func() { NewSchema().NullWrapper(struct{ A, B string }{}) })
+}
+
+type Address struct {
+	City   string
+	Street *string
+}
+
+type Contact struct {
+	Phone string
+}
+
+type Person struct {
+	Name string
+	*Address
+	*Contact `graphql:"contact"`
+}
+
+func TestEmbeddedStructPointer(t *testing.T) {
+	schema := NewSchema()
+	schema.PromoteEmbeddedStructs()
+	query := schema.Query()
+	street := "Main St"
+	query.FieldFunc("withAddress", func() *Person {
+		return &Person{Name: "Alice", Address: &Address{City: "Springfield", Street: &street}}
+	})
+	query.FieldFunc("withoutAddress", func() *Person {
+		return &Person{Name: "Bob"}
+	})
+	query.FieldFunc("withoutContact", func() *Person {
+		return &Person{Name: "Bob", Contact: nil}
+	})
+	builtSchema := schema.MustBuild()
+
+	q := graphql.MustParse(`
+		{
+			withAddress { name city street }
+			withoutAddress { name street }
+			withoutContact { contact { phone } }
+		}
+	`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+
+	e := graphql.Executor{}
+	result, err := e.Execute(context.Background(), builtSchema.Query, nil, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, internal.ParseJSON(`
+		{
+			"withAddress": {"name": "Alice", "city": "Springfield", "street": "Main St"},
+			"withoutAddress": {"name": "Bob", "street": null},
+			"withoutContact": {"contact": null}
+		}
+	`), internal.AsJSON(result))
+
+	q = graphql.MustParse(`
+		{
+			withoutAddress { city }
+		}
+	`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = e.Execute(context.Background(), builtSchema.Query, nil, q)
+	if err == nil || !strings.Contains(err.Error(), "City is promoted through a nil embedded struct pointer") {
+		t.Errorf("expected error for non-null field behind nil embedded pointer, but received %v", err)
+	}
+}
+
+func TestEmbeddedStructNested(t *testing.T) {
+	schema := NewSchema()
+	query := schema.Query()
+	query.FieldFunc("person", func() *Person {
+		return &Person{Name: "Alice", Address: &Address{City: "Springfield"}}
+	})
+	builtSchema := schema.MustBuild()
+
+	// Without PromoteEmbeddedStructs, embedded structs are fields of their
+	// own.
+	q := graphql.MustParse(`{ person { name address { city } contact { phone } } }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	e := graphql.Executor{}
+	result, err := e.Execute(context.Background(), builtSchema.Query, nil, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, internal.ParseJSON(`
+		{"person": {"name": "Alice", "address": {"city": "Springfield"}, "contact": null}}
+	`), internal.AsJSON(result))
+
+	q = graphql.MustParse(`{ person { city } }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err == nil {
+		t.Error("expected fields of embedded structs not to be promoted")
+	}
+}
+
+type Inner struct {
+	Label string
+}
+
+type Outer struct {
+	Inner
+}
+
+type Labeled struct {
+	Label int64
+}
+
+func TestPromotedFieldShadowing(t *testing.T) {
+	// Labeled.Label, at depth 1, shadows Outer.Inner.Label, at depth 2, even
+	// though Outer is declared first.
+	type Shadowed struct {
+		Outer
+		Labeled
+	}
+	schema := NewSchema()
+	schema.PromoteEmbeddedStructs()
+	schema.Query().FieldFunc("shadowed", func() Shadowed {
+		return Shadowed{Outer: Outer{Inner{Label: "inner"}}, Labeled: Labeled{Label: 1}}
+	})
+	builtSchema := schema.MustBuild()
+
+	q := graphql.MustParse(`{ shadowed { label } }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	e := graphql.Executor{}
+	result, err := e.Execute(context.Background(), builtSchema.Query, nil, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, internal.ParseJSON(`{"shadowed": {"label": 1}}`), internal.AsJSON(result))
+
+	// Fields of the same name at the same depth are ambiguous.
+	type Ambiguous struct {
+		Inner
+		Labeled
+	}
+	ambiguous := NewSchema()
+	ambiguous.PromoteEmbeddedStructs()
+	ambiguous.Query().FieldFunc("ambiguous", func() Ambiguous { return Ambiguous{} })
+	if _, err := ambiguous.Build(); err == nil || !strings.Contains(err.Error(), "two fields named label") {
+		t.Errorf("expected ambiguous fields to fail, but received %v", err)
+	}
+}
+
+func TestDeprecatedObject(t *testing.T) {
+	type OldUser struct {
+		Name string
+	}
+
+	schema := NewSchema()
+	query := schema.Query()
+	query.FieldFunc("oldUsers", func() []OldUser {
+		return []OldUser{{Name: "Alice"}, {Name: "Bob"}}
+	})
+	query.FieldFunc("noOldUsers", func() []OldUser {
+		return nil
+	})
+	query.FieldFunc("missingOldUser", func() *OldUser {
+		return nil
+	})
+	oldUser := schema.Object("OldUser", OldUser{})
+	oldUser.Description = "A user of the old system."
+	oldUser.Deprecate("use User instead")
+	builtSchema := schema.MustBuild()
+
+	typ := builtSchema.Query.(*graphql.Object).Fields["oldUsers"].Type.(*graphql.NonNull).Type.(*graphql.List).Type.(*graphql.NonNull).Type.(*graphql.Object)
+	assert.Equal(t, "DEPRECATED: use User instead\n\nA user of the old system.", typ.Description)
+
+	var logged []string
+	e := graphql.NewExecutor(graphql.WithDeprecationLogger(func(ctx context.Context, typeName string, reason string) {
+		logged = append(logged, typeName+": "+reason)
+	}))
+
+	q := graphql.MustParse(`{ oldUsers { name } }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Execute(context.Background(), builtSchema.Query, nil, q); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []string{"OldUser: use User instead"}, logged)
+
+	// The type is logged even when no value of it is resolved.
+	for _, source := range []string{`{ noOldUsers { name } }`, `{ missingOldUser { name } }`} {
+		logged = nil
+		q := graphql.MustParse(source, nil)
+		if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := e.Execute(context.Background(), builtSchema.Query, nil, q); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, []string{"OldUser: use User instead"}, logged, source)
+	}
+}
+
+func TestOptions(t *testing.T) {
+	var applied []string
+	record := func(name string) FieldFuncOption {
+		return func(m *method) {
+			applied = append(applied, name)
+		}
+	}
+	bundle := Options(record("a"), NonNullable, record("b"))
+
+	schema := NewSchema()
+	query := schema.Query()
+	query.FieldFunc("name", func() *string {
+		name := "Alice"
+		return &name
+	}, bundle, record("c"))
+	builtSchema := schema.MustBuild()
+
+	assert.Equal(t, []string{"a", "b", "c"}, applied)
+	if _, ok := builtSchema.Query.(*graphql.Object).Fields["name"].Type.(*graphql.NonNull); !ok {
+		t.Error("expected bundled NonNullable to make the field non-null")
+	}
+}
+
+func TestLazyResult(t *testing.T) {
+	type Item struct {
+		Id int64
+	}
+
+	var calls []string
+	schema := NewSchema()
+	query := schema.Query()
+	query.FieldFunc("items", func() []Item {
+		calls = append(calls, "items")
+		return []Item{{Id: 1}, {Id: 2}}
+	})
+	query.FieldFunc("failing", func() func() (*Item, error) {
+		return func() (*Item, error) {
+			return nil, errors.New("lazy error")
+		}
+	})
+	item := schema.Object("Item", Item{})
+	item.FieldFunc("next", func(i Item) func() (Item, error) {
+		calls = append(calls, fmt.Sprint("resolve next ", i.Id))
+		return func() (Item, error) {
+			calls = append(calls, fmt.Sprint("load next ", i.Id))
+			return Item{Id: i.Id + 10}, nil
+		}
+	})
+	item.FieldFunc("missing", func(i Item) func() (*Item, error) {
+		return nil
+	})
+	builtSchema := schema.MustBuild()
+
+	q := graphql.MustParse(`{ items { id next { id next { id } } missing { id } } }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	e := graphql.Executor{}
+	result, err := e.Execute(context.Background(), builtSchema.Query, nil, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, internal.ParseJSON(`{"items": [
+		{"id": 1, "next": {"id": 11, "next": {"id": 21}}, "missing": null},
+		{"id": 2, "next": {"id": 12, "next": {"id": 22}}, "missing": null}
+	]}`), internal.AsJSON(result))
+	assert.Equal(t, []string{
+		"items",
+		"resolve next 1", "resolve next 2",
+		"load next 1", "resolve next 11", "load next 2", "resolve next 12",
+		"load next 11", "load next 12",
+	}, calls)
+
+	q = graphql.MustParse(`{ failing { id } }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Execute(context.Background(), builtSchema.Query, nil, q); err == nil || err.Error() != "failing: lazy error" {
+		t.Errorf("expected lazy error, but received %v", err)
+	}
+}
+
+func TestRemoteFieldFunc(t *testing.T) {
+	type Owner struct {
+		Name string
+	}
+	type Account struct {
+		Id      int64
+		Balance int64
+		Owner   Owner
+	}
+
+	remote := NewSchema()
+	remote.Query().FieldFunc("account", func(args struct{ Id int64 }) (*Account, error) {
+		if args.Id != 4 {
+			return nil, graphql.NewSafeError("no account %d", args.Id)
+		}
+		return &Account{Id: 4, Balance: 100, Owner: Owner{Name: "Alice"}}, nil
+	})
+	server := httptest.NewServer(graphql.HTTPHandler(remote.MustBuild()))
+	defer server.Close()
+	client := &HTTPRemoteClient{URL: server.URL}
+
+	schema := NewSchema()
+	query := schema.Query()
+	query.RemoteFieldFunc("account", client, `{ account(id: 4) {{selections}} }`, &Account{})
+	query.RemoteFieldFunc("missing", client, `{ account(id: 5) {{selections}} }`, &Account{})
+	builtSchema := schema.MustBuild()
+
+	q := graphql.MustParse(`{
+		account { id ...f owner { name } }
+	}
+	fragment f on Account { balance owner { name } }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	e := graphql.Executor{}
+	result, err := e.Execute(context.Background(), builtSchema.Query, nil, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, internal.ParseJSON(`{"account": {"id": 4, "balance": 100, "owner": {"name": "Alice"}}}`), internal.AsJSON(result))
+
+	var b bytes.Buffer
+	printRemoteSelectionSet(&b, q.SelectionSet.Selections[0].SelectionSet)
+	assert.Equal(t, "{ balance id owner { name } }", b.String())
+
+	q = graphql.MustParse(`{ missing { id } }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Execute(context.Background(), builtSchema.Query, nil, q); err == nil || err.Error() != "missing: remote: no account 5" {
+		t.Errorf("expected remote error, but received %v", err)
+	}
+
+	partial := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": {"account": {"id": 4, "balance": 100, "owner": null}}, "errors": [{"message": "no owner"}]}`))
+	}))
+	defer partial.Close()
+	var account *Account
+	decoded, err := queryRemote(context.Background(), &HTTPRemoteClient{URL: partial.URL}, `{ account(id: 4) {{selections}} }`, q.SelectionSet.Selections[0].SelectionSet, &account)
+	if err == nil || err.Error() != "remote: no owner" {
+		t.Errorf("expected remote error, but received %v", err)
+	}
+	if !decoded || !reflect.DeepEqual(account, &Account{Id: 4, Balance: 100}) {
+		t.Errorf("expected partial data, but received %v", account)
+	}
+}
+
+func TestPresenceResult(t *testing.T) {
+	type Point struct {
+		X int64
+	}
+
+	schema := NewSchema()
+	query := schema.Query()
+	query.FieldFunc("count", func(args struct{ Present bool }) (int64, bool, error) {
+		return 0, args.Present, nil
+	})
+	query.FieldFunc("point", func(args struct{ Present bool }) (Point, bool) {
+		return Point{}, args.Present
+	})
+	builtSchema := schema.MustBuild()
+
+	if _, ok := builtSchema.Query.(*graphql.Object).Fields["count"].Type.(*graphql.Scalar); !ok {
+		t.Error("expected count to be nullable")
+	}
+
+	q := graphql.MustParse(`{
+		presentCount: count(present: true)
+		missingCount: count(present: false)
+		presentPoint: point(present: true) { x }
+		missingPoint: point(present: false) { x }
+	}`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	e := graphql.Executor{}
+	result, err := e.Execute(context.Background(), builtSchema.Query, nil, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, internal.ParseJSON(`{
+		"presentCount": 0,
+		"missingCount": null,
+		"presentPoint": {"x": 0},
+		"missingPoint": null
+	}`), internal.AsJSON(result))
+
+	bad := NewSchema()
+	bad.Query().FieldFunc("count", func() (int64, bool, error) {
+		return 0, true, nil
+	}, NonNullable)
+	if _, err := bad.Build(); err == nil {
+		t.Error("expected non-nullable presence result to fail")
+	}
+
+	bad = NewSchema()
+	bad.Query().FieldFunc("list", func() ([]int64, bool) {
+		return nil, true
+	})
+	if _, err := bad.Build(); err == nil {
+		t.Error("expected list presence result to fail")
+	}
+}
+
+func TestMutationMiddleware(t *testing.T) {
+	type renameArgs struct {
+		Name string
+	}
+
+	var audit []string
+	schema := NewSchema()
+	schema.Query().FieldFunc("name", func() string {
+		return "Alice"
+	})
+	schema.Mutation().FieldFunc("rename", func(ctx context.Context, args renameArgs) (string, error) {
+		return ctx.Value("user").(string) + " renamed to " + args.Name, nil
+	})
+	schema.AddMutationMiddleware(func(input *MutationInput, next MutationNextFunc) (interface{}, error) {
+		audit = append(audit, fmt.Sprintf("%s %v", input.Name, input.Args))
+		input.Ctx = context.WithValue(input.Ctx, "user", "admin")
+		return next(input)
+	})
+	builtSchema := schema.MustBuild()
+
+	e := graphql.Executor{}
+	for _, c := range []struct {
+		typ      graphql.Type
+		query    string
+		expected string
+	}{
+		{builtSchema.Query, `{ name }`, `{"name": "Alice"}`},
+		{builtSchema.Mutation, `mutation { rename(name: "Bob") }`, `{"rename": "admin renamed to Bob"}`},
+	} {
+		q := graphql.MustParse(c.query, nil)
+		if err := graphql.PrepareQuery(c.typ, q.SelectionSet); err != nil {
+			t.Fatal(err)
+		}
+		result, err := e.Execute(context.Background(), c.typ, nil, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, internal.ParseJSON(c.expected), internal.AsJSON(result))
+	}
+
+	assert.Equal(t, []string{"rename {Bob}"}, audit)
+}
+
+func TestFieldMiddleware(t *testing.T) {
+	type Account struct {
+		Name string
+	}
+
+	schema := NewSchema()
+	schema.Query().FieldFunc("account", func() *Account {
+		return &Account{Name: "Alice"}
+	})
+	account := schema.Object("Account", Account{})
+	account.FieldFunc("secret", func(a *Account) string {
+		return "hunter2"
+	})
+	account.FieldFunc("greeting", func(a *Account, args struct{ Prefix string }) string {
+		return args.Prefix + " " + a.Name
+	})
+	schema.Mutation().FieldFunc("fail", func() (string, error) {
+		return "", errors.New("connection to db-7 refused")
+	})
+
+	var log []string
+	schema.AddFieldMiddleware(func(input *FieldInput, next FieldNextFunc) (interface{}, error) {
+		log = append(log, fmt.Sprintf("%s.%s %v", input.Object, input.Name, input.Args))
+		if input.Name == "secret" {
+			return nil, errors.New("forbidden")
+		}
+		return next(input)
+	})
+	schema.AddFieldMiddleware(func(input *FieldInput, next FieldNextFunc) (interface{}, error) {
+		result, err := next(input)
+		if err != nil {
+			return nil, errors.New("internal error")
+		}
+		return result, nil
+	})
+	builtSchema := schema.MustBuild()
+
+	execute := func(typ graphql.Type, query string) (interface{}, error) {
+		q := graphql.MustParse(query, nil)
+		if err := graphql.PrepareQuery(typ, q.SelectionSet); err != nil {
+			t.Fatal(err)
+		}
+		e := graphql.Executor{}
+		return e.Execute(context.Background(), typ, nil, q)
+	}
+
+	result, err := execute(builtSchema.Query, `{ account { name greeting(prefix: "Hi") } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, internal.ParseJSON(`{"account": {"name": "Alice", "greeting": "Hi Alice"}}`), internal.AsJSON(result))
+	sort.Strings(log)
+	assert.Equal(t, []string{"Account.greeting {Hi}", "Account.name <nil>", "Query.account <nil>"}, log)
+
+	if _, err := execute(builtSchema.Query, `{ account { secret } }`); err == nil || err.Error() != "account.secret: forbidden" {
+		t.Errorf("expected the first middleware to deny the field, but received %v", err)
+	}
+	if _, err := execute(builtSchema.Mutation, `mutation { fail }`); err == nil || err.Error() != "fail: internal error" {
+		t.Errorf("expected the second middleware to redact the error, but received %v", err)
+	}
+}
+
+func TestPure(t *testing.T) {
+	schema := NewSchema()
+	query := schema.Query()
+	query.FieldFunc("pure", func() string { return "" }, Pure)
+	query.FieldFunc("impure", func() string { return "" })
+	builtSchema := schema.MustBuild()
+
+	fields := builtSchema.Query.(*graphql.Object).Fields
+	assert.True(t, fields["pure"].Pure)
+	assert.False(t, fields["impure"].Pure)
+}
+
+func TestDefaultFieldFunc(t *testing.T) {
+	type Record struct {
+		Id     int64
+		Values map[string]interface{} `graphql:"-"`
+	}
+
+	schema := NewSchema()
+	schema.Query().FieldFunc("record", func() Record {
+		return Record{Id: 1, Values: map[string]interface{}{"color": "red", "size": 3}}
+	})
+	record := schema.Object("Record", Record{})
+	record.DefaultFieldFunc(func(ctx context.Context, source interface{}, name string, args map[string]interface{}) (interface{}, error) {
+		if name == "pick" {
+			return source.(Record).Values[args["key"].(string)], nil
+		}
+		return source.(Record).Values[name], nil
+	})
+	builtSchema := schema.MustBuild()
+
+	q := graphql.MustParse(`{ record { id color size pick(key: "color") missing } }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	e := graphql.Executor{}
+	result, err := e.Execute(context.Background(), builtSchema.Query, nil, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, internal.ParseJSON(`{"record": {"id": 1, "color": "red", "size": 3, "pick": "red", "missing": null}}`), internal.AsJSON(result))
+
+	q = graphql.MustParse(`{ record { color { name } } }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err == nil {
+		t.Error("expected selections on a default field to fail")
+	}
+	q = graphql.MustParse(`{ unknown }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err == nil {
+		t.Error("expected unknown fields without a default to fail")
+	}
+}
+
+func TestContextArg(t *testing.T) {
+	type tenantKey struct{}
+
+	schema := NewSchema()
+	schema.ContextArg("tenantID", func(ctx context.Context) (interface{}, error) {
+		tenant, ok := ctx.Value(tenantKey{}).(int64)
+		if !ok {
+			return nil, errors.New("no tenant")
+		}
+		return tenant, nil
+	})
+	schema.Query().FieldFunc("greet", func(args struct {
+		TenantID int64 `context:"tenantID"`
+		Name     string
+	}) string {
+		return fmt.Sprintf("hello %s of tenant %d", args.Name, args.TenantID)
+	})
+	builtSchema := schema.MustBuild()
+
+	field := builtSchema.Query.(*graphql.Object).Fields["greet"]
+	if _, ok := field.Args["tenantID"]; ok {
+		t.Error("expected context argument to be hidden")
+	}
+
+	q := graphql.MustParse(`{ greet(name: "Bob") }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	e := graphql.Executor{}
+	result, err := e.Execute(context.WithValue(context.Background(), tenantKey{}, int64(7)), builtSchema.Query, nil, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[string]interface{}{"greet": "hello Bob of tenant 7"}, result)
+
+	if _, err := e.Execute(context.Background(), builtSchema.Query, nil, q); err == nil || err.Error() != "greet: no tenant" {
+		t.Errorf("expected extractor error, but received %v", err)
+	}
+
+	q = graphql.MustParse(`{ greet(name: "Bob", tenantID: 8) }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err == nil {
+		t.Error("expected client to be unable to set context argument")
+	}
+
+	unregistered := NewSchema()
+	unregistered.Query().FieldFunc("greet", func(args struct {
+		UserID int64 `context:"userID"`
+	}) string {
+		return ""
+	})
+	if _, err := unregistered.Build(); err == nil {
+		t.Error("expected unregistered context argument to fail")
+	}
+}
+
+func TestFieldArguments(t *testing.T) {
+	type filter struct {
+		Colors []color
+	}
+
+	schema := NewSchema()
+	schema.StringerEnum([]color{red, green, blue})
+	schema.ContextArg("tenantID", func(ctx context.Context) (interface{}, error) {
+		return int64(1), nil
+	})
+	schema.Query().FieldFunc("search", func(ctx context.Context, args struct {
+		TenantID int64  `context:"tenantID"`
+		Query    string `graphql:"query,minLength=1"`
+		Limit    *int64 `graphql:"limit,min=1,max=100"`
+		Filters  []*filter
+	}) []string {
+		return nil
+	})
+
+	infos, err := schema.FieldArguments("Query", "search")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var describe func(infos []ArgInfo) []string
+	describe = func(infos []ArgInfo) []string {
+		var descriptions []string
+		for _, info := range infos {
+			descriptions = append(descriptions, fmt.Sprintf("%s %s %s nullable=%v enum=%v constraints=%v",
+				info.Name, info.GoType, info.Type, info.Nullable, info.EnumValues, info.Constraints))
+			for _, field := range describe(info.Fields) {
+				descriptions = append(descriptions, info.Name+"."+field)
+			}
+		}
+		return descriptions
+	}
+	assert.Equal(t, []string{
+		"filters []*schemabuilder.filter [filter_InputObject]! nullable=false enum=[] constraints=[]",
+		"filters.colors []schemabuilder.color [color!]! nullable=false enum=[blue green red] constraints=[]",
+		"limit *int64 int64 nullable=true enum=[] constraints=[min=1 max=100]",
+		"query string string! nullable=false enum=[] constraints=[minLength=1]",
+	}, describe(infos))
+
+	if _, err := schema.FieldArguments("Query", "missing"); err == nil {
+		t.Error("expected unknown field to fail")
+	}
+}
+
+func TestNewSchemaBuilder(t *testing.T) {
+	schema := NewSchema()
+	schema.CoerceStringArgs()
+	schema.PreserveFieldOrder()
+	schema.PromoteEmbeddedStructs()
+	schema.TimeFormat(time.Kitchen)
+	schema.TimeInUTC()
+	schema.VersionFunc(func(ctx context.Context) string { return "v1" })
+
+	// Build and FieldArguments share the builder, so they see the same
+	// settings.
+	sb := newSchemaBuilder(schema)
+	assert.True(t, sb.coerceStringArgs)
+	assert.True(t, sb.preserveFieldOrder)
+	assert.True(t, sb.promoteEmbeddedStructs)
+	assert.Equal(t, time.Kitchen, sb.timeFormat)
+	assert.True(t, sb.timeInUTC)
+	if sb.versionFunc == nil || sb.versionFunc(context.Background()) != "v1" {
+		t.Error("expected the version func to be set")
+	}
+}
+
+func TestFlatten(t *testing.T) {
+	type Profile struct {
+		Bio string
+	}
+	type User struct {
+		Name string
+	}
+
+	schema := NewSchema()
+	schema.Query().FieldFunc("users", func() []*User {
+		return []*User{{Name: "alice"}, {Name: "bob"}}
+	})
+	user := schema.Object("User", User{})
+	var profileCalls int
+	user.FieldFunc("profile", func(u *User) *Profile {
+		profileCalls++
+		if u.Name == "bob" {
+			return nil
+		}
+		return &Profile{Bio: "hi"}
+	}, Flatten)
+	profile := schema.Object("Profile", Profile{})
+	profile.FieldFunc("loudBio", func(p *Profile, args struct{ Times int64 }) string {
+		return strings.Repeat(strings.ToUpper(p.Bio), int(args.Times))
+	})
+	builtSchema := schema.MustBuild()
+
+	q := graphql.MustParse(`{ users { profile } }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err == nil {
+		t.Error("expected flattened field to be hidden")
+	}
+
+	q = graphql.MustParse(`{ users { name bio loudBio(times: 2) } }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	e := graphql.Executor{}
+	result, err := e.Execute(context.Background(), builtSchema.Query, nil, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, internal.ParseJSON(`{"users": [
+		{"name": "alice", "bio": "hi", "loudBio": "HIHI"},
+		{"name": "bob", "bio": null, "loudBio": null}
+	]}`), internal.AsJSON(result))
+	if profileCalls != 2 {
+		t.Errorf("expected the flattened field to be resolved once per user, but it was resolved %d times", profileCalls)
+	}
+
+	colliding := NewSchema()
+	colliding.Query().FieldFunc("user", func() *User { return nil })
+	colliding.Object("User", User{}).FieldFunc("other", func(u *User) *User { return u }, Flatten)
+	if _, err := colliding.Build(); err == nil || !strings.Contains(err.Error(), "flattened field name collides") {
+		t.Errorf("expected collision to fail, but received %v", err)
+	}
+}
+
+func TestFlattenMetadata(t *testing.T) {
+	type Profile struct {
+		Bio string
+	}
+	type Settings struct {
+		Theme string
+	}
+	type User struct {
+		Name string
+	}
+
+	schema := NewSchema()
+	schema.Query().FieldFunc("user", func() *User { return nil })
+	user := schema.Object("User", User{})
+	user.FieldFunc("profile", func(u *User) *Profile { return nil }, Flatten)
+	profile := schema.Object("Profile", Profile{})
+	profile.FieldFunc("loudBio", func(p *Profile, args struct{ Times int64 }) string {
+		return ""
+	}, Example("HI"), ArgExample("times", int64(2)), Directive("cached", nil))
+	user.FieldFunc("settings", func(u *User) *Settings { return nil }, Flatten, Deprecated("use preferences"))
+	builtSchema := schema.MustBuild()
+
+	userType := builtSchema.Query.(*graphql.Object).Fields["user"].Type.(*graphql.Object)
+	loudBio := userType.Fields["loudBio"]
+	assert.Equal(t, "HI", loudBio.Example)
+	assert.Equal(t, map[string]interface{}{"times": int64(2)}, loudBio.ArgExamples)
+	assert.Equal(t, []graphql.Directive{{Name: "cached"}}, loudBio.Directives)
+	assert.Equal(t, "use preferences", userType.Fields["theme"].DeprecationReason)
+}
+
+func TestFlattenVersions(t *testing.T) {
+	type Profile struct {
+		Bio string
+	}
+	type Settings struct {
+		Theme string
+	}
+	type User struct {
+		Name string
+	}
+
+	schema := NewSchema()
+	schema.VersionFunc(func(ctx context.Context) string { return "v1" })
+	schema.Query().FieldFunc("user", func() *User { return &User{Name: "alice"} })
+	user := schema.Object("User", User{})
+	user.FieldFunc("profile", func(u *User) *Profile { return &Profile{Bio: "hi"} }, Flatten)
+	user.VersionedFieldFunc("settings", map[string]interface{}{
+		"v2": func(u *User) *Settings { return &Settings{Theme: "dark"} },
+	}, Flatten)
+	profile := schema.Object("Profile", Profile{})
+	profile.VersionedFieldFunc("headline", map[string]interface{}{
+		"v1": func(p *Profile) string { return "v1 " + p.Bio },
+		"v2": func(p *Profile) string { return "v2 " + p.Bio },
+	})
+	builtSchema := schema.MustBuild()
+
+	userType := builtSchema.Query.(*graphql.Object).Fields["user"].Type.(*graphql.Object)
+	assert.Equal(t, []string{"v1", "v2"}, userType.Fields["headline"].Versions)
+	assert.Equal(t, []string{"v2"}, userType.Fields["theme"].Versions)
+
+	q := graphql.MustParse(`{ user { name headline } }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	e := graphql.Executor{}
+	result, err := e.Execute(context.Background(), builtSchema.Query, nil, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, internal.ParseJSON(`{"user": {"name": "alice", "headline": "v1 hi"}}`), internal.AsJSON(result))
+
+	// The fields of a versioned flattened field exist in its versions only.
+	q = graphql.MustParse(`{ user { theme } }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Execute(context.Background(), builtSchema.Query, nil, q); err == nil || err.Error() != `unknown field "theme"` {
+		t.Errorf("expected theme not to exist in v1, but received %v", err)
+	}
+}
+
+type customSettings struct {
+	Theme    string
+	FontSize int64
+	values   map[string]interface{}
+}
+
+func (s *customSettings) GraphQLResolve(ctx context.Context, selectionSet *graphql.SelectionSet) (interface{}, error) {
+	fields := make(map[string]interface{})
+	for _, selection := range graphql.Flatten(selectionSet) {
+		value, ok := s.values[selection.Name]
+		if !ok {
+			return nil, fmt.Errorf("unset field %s", selection.Name)
+		}
+		fields[selection.Alias] = value
+	}
+	return fields, nil
+}
+
+func TestCustomResolver(t *testing.T) {
+	schema := NewSchema()
+	schema.Query().FieldFunc("settings", func(args struct{ Complete bool }) *customSettings {
+		values := map[string]interface{}{"theme": "dark"}
+		if args.Complete {
+			values["fontSize"] = 12
+		}
+		return &customSettings{values: values}
+	})
+	builtSchema := schema.MustBuild()
+
+	q := graphql.MustParse(`{ settings(complete: true) { theme size: fontSize } }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	e := graphql.Executor{}
+	result, err := e.Execute(context.Background(), builtSchema.Query, nil, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, internal.ParseJSON(`{"settings": {"theme": "dark", "size": 12}}`), internal.AsJSON(result))
+
+	q = graphql.MustParse(`{ settings(complete: false) { fontSize } }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Execute(context.Background(), builtSchema.Query, nil, q); err == nil || err.Error() != "settings: unset field fontSize" {
+		t.Errorf("expected resolver error, but received %v", err)
+	}
+
+	q = graphql.MustParse(`{ settings(complete: true) { color } }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err == nil {
+		t.Error("expected selections to be validated against the schema")
+	}
+}
+
+func TestListConcurrency(t *testing.T) {
+	type Item struct {
+		Id int64
+	}
+
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+
+	schema := NewSchema()
+	schema.Query().FieldFunc("items", func() []Item {
+		var items []Item
+		for i := int64(0); i < 6; i++ {
+			items = append(items, Item{Id: i})
+		}
+		return items
+	}, ListConcurrency(2))
+	schema.Object("Item", Item{}).FieldFunc("slow", func(ctx context.Context, i Item) int64 {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return i.Id * 10
+	})
+	builtSchema := schema.MustBuild()
+
+	q := graphql.MustParse(`{ items { id slow } }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	e := graphql.Executor{}
+	result, err := e.Execute(context.Background(), builtSchema.Query, nil, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, internal.ParseJSON(`{"items": [
+		{"id": 0, "slow": 0}, {"id": 1, "slow": 10}, {"id": 2, "slow": 20},
+		{"id": 3, "slow": 30}, {"id": 4, "slow": 40}, {"id": 5, "slow": 50}
+	]}`), internal.AsJSON(result))
+	if maxRunning > 2 {
+		t.Errorf("expected at most 2 concurrent resolvers, but %d ran", maxRunning)
+	}
+
+	invalid := NewSchema()
+	invalid.Query().FieldFunc("item", func() Item { return Item{} }, ListConcurrency(2))
+	if _, err := invalid.Build(); err == nil {
+		t.Error("expected list concurrency on a non-list field to fail")
+	}
+}
+
+func TestMocks(t *testing.T) {
+	type User struct {
+		Name     string
+		Color    color
+		Created  time.Time
+		Nickname *string
+	}
+
+	schema := NewSchema()
+	schema.StringerEnum([]color{red, green, blue})
+	query := schema.Query()
+	query.FieldFunc("version", func() string { return "v1" })
+	query.FieldFunc("users", func() ([]*User, error) {
+		return nil, graphql.ErrNotImplemented
+	})
+	schema.Object("User", User{})
+	builtSchema := schema.MustBuild()
+
+	q := graphql.MustParse(`{ version users { __typename name color created nickname } }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+
+	epoch := time.Unix(0, 0).UTC()
+	execute := func() interface{} {
+		e := graphql.NewExecutor(graphql.WithMocks(graphql.MockConfig{
+			Seed:            1,
+			ListLength:      3,
+			NullProbability: 0.5,
+			Generators: map[string]graphql.MockGenerator{
+				"Time": func(r *rand.Rand, selectionSet *graphql.SelectionSet) interface{} { return epoch },
+			},
+		}))
+		result, err := e.Execute(context.Background(), builtSchema.Query, nil, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return internal.AsJSON(result)
+	}
+
+	result := execute()
+	assert.Equal(t, result, execute())
+
+	fields := result.(map[string]interface{})
+	assert.Equal(t, "v1", fields["version"])
+	users, ok := fields["users"].([]interface{})
+	if !ok || len(users) != 3 {
+		t.Fatalf("expected 3 mocked users, received %v", fields["users"])
+	}
+	for _, user := range users {
+		user := user.(map[string]interface{})
+		assert.Equal(t, "User", user["__typename"])
+		assert.Equal(t, internal.AsJSON(epoch), user["created"])
+		if name, ok := user["name"].(string); !ok || name == "" {
+			t.Errorf("expected a mocked name, received %v", user["name"])
+		}
+		if color := user["color"]; color != "red" && color != "green" && color != "blue" {
+			t.Errorf("expected a mocked color, received %v", color)
+		}
+	}
+
+	if _, err := graphql.NewExecutor().Execute(context.Background(), builtSchema.Query, nil, q); err == nil || err.Error() != "users: not implemented" {
+		t.Errorf("expected unimplemented field to fail without mocks, but received %v", err)
+	}
+}
+
+func TestEnumListArgs(t *testing.T) {
+	type filter struct {
+		Colors []color
+		Main   *color
+	}
+
+	schema := NewSchema()
+	schema.StringerEnum([]color{red, green, blue})
+	schema.Query().FieldFunc("search", func(args struct {
+		Colors  []color
+		Filters []filter
+	}) string {
+		description := fmt.Sprint(args.Colors)
+		for _, filter := range args.Filters {
+			description += fmt.Sprint(" ", filter.Colors)
+			if filter.Main != nil {
+				description += fmt.Sprint(" main ", *filter.Main)
+			}
+		}
+		return description
+	})
+	builtSchema := schema.MustBuild()
+
+	for _, c := range []struct {
+		query    string
+		vars     map[string]interface{}
+		expected string
+		err      string
+	}{
+		{
+			query:    `{ search(colors: [red, blue], filters: [{colors: [green], main: red}]) }`,
+			expected: "[red blue] [green] main red",
+		},
+		{
+			query:    `query Search($colors: [color!]!) { search(colors: $colors, filters: [{colors: $colors}]) }`,
+			vars:     map[string]interface{}{"colors": []interface{}{"green", "blue"}},
+			expected: "[green blue] [green blue]",
+		},
+		{
+			query: `{ search(colors: [red, pink], filters: []) }`,
+			err:   `error parsing args for "search": colors: 1: unknown enum value pink`,
+		},
+		{
+			query: `{ search(colors: [], filters: [{colors: [green]}, {colors: [red], main: pink}]) }`,
+			err:   `error parsing args for "search": filters: 1: main: unknown enum value pink`,
+		},
+		{
+			query: `query Search($colors: [color!]!) { search(colors: [], filters: [{colors: $colors}]) }`,
+			vars:  map[string]interface{}{"colors": []interface{}{"pink"}},
+			err:   `error parsing args for "search": filters: 0: colors: 0: unknown enum value pink`,
+		},
+	} {
+		q, err := graphql.Parse(c.query, c.vars)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+			if err.Error() != c.err {
+				t.Errorf("%s: expected error %q, but received %q", c.query, c.err, err)
+			}
+			continue
+		}
+		e := graphql.Executor{}
+		result, err := e.Execute(context.Background(), builtSchema.Query, nil, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, map[string]interface{}{"search": c.expected}, result)
+	}
+}
+
+// protoContact mimics a message generated by protoc-gen-go.
+type protoContact struct {
+	DisplayName          string                `protobuf:"bytes,1,opt,name=display_name,json=displayName,proto3" json:"display_name,omitempty"`
+	Nickname             *string               `protobuf:"bytes,2,opt,name=nickname,proto3,oneof" json:"nickname,omitempty"`
+	Tags                 []string              `protobuf:"bytes,3,rep,name=tags,proto3" json:"tags,omitempty"`
+	Address              *protoAddress         `protobuf:"bytes,6,opt,name=address,proto3" json:"address,omitempty"`
+	Method               isProtoContact_Method `protobuf_oneof:"method"`
+	XXX_NoUnkeyedLiteral struct{}              `json:"-"`
+	XXX_unrecognized     []byte                `json:"-"`
+	XXX_sizecache        int32                 `json:"-"`
+}
+
+type isProtoContact_Method interface {
+	isProtoContact_Method()
+}
+
+type protoContact_Email struct {
+	Email string `protobuf:"bytes,4,opt,name=email,proto3,oneof"`
+}
+
+type protoContact_PhoneNumber struct {
+	PhoneNumber int64 `protobuf:"varint,5,opt,name=phone_number,json=phoneNumber,proto3,oneof"`
+}
+
+func (*protoContact_Email) isProtoContact_Method()       {}
+func (*protoContact_PhoneNumber) isProtoContact_Method() {}
+
+func (*protoContact) XXX_OneofWrappers() []interface{} {
+	return []interface{}{
+		(*protoContact_Email)(nil),
+		(*protoContact_PhoneNumber)(nil),
+	}
+}
+
+type protoAddress struct {
+	City string `protobuf:"bytes,1,opt,name=city,proto3" json:"city,omitempty"`
+}
+
+func TestRegisterProto(t *testing.T) {
+	nickname := "bobby"
+	schema := NewSchema()
+	schema.Query().FieldFunc("contacts", func() []*protoContact {
+		return []*protoContact{
+			{DisplayName: "Bob", Nickname: &nickname, Tags: []string{"friend"}, Method: &protoContact_Email{Email: "bob@example.com"}},
+			{DisplayName: "Alice", Address: &protoAddress{City: "Paris"}, Method: &protoContact_PhoneNumber{PhoneNumber: 5551234}},
+		}
+	})
+	schema.RegisterProto(&protoContact{})
+	schema.RegisterProto(&protoAddress{})
+	builtSchema := schema.MustBuild()
+
+	q := graphql.MustParse(`{ contacts { displayName nickname tags email phoneNumber address { city } } }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	e := graphql.Executor{}
+	result, err := e.Execute(context.Background(), builtSchema.Query, nil, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, internal.ParseJSON(`{"contacts": [
+		{"displayName": "Bob", "nickname": "bobby", "tags": ["friend"], "email": "bob@example.com", "phoneNumber": null, "address": null},
+		{"displayName": "Alice", "nickname": null, "tags": [], "email": null, "phoneNumber": 5551234, "address": {"city": "Paris"}}
+	]}`), internal.AsJSON(result))
+
+	for _, query := range []string{
+		`{ contacts { xxxUnrecognized } }`,
+		`{ contacts { method } }`,
+	} {
+		if err := graphql.PrepareQuery(builtSchema.Query, graphql.MustParse(query, nil).SelectionSet); err == nil {
+			t.Errorf("expected %s to fail, since the field is not a proto field", query)
+		}
+	}
+}
+
+func TestFieldFuncIf(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		schema := NewSchema()
+		query := schema.Query()
+		query.FieldFuncIf(enabled, "version", func() string { return "v2" })
+		query.FieldFuncIf(!enabled, "version", func() int64 { return 1 })
+		builtSchema := schema.MustBuild()
+
+		q := graphql.MustParse(`{ version }`, nil)
+		if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+			t.Fatal(err)
+		}
+		e := graphql.Executor{}
+		result, err := e.Execute(context.Background(), builtSchema.Query, nil, q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if enabled {
+			assert.Equal(t, map[string]interface{}{"version": "v2"}, result)
+		} else {
+			assert.Equal(t, map[string]interface{}{"version": int64(1)}, result)
+		}
+	}
+}
+
+func TestSelected(t *testing.T) {
+	type Order struct {
+		Id    int64
+		Items []string
+	}
+	type User struct {
+		Name string
+	}
+
+	var selected []bool
+	schema := NewSchema()
+	schema.Query().FieldFunc("user", func(ctx context.Context) *User {
+		selected = []bool{
+			graphql.Selected(ctx, "user.orders"),
+			graphql.Selected(ctx, "user.orders.items"),
+			graphql.Selected(ctx, "user.name"),
+		}
+		return &User{}
+	})
+	schema.Object("User", User{}).FieldFunc("orders", func(u *User) []Order { return nil })
+	builtSchema := schema.MustBuild()
+
+	for _, c := range []struct {
+		query    string
+		expected []bool
+	}{
+		{query: `{ user { name } }`, expected: []bool{false, false, true}},
+		{query: `{ me: user { purchases: orders { id } } }`, expected: []bool{true, false, false}},
+		{query: `{ user { ...Orders } } fragment Orders on User { orders { items } }`, expected: []bool{true, true, false}},
+	} {
+		q := graphql.MustParse(c.query, nil)
+		if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+			t.Fatal(err)
+		}
+		e := graphql.Executor{}
+		if _, err := e.Execute(context.Background(), builtSchema.Query, nil, q); err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, c.expected, selected)
+	}
+
+	if graphql.Selected(context.Background(), "user") {
+		t.Error("expected nothing to be selected outside of an execution")
+	}
+}
+
+func TestRelate(t *testing.T) {
+	type User struct {
+		Id int64
+	}
+	type Post struct {
+		Id       int64
+		AuthorId int64
+	}
+	posts := []*Post{{Id: 1, AuthorId: 10}, {Id: 2, AuthorId: 20}, {Id: 3, AuthorId: 10}}
+
+	var mu sync.Mutex
+	var calls []string
+	schema := NewSchema()
+	schema.Query().FieldFunc("users", func() []*User {
+		return []*User{{Id: 10}, {Id: 20}, {Id: 30}}
+	})
+	schema.Query().FieldFunc("posts", func() []*Post {
+		return posts
+	})
+	user := schema.Object("User", User{})
+	post := schema.Object("Post", Post{})
+	schema.Relate(user, "posts", post, "author", func(ctx context.Context, direction RelationDirection, sources []interface{}) ([]interface{}, error) {
+		mu.Lock()
+		calls = append(calls, fmt.Sprint(direction, " ", len(sources)))
+		mu.Unlock()
+
+		results := make([]interface{}, len(sources))
+		for i, source := range sources {
+			switch direction {
+			case Forward:
+				var children []*Post
+				for _, p := range posts {
+					if p.AuthorId == source.(*User).Id {
+						children = append(children, p)
+					}
+				}
+				results[i] = children
+			case Reverse:
+				if authorId := source.(*Post).AuthorId; authorId != 30 {
+					results[i] = &User{Id: authorId}
+				}
+			}
+		}
+		return results, nil
+	})
+	builtSchema := schema.MustBuild()
+
+	q := graphql.MustParse(`{ users { id posts { id } } posts { id author { id } } }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	e := graphql.Executor{}
+	result, err := e.Execute(batch.WithBatching(context.Background()), builtSchema.Query, nil, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, internal.ParseJSON(`{
+		"users": [
+			{"id": 10, "posts": [{"id": 1}, {"id": 3}]},
+			{"id": 20, "posts": [{"id": 2}]},
+			{"id": 30, "posts": []}
+		],
+		"posts": [
+			{"id": 1, "author": {"id": 10}},
+			{"id": 2, "author": {"id": 20}},
+			{"id": 3, "author": {"id": 10}}
+		]
+	}`), internal.AsJSON(result))
+
+	sort.Strings(calls)
+	assert.Equal(t, []string{"0 3", "1 3"}, calls)
+}
+
+func TestResolveHooks(t *testing.T) {
+	type User struct {
+		Name string
+	}
+	type prefixKey struct{}
+
+	schema := NewSchema()
+	query := schema.Query()
+	query.FieldFunc("users", func() []*User {
+		return []*User{{Name: "Alice"}, {Name: "Bob"}}
+	})
+	user := schema.Object("User", User{})
+	user.FieldFunc("greeting", func(ctx context.Context, u *User) string {
+		return ctx.Value(prefixKey{}).(string) + u.Name
+	})
+
+	var mu sync.Mutex
+	var events []string
+	user.OnResolveStart(func(ctx context.Context, parent interface{}) (context.Context, error) {
+		switch parent.(*User).Name {
+		case "Mallory":
+			return nil, errors.New("no access")
+		case "Trudy":
+			panic("no access")
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, "start "+parent.(*User).Name)
+		return context.WithValue(ctx, prefixKey{}, "hello "), nil
+	})
+	user.OnResolveEnd(func(ctx context.Context, parent interface{}, result interface{}, err error) {
+		// greeting takes a context, so it is resolved in the background, and
+		// the hook is called once it completes.
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, "end "+result.(map[string]interface{})["greeting"].(string))
+	})
+	builtSchema := schema.MustBuild()
+
+	q := graphql.MustParse(`{ users { name greeting } }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	e := graphql.Executor{}
+	result, err := e.Execute(context.Background(), builtSchema.Query, nil, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, internal.ParseJSON(`{"users": [
+		{"name": "Alice", "greeting": "hello Alice"},
+		{"name": "Bob", "greeting": "hello Bob"}
+	]}`), internal.AsJSON(result))
+	sort.Strings(events)
+	assert.Equal(t, []string{"end hello Alice", "end hello Bob", "start Alice", "start Bob"}, events)
+
+	query.FieldFunc("mallory", func() *User {
+		return &User{Name: "Mallory"}
+	})
+	builtSchema = schema.MustBuild()
+	q = graphql.MustParse(`{ mallory { name } }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Execute(context.Background(), builtSchema.Query, nil, q); err == nil || err.Error() != "mallory: no access" {
+		t.Errorf("expected start hook error, but received %v", err)
+	}
+
+	query.FieldFunc("trudy", func() *User {
+		return &User{Name: "Trudy"}
+	})
+	builtSchema = schema.MustBuild()
+	q = graphql.MustParse(`{ trudy { name } }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Execute(context.Background(), builtSchema.Query, nil, q); err == nil || err.Error() != "trudy: graphql: panic: no access" {
+		t.Errorf("expected start hook panic to be recovered, but received %v", err)
+	}
+}
+
+type displayNamer interface {
+	DisplayName() string
+}
+
+type namedUser struct {
+	Name string
+}
+
+func (u namedUser) DisplayName() string { return "user " + u.Name }
+
+type namedTeam struct {
+	Name string
+}
+
+func (t *namedTeam) DisplayName() string { return "team " + t.Name }
+
+func TestInterfaceSource(t *testing.T) {
+	schema := NewSchema()
+	query := schema.Query()
+	query.FieldFunc("user", func() namedUser {
+		return namedUser{Name: "alice"}
+	})
+	query.FieldFunc("team", func() namedTeam {
+		return namedTeam{Name: "core"}
+	})
+
+	displayName := func(n displayNamer) string {
+		return n.DisplayName()
+	}
+	schema.Object("User", namedUser{}).FieldFunc("displayName", displayName)
+	schema.Object("Team", namedTeam{}).FieldFunc("displayName", displayName)
+	builtSchema := schema.MustBuild()
+
+	q := graphql.MustParse(`{ user { displayName } team { displayName } }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	e := graphql.Executor{}
+	result, err := e.Execute(context.Background(), builtSchema.Query, nil, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, internal.ParseJSON(`{
+		"user": {"displayName": "user alice"},
+		"team": {"displayName": "team core"}
+	}`), internal.AsJSON(result))
+
+	other := NewSchema()
+	other.Query().FieldFunc("user", func() namedUser { return namedUser{} })
+	other.Object("User", namedUser{}).FieldFunc("bad", func(s fmt.Stringer) string { return "" })
+	if _, err := other.Build(); err == nil {
+		t.Error("expected an interface the object does not implement to fail")
+	}
+}
+
+func TestDiff(t *testing.T) {
+	type User struct {
+		Name  string
+		Email *string
+	}
+	type Role int
+
+	build := func(changed bool) *graphql.Schema {
+		schema := NewSchema()
+		var role Role
+		roles := map[string]Role{"admin": 0, "member": 1}
+		if changed {
+			roles = map[string]Role{"admin": 0, "guest": 2}
+		}
+		schema.Enum(role, roles)
+
+		query := schema.Query()
+		user := schema.Object("User", User{})
+		user.FieldFunc("role", func(u *User) Role { return 0 })
+		if changed {
+			type Filter struct {
+				Name  *string
+				Limit *int64
+				Team  string
+			}
+			query.FieldFunc("users", func(args struct {
+				Filter Filter
+				Sort   *string
+				Count  int64
+			}) []*User {
+				return nil
+			})
+			query.FieldFunc("me", func() (*User, error) { return nil, nil }, NonNullable)
+			user.FieldFunc("nickname", func(u *User) *string { return nil })
+		} else {
+			type Filter struct {
+				Name  string
+				Limit *int64
+			}
+			query.FieldFunc("users", func(args struct {
+				Filter Filter
+				Page   int64
+				Count  *int64
+			}) []*User {
+				return nil
+			})
+			query.FieldFunc("me", func() (*User, error) { return nil, nil })
+			query.FieldFunc("count", func() int64 { return 0 })
+		}
+		return schema.MustBuild()
+	}
+
+	type change struct {
+		Kind     ChangeKind
+		Path     string
+		Breaking bool
+	}
+	var changes []change
+	for _, c := range Diff(build(false), build(true)) {
+		changes = append(changes, change{Kind: c.Kind, Path: c.Path, Breaking: c.Breaking})
+	}
+	assert.Equal(t, []change{
+		{InputFieldTypeChanged, "Filter_InputObject.name", false},
+		{InputFieldAdded, "Filter_InputObject.team", true},
+		{FieldRemoved, "Query.count", true},
+		{FieldTypeChanged, "Query.me", false},
+		{ArgTypeChanged, "Query.users(count)", true},
+		{ArgRemoved, "Query.users(page)", true},
+		{ArgAdded, "Query.users(sort)", false},
+		{EnumValueAdded, "Role.guest", false},
+		{EnumValueRemoved, "Role.member", true},
+		{FieldAdded, "User.nickname", false},
+	}, changes)
+
+	assert.Empty(t, Diff(build(false), build(false)))
+}
+
+func TestTimeFormat(t *testing.T) {
+	type Event struct {
+		Start time.Time
+	}
+	start := time.Date(2020, 3, 4, 15, 30, 0, 0, time.FixedZone("PST", -8*60*60))
+
+	schema := NewSchema()
+	schema.TimeFormat("2006-01-02 15:04 MST")
+	schema.TimeInUTC()
+	query := schema.Query()
+	query.FieldFunc("event", func() Event {
+		return Event{Start: start}
+	})
+	query.FieldFunc("days", func() []time.Time {
+		return []time.Time{start}
+	}, TimeFormat("2006-01-02"))
+	query.FieldFunc("echo", func(args struct{ At time.Time }) time.Time {
+		return args.At
+	})
+	builtSchema := schema.MustBuild()
+
+	e := graphql.Executor{}
+	execute := func(query string) (interface{}, error) {
+		q := graphql.MustParse(query, nil)
+		if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+			return nil, err
+		}
+		return e.Execute(context.Background(), builtSchema.Query, nil, q)
+	}
+
+	result, err := execute(`{ event { start } days echo(at: "2020-03-04 08:00 PST") }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, internal.ParseJSON(`{
+		"event": {"start": "2020-03-04 23:30 UTC"},
+		"days": ["2020-03-04"],
+		"echo": "2020-03-04 08:00 UTC"
+	}`), internal.AsJSON(result))
+
+	if _, err := execute(`{ echo(at: "2020-03-04T08:00:00Z") }`); err == nil || !strings.Contains(err.Error(), `not a time in the format "2006-01-02 15:04 MST"`) {
+		t.Errorf("expected time in another format to fail, but received %v", err)
+	}
+
+	bad := NewSchema()
+	bad.Query().FieldFunc("name", func() string { return "" }, TimeFormat("2006-01-02"))
+	if _, err := bad.Build(); err == nil || !strings.Contains(err.Error(), "time format requires a time result") {
+		t.Errorf("expected time format on a string field to fail, but received %v", err)
+	}
+}
+
+func TestJSONScalar(t *testing.T) {
+	type Item struct {
+		Metadata map[string]interface{}
+	}
+
+	schema := NewSchema()
+	query := schema.Query()
+	query.FieldFunc("item", func() Item {
+		return Item{Metadata: map[string]interface{}{"tags": []string{"a", "b"}, "count": 3}}
+	})
+	query.FieldFunc("raw", func() json.RawMessage {
+		return json.RawMessage(`{"id": 12345678901234567890, "nested": {"ok": true}}`)
+	})
+	query.FieldFunc("invalid", func() json.RawMessage {
+		return json.RawMessage(`{"id":`)
+	})
+	query.FieldFunc("echo", func(args struct {
+		Value interface{}
+		Raw   json.RawMessage
+	}) []interface{} {
+		return []interface{}{args.Value, args.Raw}
+	})
+	query.FieldFunc("echoPtr", func(args struct {
+		Raw *json.RawMessage
+	}) string {
+		if args.Raw == nil {
+			return "nil"
+		}
+		return string(*args.Raw)
+	})
+	builtSchema := schema.MustBuild()
+
+	e := graphql.Executor{}
+	execute := func(query string) (interface{}, error) {
+		q := graphql.MustParse(query, nil)
+		if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+			return nil, err
+		}
+		return e.Execute(context.Background(), builtSchema.Query, nil, q)
+	}
+
+	result, err := execute(`{ item { metadata } raw echo(value: {a: [1, "two"]}, raw: [true]) }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bytes, err := json.Marshal(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, `{"echo":[{"a":[1,"two"]},[true]],"item":{"metadata":{"count":3,"tags":["a","b"]}},"raw":{"id":12345678901234567890,"nested":{"ok":true}}}`, string(bytes))
+
+	result, err = execute(`{ echo }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, internal.ParseJSON(`{"echo": [null, null]}`), internal.AsJSON(result))
+
+	result, err = execute(`{ set: echoPtr(raw: {a: [1]}) unset: echoPtr }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, internal.ParseJSON(`{"set": "{\"a\":[1]}", "unset": "nil"}`), internal.AsJSON(result))
+
+	if _, err := execute(`{ invalid }`); err == nil || !strings.Contains(err.Error(), "not valid JSON") {
+		t.Errorf("expected invalid JSON to fail, but received %v", err)
+	}
+}
+
+type dateRange struct {
+	From, To string
+}
+
+func (r *dateRange) UnmarshalGraphQL(value interface{}) error {
+	asString, ok := value.(string)
+	if !ok {
+		return errors.New("not a string")
+	}
+	parts := strings.Split(asString, "..")
+	if len(parts) != 2 {
+		return fmt.Errorf("%q is not a range like 2020-01-01..2020-02-01", asString)
+	}
+	r.From, r.To = parts[0], parts[1]
+	return nil
+}
+
+func TestUnmarshalerArgs(t *testing.T) {
+	schema := NewSchema()
+	query := schema.Query()
+	query.FieldFunc("report", func(args struct {
+		Period dateRange
+		Others []*dateRange
+	}) string {
+		result := args.Period.From + " to " + args.Period.To
+		for _, other := range args.Others {
+			result += ", " + other.From + " to " + other.To
+		}
+		return result
+	})
+	builtSchema := schema.MustBuild()
+
+	e := graphql.Executor{}
+	execute := func(query string) (interface{}, error) {
+		q := graphql.MustParse(query, nil)
+		if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+			return nil, err
+		}
+		return e.Execute(context.Background(), builtSchema.Query, nil, q)
+	}
+
+	result, err := execute(`{ report(period: "2020-01-01..2020-02-01", others: ["2019-01-01..2019-02-01"]) }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, internal.ParseJSON(`{"report": "2020-01-01 to 2020-02-01, 2019-01-01 to 2019-02-01"}`), internal.AsJSON(result))
+
+	_, err = execute(`{ report(period: "2020-01-01..2020-02-01", others: ["2019"]) }`)
+	if err == nil || !strings.Contains(err.Error(), `others: 0: "2019" is not a range like 2020-01-01..2020-02-01`) {
+		t.Errorf("expected bad range to fail with its path, but received %v", err)
+	}
+
+	argType := builtSchema.Query.(*graphql.Object).Fields["report"].Args["period"]
+	assert.Equal(t, "dateRange!", argType.String())
+}
+
+func TestBytesArgs(t *testing.T) {
+	schema := NewSchema()
+	query := schema.Query()
+	query.FieldFunc("reverse", func(args struct{ Data []byte }) []byte {
+		reversed := make([]byte, len(args.Data))
+		for i, b := range args.Data {
+			reversed[len(args.Data)-1-i] = b
+		}
+		return reversed
+	})
+	builtSchema := schema.MustBuild()
+
+	e := graphql.Executor{}
+	execute := func(query string) (interface{}, error) {
+		q := graphql.MustParse(query, nil)
+		if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+			return nil, err
+		}
+		return e.Execute(context.Background(), builtSchema.Query, nil, q)
+	}
+
+	// "YmFy" is "bar" and "cmFi" is "rab".
+	result, err := execute(`{ reverse(data: "YmFy") }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, internal.ParseJSON(`{"reverse": "cmFi"}`), internal.AsJSON(result))
+
+	if _, err := execute(`{ reverse(data: "not base64!") }`); err == nil || !strings.Contains(err.Error(), "data: not a base64 string") {
+		t.Errorf("expected bad base64 to fail with the argument's name, but received %v", err)
+	}
+
+	argType := builtSchema.Query.(*graphql.Object).Fields["reverse"].Args["data"]
+	assert.Equal(t, "bytes!", argType.String())
+}
+
+func TestSDL(t *testing.T) {
+	type Size int32
+	type Item struct {
+		Name string
+	}
+	type Node struct {
+		Interface
+		*Item
+	}
+	type Filter struct {
+		Prefix string
+		Limit  *int64
+	}
+
+	schema := NewSchema()
+	schema.Enum(Size(1), map[string]interface{}{
+		"small": Size(1),
+		"large": Size(2),
+	})
+	item := schema.Object("Item", Item{})
+	item.Description = "An item.\nWith two lines."
+	item.Key("name")
+	item.Directive("key", map[string]interface{}{"fields": "name"})
+	item.FieldFunc("size", func() Size { return 1 })
+	query := schema.Query()
+	query.FieldFunc("item", func() *Item {
+		return nil
+	}, Deprecated("use items"), Directive("cached", map[string]interface{}{"ttl": 60, "scope": []string{"user"}}))
+	query.FieldFunc("items", func(args struct {
+		Filter *Filter
+		Count  int64
+	}) []*Item {
+		return nil
+	})
+	query.FieldFunc("node", func() *Node { return nil })
+	query.PaginateFieldFunc("pages", func() []*Item {
+		return nil
+	})
+	schema.Mutation().FieldFunc("reset", func() bool { return true })
+	schema.SpecifiedBy(int64(0), "https://example.com/int64")
+	schema.EnumValueDirective(Size(1), "small", "deprecated", map[string]interface{}{"reason": "use large"})
+
+	assert.Equal(t, `input Filter_InputObject {
+  limit: int64
+  prefix: string!
+}
+
+"""
+An item.
+With two lines.
+"""
+type Item implements Node @key(fields: "name") {
+  name: string!
+  size: Size!
+}
+
+type ItemConnection {
+  edges: [ItemEdge!]!
+  pageInfo: PageInfo!
+  totalCount: int64!
+}
+
+type ItemEdge {
+  cursor: string!
+  node: Item
+}
+
+type Mutation {
+  reset: bool!
+}
+
+interface Node {
+  name: string!
+  size: Size!
+}
+
+type PageInfo {
+  endCursor: string!
+  hasNextPage: bool!
+  hasPrevPage: bool!
+  pages: [string!]!
+  startCursor: string!
+}
+
+type Query {
+  item: Item @deprecated(reason: "use items") @cached(scope: ["user"], ttl: 60)
+  items(count: int64!, filter: Filter_InputObject): [Item!]!
+  node: Node
+  pages(after: string, before: string, first: int64, last: int64): ItemConnection!
+}
+
+enum Size {
+  large
+  small @deprecated(reason: "use large")
+}
+
+scalar bool
+
+scalar int64 @specifiedBy(url: "https://example.com/int64")
+
+scalar string
+`, SDL(schema.MustBuild()))
+
+	empty := NewSchema()
+	empty.Query().FieldFunc("ok", func() bool { return true })
+	assert.Equal(t, "type Query {\n  ok: bool!\n}\n\nscalar bool\n", SDL(empty.MustBuild()))
+}
+
+func TestExamples(t *testing.T) {
+	type User struct {
+		Email string
+	}
+
+	schema := NewSchema()
+	query := schema.Query()
+	query.FieldFunc("users", func(args struct{ Limit *int64 }) []*User {
+		return nil
+	}, Example([]*User{{Email: "alice@example.com"}}), ArgExample("limit", int64(10)))
+	user := schema.Object("User", User{})
+	user.FieldFunc("email", func(u *User) string {
+		return u.Email
+	}, Example("alice@example.com"))
+	builtSchema := schema.MustBuild()
+
+	assert.Equal(t, map[string]interface{}{
+		"Query.users":        []*User{{Email: "alice@example.com"}},
+		"Query.users(limit)": int64(10),
+		"User.email":         "alice@example.com",
+	}, Examples(builtSchema))
+
+	for _, c := range []struct {
+		option FieldFuncOption
+		err    string
+	}{
+		{Example(3), "bad method name on type schemabuilder.query: example 3 is a int, not a string"},
+		{ArgExample("limit", "ten"), "bad method name on type schemabuilder.query: example ten of argument limit is a string, not a *int64"},
+		{ArgExample("offset", int64(0)), "bad method name on type schemabuilder.query: example of unknown argument offset"},
+	} {
+		schema := NewSchema()
+		schema.Query().FieldFunc("name", func(args struct{ Limit *int64 }) string {
+			return ""
+		}, c.option)
+		if _, err := schema.Build(); err == nil || err.Error() != c.err {
+			t.Errorf("expected %q, but received %v", c.err, err)
+		}
+	}
+}
+
+type money struct {
+	Cents    int64
+	Currency string
+}
+
+func (m money) MarshalGraphQL() (interface{}, error) {
+	return fmt.Sprintf("%d.%02d %s", m.Cents/100, m.Cents%100, m.Currency), nil
+}
+
+type accountNumber struct {
+	Branch, Account int
+}
+
+func (n *accountNumber) MarshalGraphQL() (interface{}, error) {
+	return fmt.Sprintf("%03d-%06d", n.Branch, n.Account), nil
+}
+
+func TestMarshaler(t *testing.T) {
+	type Account struct {
+		Balance money
+		Number  accountNumber
+		Limit   *money
+	}
+
+	schema := NewSchema()
+	query := schema.Query()
+	query.FieldFunc("account", func() Account {
+		return Account{Balance: money{Cents: 1050, Currency: "USD"}, Number: accountNumber{Branch: 7, Account: 42}}
+	})
+	query.FieldFunc("history", func() []*money {
+		return []*money{{Cents: 5, Currency: "EUR"}}
+	})
+	builtSchema := schema.MustBuild()
+
+	q := graphql.MustParse(`{ account { balance number limit } history }`, nil)
+	if err := graphql.PrepareQuery(builtSchema.Query, q.SelectionSet); err != nil {
+		t.Fatal(err)
+	}
+	e := graphql.Executor{}
+	result, err := e.Execute(context.Background(), builtSchema.Query, nil, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, internal.ParseJSON(`{
+		"account": {"balance": "10.50 USD", "number": "007-000042", "limit": null},
+		"history": ["0.05 EUR"]
+	}`), internal.AsJSON(result))
+
+	account := builtSchema.Query.(*graphql.Object).Fields["account"].Type.(*graphql.NonNull).Type.(*graphql.Object)
+	assert.Equal(t, "money!", account.Fields["balance"].Type.String())
+	assert.Equal(t, "money", account.Fields["limit"].Type.String())
+}
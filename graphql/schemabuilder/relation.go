@@ -0,0 +1,107 @@
+package schemabuilder
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+
+	"github.com/samsarahq/thunder/batch"
+)
+
+// RelationDirection is the direction in which a RelationLoader loads a
+// relationship.
+type RelationDirection int
+
+const (
+	// Forward loads the children of parents, such as the posts of users.
+	Forward RelationDirection = iota
+	// Reverse loads the parent of children, such as the author of posts.
+	Reverse
+)
+
+// A RelationLoader loads a one-to-many relationship for a batch of sources.
+// Loading Forward, sources are parents and each result is a slice of their
+// children. Loading Reverse, sources are children and each result is their
+// parent, or nil. Results are returned in the order of sources. Parents and
+// children are passed as pointers to the types of the related objects.
+type RelationLoader func(ctx context.Context, direction RelationDirection, sources []interface{}) ([]interface{}, error)
+
+type relationCall struct {
+	direction RelationDirection
+	source    interface{}
+}
+
+// Relate declares a one-to-many relationship between the objects parent and
+// child, such as users and their posts, and registers a field for each
+// direction: forwardName on parent for the children, and reverseName on child
+// for the parent. For example:
+//    schema.Relate(user, "posts", post, "author", loadPosts)
+//
+// Both fields are resolved with loader. Concurrent resolutions in the same
+// direction are combined into a single call to loader when the context has
+// batching enabled, as it does for queries served by graphql.HTTPHandler.
+// The children field is non-nullable and the parent field is nullable.
+func (s *Schema) Relate(parent *Object, forwardName string, child *Object, reverseName string, loader RelationLoader) {
+	parentType := reflect.PtrTo(reflect.TypeOf(parent.Type))
+	childType := reflect.PtrTo(reflect.TypeOf(child.Type))
+
+	f := &batch.Func{
+		Many: func(ctx context.Context, args []interface{}) ([]interface{}, error) {
+			// Func shards by direction, so every call in a batch has the same
+			// direction.
+			sources := make([]interface{}, len(args))
+			for i, arg := range args {
+				sources[i] = arg.(relationCall).source
+			}
+			return loader(ctx, args[0].(relationCall).direction, sources)
+		},
+		Shard: func(arg interface{}) interface{} {
+			return arg.(relationCall).direction
+		},
+	}
+	load := func(ctx context.Context, direction RelationDirection, source interface{}) (interface{}, error) {
+		if !batch.HasBatching(ctx) {
+			results, err := loader(ctx, direction, []interface{}{source})
+			if err != nil {
+				return nil, err
+			}
+			if len(results) != 1 {
+				return nil, fmt.Errorf("relation loader returned %d results for 1 source", len(results))
+			}
+			return results[0], nil
+		}
+		return f.Invoke(ctx, relationCall{direction: direction, source: source})
+	}
+
+	parent.FieldFunc(forwardName, makeRelationFunc(Forward, parentType, reflect.SliceOf(childType), load))
+	child.FieldFunc(reverseName, makeRelationFunc(Reverse, childType, parentType, load))
+}
+
+// makeRelationFunc makes a func(context.Context, sourceType) (resultType,
+// error) that resolves a direction of a relationship with load.
+func makeRelationFunc(direction RelationDirection, sourceType, resultType reflect.Type, load func(context.Context, RelationDirection, interface{}) (interface{}, error)) interface{} {
+	fnType := reflect.FuncOf(
+		[]reflect.Type{contextType, sourceType},
+		[]reflect.Type{resultType, errType},
+		false,
+	)
+	fn := reflect.MakeFunc(fnType, func(in []reflect.Value) []reflect.Value {
+		fail := func(err error) []reflect.Value {
+			return []reflect.Value{reflect.Zero(resultType), reflect.ValueOf(&err).Elem()}
+		}
+
+		result, err := load(in[0].Interface().(context.Context), direction, in[1].Interface())
+		if err != nil {
+			return fail(err)
+		}
+		if result == nil {
+			return []reflect.Value{reflect.Zero(resultType), reflect.Zero(errType)}
+		}
+		value := reflect.ValueOf(result)
+		if !value.Type().AssignableTo(resultType) {
+			return fail(fmt.Errorf("relation loader returned %s, expected %s", value.Type(), resultType))
+		}
+		return []reflect.Value{value, reflect.Zero(errType)}
+	})
+	return fn.Interface()
+}
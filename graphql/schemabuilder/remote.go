@@ -0,0 +1,215 @@
+package schemabuilder
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/samsarahq/thunder/graphql"
+)
+
+// RemoteSelections is the placeholder in a RemoteFieldFunc query template
+// that is replaced by the selection set of the local query.
+const RemoteSelections = "{{selections}}"
+
+// A RemoteClient executes queries against a remote GraphQL service.
+type RemoteClient interface {
+	// Query executes query and returns the data of the response. Errors
+	// reported by the remote service should be returned as an error, along
+	// with the partial data of the response if it has any.
+	Query(ctx context.Context, query string) (json.RawMessage, error)
+}
+
+// RemoteFieldFunc exposes a field whose value is resolved by a remote GraphQL
+// service. The queryTemplate is a query selecting a single field on the
+// remote service, with RemoteSelections in place of its selection set. For
+// example:
+//    query.RemoteFieldFunc("billing", client,
+//       `{ account(id: 4) {{selections}} }`, &Account{})
+//
+// When the field is queried, its selections are forwarded to the remote
+// service and the remote field's value is decoded into a value of the same
+// type as result using encoding/json. The fields of result's type must all
+// exist on the remote type, as they are forwarded without their arguments or
+// aliases. If the remote service reports errors along with partial data, the
+// field's function returns the partial value alongside the errors.
+func (s *Object) RemoteFieldFunc(name string, client RemoteClient, queryTemplate string, result interface{}, options ...FieldFuncOption) {
+	if strings.Count(queryTemplate, RemoteSelections) != 1 {
+		panic("remote query template should contain " + RemoteSelections + " once")
+	}
+
+	resultType := reflect.TypeOf(result)
+	fnType := reflect.FuncOf(
+		[]reflect.Type{contextType, selectionSetType},
+		[]reflect.Type{resultType, errType},
+		false,
+	)
+	fn := reflect.MakeFunc(fnType, func(in []reflect.Value) []reflect.Value {
+		ctx := in[0].Interface().(context.Context)
+		selectionSet := in[1].Interface().(*graphql.SelectionSet)
+
+		result := reflect.New(resultType)
+		decoded, err := queryRemote(ctx, client, queryTemplate, selectionSet, result.Interface())
+		value := result.Elem()
+		if !decoded {
+			value = reflect.Zero(resultType)
+		}
+		if err != nil {
+			return []reflect.Value{value, reflect.ValueOf(&err).Elem()}
+		}
+		return []reflect.Value{value, reflect.Zero(errType)}
+	})
+
+	s.FieldFunc(name, fn.Interface(), options...)
+}
+
+// queryRemote queries the remote field of queryTemplate with selectionSet and
+// decodes its value into dest. decoded is true if dest holds the value, which
+// can be partial if the remote service also reported errors.
+func queryRemote(ctx context.Context, client RemoteClient, queryTemplate string, selectionSet *graphql.SelectionSet, dest interface{}) (decoded bool, err error) {
+	var b bytes.Buffer
+	printRemoteSelectionSet(&b, selectionSet)
+	query := strings.Replace(queryTemplate, RemoteSelections, b.String(), 1)
+
+	data, queryErr := client.Query(ctx, query)
+	if queryErr != nil {
+		queryErr = fmt.Errorf("remote: %s", queryErr)
+		if len(data) == 0 {
+			return false, queryErr
+		}
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return false, fmt.Errorf("remote: %s", err)
+	}
+	if len(fields) != 1 {
+		return false, fmt.Errorf("remote: expected a single field in response, received %d", len(fields))
+	}
+	for _, value := range fields {
+		if err := json.Unmarshal(value, dest); err != nil {
+			return false, fmt.Errorf("remote: %s", err)
+		}
+	}
+	return true, queryErr
+}
+
+// printRemoteSelectionSet writes selectionSet as a GraphQL selection set.
+// Fragments are inlined and selections of the same field are merged.
+func printRemoteSelectionSet(b *bytes.Buffer, selectionSet *graphql.SelectionSet) {
+	grouped := make(map[string][]*graphql.Selection)
+	var visit func(*graphql.SelectionSet)
+	visit = func(selectionSet *graphql.SelectionSet) {
+		for _, selection := range selectionSet.Selections {
+			grouped[selection.Name] = append(grouped[selection.Name], selection)
+		}
+		for _, fragment := range selectionSet.Fragments {
+			visit(fragment.SelectionSet)
+		}
+	}
+	visit(selectionSet)
+
+	names := make([]string, 0, len(grouped))
+	for name := range grouped {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	b.WriteString("{")
+	for _, name := range names {
+		b.WriteString(" ")
+		b.WriteString(name)
+
+		merged := &graphql.SelectionSet{}
+		for _, selection := range grouped[name] {
+			if selection.SelectionSet != nil {
+				merged.Selections = append(merged.Selections, selection.SelectionSet.Selections...)
+				merged.Fragments = append(merged.Fragments, selection.SelectionSet.Fragments...)
+			}
+		}
+		if len(merged.Selections) > 0 || len(merged.Fragments) > 0 {
+			b.WriteString(" ")
+			printRemoteSelectionSet(b, merged)
+		}
+	}
+	b.WriteString(" }")
+}
+
+// HTTPRemoteClient is a RemoteClient that sends queries to a GraphQL HTTP
+// endpoint, such as one served by graphql.HTTPHandler.
+type HTTPRemoteClient struct {
+	URL    string
+	Client *http.Client // Optional, defaults to http.DefaultClient.
+}
+
+type remoteResponse struct {
+	Data   json.RawMessage   `json:"data"`
+	Errors []json.RawMessage `json:"errors"`
+}
+
+func (c *HTTPRemoteClient) Query(ctx context.Context, query string) (json.RawMessage, error) {
+	body, err := json.Marshal(map[string]interface{}{"query": query})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", c.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var response remoteResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("bad response with status %s: %s", resp.Status, err)
+	}
+
+	if len(response.Errors) > 0 {
+		messages := make([]string, 0, len(response.Errors))
+		for _, raw := range response.Errors {
+			messages = append(messages, remoteErrorMessage(raw))
+		}
+		var data json.RawMessage
+		if !bytes.Equal(response.Data, []byte("null")) {
+			data = response.Data
+		}
+		return data, errors.New(strings.Join(messages, "; "))
+	}
+	if response.Data == nil {
+		return nil, fmt.Errorf("response with status %s has no data", resp.Status)
+	}
+	return response.Data, nil
+}
+
+// remoteErrorMessage extracts the message of an error reported by a remote
+// service, which is either a string, as written by graphql.HTTPHandler, or an
+// object with a message, as specified by GraphQL.
+func remoteErrorMessage(raw json.RawMessage) string {
+	var message string
+	if err := json.Unmarshal(raw, &message); err == nil {
+		return message
+	}
+	var object struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(raw, &object); err == nil && object.Message != "" {
+		return object.Message
+	}
+	return string(raw)
+}
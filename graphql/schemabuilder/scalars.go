@@ -0,0 +1,91 @@
+package schemabuilder
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/samsarahq/thunder/graphql"
+)
+
+// A customScalar is a scalar registered with Schema.Scalar.
+type customScalar struct {
+	name      string
+	marshal   func(value interface{}) (interface{}, error)
+	unmarshal func(value interface{}) (interface{}, error)
+}
+
+// Scalar registers a custom scalar name for the type of val, such as a decimal
+// or UUID type, so that fields and arguments of the type, or of pointers to
+// it, use the scalar. The function marshal returns the output representation
+// of a field's value, and unmarshal parses an argument's JSON value, such as a
+// string, into a value of the type:
+//    schema.Scalar("UUID", uuid.UUID{}, func(value interface{}) (interface{}, error) {
+//        return value.(uuid.UUID).String(), nil
+//    }, func(value interface{}) (interface{}, error) {
+//        s, ok := value.(string)
+//        if !ok {
+//            return nil, errors.New("not a string")
+//        }
+//        return uuid.Parse(s)
+//    })
+//
+// Registered types take precedence over the struct or scalar of their kind,
+// so that time.Time can be registered as a DateTime scalar. An error from
+// unmarshal fails the query as an invalid argument.
+func (s *Schema) Scalar(name string, val interface{}, marshal func(value interface{}) (interface{}, error), unmarshal func(value interface{}) (interface{}, error)) {
+	typ := reflect.TypeOf(val)
+	if name == "" || marshal == nil || unmarshal == nil {
+		panic(fmt.Sprintf("scalar %s for %s should have a name, a marshal function, and an unmarshal function", name, typ))
+	}
+	if typ.Kind() == reflect.Ptr {
+		panic(fmt.Sprintf("scalar %s should be registered for %s, not a pointer to it", name, typ.Elem()))
+	}
+	if s.customScalars == nil {
+		s.customScalars = make(map[reflect.Type]customScalar)
+	}
+	s.customScalars[typ] = customScalar{name: name, marshal: marshal, unmarshal: unmarshal}
+}
+
+// getCustomScalarType returns the scalar of t if it was registered with
+// Schema.Scalar.
+func (sb *schemaBuilder) getCustomScalarType(t reflect.Type) (*graphql.Scalar, bool) {
+	custom, ok := sb.customScalars[t]
+	if !ok {
+		return nil, false
+	}
+	return &graphql.Scalar{Type: custom.name, SpecifiedByURL: sb.scalarSpecs[custom.name], Serialize: custom.serialize}, true
+}
+
+// serialize marshals a value of the scalar, or of a pointer to it, which is
+// null if nil.
+func (c customScalar) serialize(value interface{}) (interface{}, error) {
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return nil, nil
+		}
+		value = v.Elem().Interface()
+	}
+	return c.marshal(value)
+}
+
+// customScalarArgParser returns the parser of arguments of the type typ,
+// registered with Schema.Scalar, which parses them with its unmarshal
+// function.
+func (sb *schemaBuilder) customScalarArgParser(typ reflect.Type) *argParser {
+	custom := sb.customScalars[typ]
+	return &argParser{
+		FromJSON: func(value interface{}, dest reflect.Value) error {
+			parsed, err := custom.unmarshal(value)
+			if err != nil {
+				return err
+			}
+			v := reflect.ValueOf(parsed)
+			if !v.IsValid() || !v.Type().AssignableTo(typ) {
+				return fmt.Errorf("%s parsed a %T, not a %s", custom.name, parsed, typ)
+			}
+			dest.Set(v)
+			return nil
+		},
+		Type: typ,
+	}
+}
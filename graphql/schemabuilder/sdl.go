@@ -0,0 +1,232 @@
+package schemabuilder
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/samsarahq/thunder/graphql"
+)
+
+// builtinScalars are the scalars of GraphQL, which SDL does not declare.
+var builtinScalars = map[string]bool{
+	"Boolean": true,
+	"Float":   true,
+	"ID":      true,
+	"Int":     true,
+	"String":  true,
+}
+
+// SDL returns the types reachable from the roots of schema in the GraphQL
+// schema definition language, for schema registries and client code
+// generators. Types are printed sorted by name with their descriptions, and
+// fields in the order introspection lists them, including the connection types
+// of paginated fields. Scalars named after Go types, such as int64, are
+// declared as custom scalars, as introspection names them, with @specifiedBy
+// if their specification is recorded with Schema.SpecifiedBy. Deprecated fields
+// are printed with @deprecated, and the directives applied with Directive on
+// their objects and fields, and with Schema.EnumValueDirective on enum values.
+// Fields restricted to audiences or API versions are included, and
+// introspection's types and fields are not.
+func SDL(schema *graphql.Schema) string {
+	types := schemaTypes(schema)
+	var names []string
+	for name := range types {
+		if !strings.HasPrefix(name, "__") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var definitions []string
+	for _, name := range names {
+		var b bytes.Buffer
+		switch typ := types[name].(type) {
+		case *graphql.Scalar:
+			if builtinScalars[name] {
+				continue
+			}
+			fmt.Fprintf(&b, "scalar %s", name)
+			if typ.SpecifiedByURL != "" {
+				printSDLDirectives(&b, []graphql.Directive{{Name: "specifiedBy", Args: map[string]interface{}{"url": typ.SpecifiedByURL}}})
+			}
+
+		case *graphql.Enum:
+			values := append([]string(nil), typ.Values...)
+			sort.Strings(values)
+			fmt.Fprintf(&b, "enum %s {\n", name)
+			for _, value := range values {
+				fmt.Fprintf(&b, "  %s", value)
+				printSDLDirectives(&b, typ.ValueDirectives[value])
+				b.WriteString("\n")
+			}
+			b.WriteString("}")
+
+		case *graphql.Object:
+			if len(typ.Fields) == 0 {
+				// An empty root, such as a schema's Mutation without fields,
+				// cannot be declared.
+				continue
+			}
+			printSDLDescription(&b, typ.Description)
+			fmt.Fprintf(&b, "type %s", name)
+			for i, iface := range typ.Interfaces {
+				if i == 0 {
+					b.WriteString(" implements ")
+				} else {
+					b.WriteString(" & ")
+				}
+				b.WriteString(iface.Name)
+			}
+			printSDLDirectives(&b, typ.Directives)
+			printSDLFields(&b, typ.Fields, typ.FieldOrder)
+
+		case *graphql.Interface:
+			printSDLDescription(&b, typ.Description)
+			fmt.Fprintf(&b, "interface %s", name)
+			printSDLFields(&b, typ.Fields, nil)
+
+		case *graphql.InputObject:
+			var fieldNames []string
+			for fieldName := range typ.InputFields {
+				fieldNames = append(fieldNames, fieldName)
+			}
+			sort.Strings(fieldNames)
+			fmt.Fprintf(&b, "input %s {\n", name)
+			for _, fieldName := range fieldNames {
+				fmt.Fprintf(&b, "  %s: %s\n", fieldName, typ.InputFields[fieldName])
+			}
+			b.WriteString("}")
+		}
+		definitions = append(definitions, b.String())
+	}
+	return strings.Join(definitions, "\n\n") + "\n"
+}
+
+// printSDLDescription prints description as a block string, if set.
+func printSDLDescription(b *bytes.Buffer, description string) {
+	if description == "" {
+		return
+	}
+	description = strings.Replace(description, `"""`, `\"""`, -1)
+	if strings.Contains(description, "\n") {
+		fmt.Fprintf(b, "\"\"\"\n%s\n\"\"\"\n", description)
+		return
+	}
+	fmt.Fprintf(b, "\"\"\"%s\"\"\"\n", description)
+}
+
+// printSDLFields prints fields in braces, in the order of order followed by
+// the fields missing from it sorted by name, as introspection lists them.
+func printSDLFields(b *bytes.Buffer, fields map[string]*graphql.Field, order []string) {
+	position := make(map[string]int)
+	for i, name := range order {
+		position[name] = i
+	}
+	var names []string
+	for name := range fields {
+		if !strings.HasPrefix(name, "__") {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		pi, iok := position[names[i]]
+		pj, jok := position[names[j]]
+		if iok && jok {
+			return pi < pj
+		}
+		if iok != jok {
+			return iok
+		}
+		return names[i] < names[j]
+	})
+
+	b.WriteString(" {\n")
+	for _, name := range names {
+		field := fields[name]
+		fmt.Fprintf(b, "  %s", name)
+		if len(field.Args) > 0 {
+			var argNames []string
+			for argName := range field.Args {
+				argNames = append(argNames, argName)
+			}
+			sort.Strings(argNames)
+			args := make([]string, len(argNames))
+			for i, argName := range argNames {
+				args[i] = fmt.Sprintf("%s: %s", argName, field.Args[argName])
+			}
+			fmt.Fprintf(b, "(%s)", strings.Join(args, ", "))
+		}
+		fmt.Fprintf(b, ": %s", field.Type)
+		directives := field.Directives
+		if field.DeprecationReason != "" {
+			directives = append([]graphql.Directive{{Name: "deprecated", Args: map[string]interface{}{"reason": field.DeprecationReason}}}, directives...)
+		}
+		printSDLDirectives(b, directives)
+		b.WriteString("\n")
+	}
+	b.WriteString("}")
+}
+
+// printSDLDirectives prints directives, each preceded by a space, with their
+// arguments sorted by name.
+func printSDLDirectives(b *bytes.Buffer, directives []graphql.Directive) {
+	for _, directive := range directives {
+		fmt.Fprintf(b, " @%s", directive.Name)
+		if len(directive.Args) == 0 {
+			continue
+		}
+		var names []string
+		for name := range directive.Args {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		args := make([]string, len(names))
+		for i, name := range names {
+			args[i] = fmt.Sprintf("%s: %s", name, sdlValue(reflect.ValueOf(directive.Args[name])))
+		}
+		fmt.Fprintf(b, "(%s)", strings.Join(args, ", "))
+	}
+}
+
+// sdlValue returns the GraphQL literal of value: a list for slices, an object
+// for maps keyed by strings, and otherwise its JSON encoding, which is a valid
+// GraphQL string, number, boolean, or null.
+func sdlValue(value reflect.Value) string {
+	for value.IsValid() && (value.Kind() == reflect.Interface || value.Kind() == reflect.Ptr) && !value.IsNil() {
+		value = value.Elem()
+	}
+	if !value.IsValid() {
+		return "null"
+	}
+
+	switch value.Kind() {
+	case reflect.Slice, reflect.Array:
+		elems := make([]string, value.Len())
+		for i := range elems {
+			elems[i] = sdlValue(value.Index(i))
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+
+	case reflect.Map:
+		if value.Type().Key().Kind() != reflect.String {
+			break
+		}
+		keys := value.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return keys[i].String() < keys[j].String() })
+		fields := make([]string, len(keys))
+		for i, key := range keys {
+			fields[i] = fmt.Sprintf("%s: %s", key.String(), sdlValue(value.MapIndex(key)))
+		}
+		return "{" + strings.Join(fields, ", ") + "}"
+	}
+
+	encoded, err := json.Marshal(value.Interface())
+	if err != nil {
+		return "null"
+	}
+	return string(encoded)
+}
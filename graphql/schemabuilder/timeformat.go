@@ -0,0 +1,133 @@
+package schemabuilder
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/samsarahq/thunder/graphql"
+	"github.com/samsarahq/thunder/internal"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// TimeFormat sets the layout, as for time.Format, of the Time scalar that
+// time.Time fields and arguments are exposed as. Fields are returned formatted
+// with layout, and arguments must be strings in layout; other strings are
+// rejected. By default, fields are returned in RFC 3339 with fractional
+// seconds, and arguments are parsed as RFC 3339. The layout of a field's
+// result can be overridden with the FieldFunc option TimeFormat.
+func (s *Schema) TimeFormat(layout string) {
+	s.timeFormat = layout
+}
+
+// TimeInUTC makes time.Time fields and arguments be converted to UTC. By
+// default, times keep their location, and are returned with its offset.
+func (s *Schema) TimeInUTC() {
+	s.timeInUTC = true
+}
+
+// TimeFormat returns an option for a FieldFunc that returns times formatted
+// with layout, as for time.Format, instead of the schema's layout. It applies
+// to the times the field returns, including in lists, but not to the fields of
+// returned objects:
+//    event.FieldFunc("day", func(e *Event) time.Time { return e.Start }, schemabuilder.TimeFormat("2006-01-02"))
+func TimeFormat(layout string) FieldFuncOption {
+	return func(m *method) {
+		m.TimeFormat = layout
+	}
+}
+
+// isTimeType returns true if typ is time.Time or a type defined as it.
+func isTimeType(typ reflect.Type) bool {
+	return internal.TypesIdenticalOrScalarAliases(timeType, typ)
+}
+
+// serializeTime returns a Serialize function for the Time scalar that formats
+// times with layout.
+func (sb *schemaBuilder) serializeTime(layout string) func(value interface{}) (interface{}, error) {
+	utc := sb.timeInUTC
+	return func(value interface{}) (interface{}, error) {
+		v := reflect.ValueOf(value)
+		if !v.Type().ConvertibleTo(timeType) {
+			return nil, fmt.Errorf("bad time %v", value)
+		}
+		t := v.Convert(timeType).Interface().(time.Time)
+		if utc {
+			t = t.UTC()
+		}
+		return t.Format(layout), nil
+	}
+}
+
+// timeSerializer returns the Serialize function of the schema's Time scalar,
+// or nil if times are returned as encoding/json formats them.
+func (sb *schemaBuilder) timeSerializer() func(value interface{}) (interface{}, error) {
+	switch {
+	case sb.timeFormat != "":
+		return sb.serializeTime(sb.timeFormat)
+	case sb.timeInUTC:
+		return sb.serializeTime(time.RFC3339Nano)
+	default:
+		return nil
+	}
+}
+
+// timeArgParser returns the parser of time arguments of type typ, if the
+// schema configures how times are parsed.
+func (sb *schemaBuilder) timeArgParser(typ reflect.Type) (*argParser, bool) {
+	if sb.timeFormat == "" && !sb.timeInUTC {
+		return nil, false
+	}
+	layout := sb.timeFormat
+	if layout == "" {
+		layout = time.RFC3339
+	}
+	utc := sb.timeInUTC
+
+	return &argParser{
+		FromJSON: func(value interface{}, dest reflect.Value) error {
+			asString, ok := value.(string)
+			if !ok {
+				return errors.New("not a string")
+			}
+			asTime, err := time.Parse(layout, asString)
+			if err != nil {
+				return fmt.Errorf("not a time in the format %q", layout)
+			}
+			if utc {
+				asTime = asTime.UTC()
+			}
+			dest.Set(reflect.ValueOf(asTime).Convert(dest.Type()))
+			return nil
+		},
+		Type: typ,
+	}, true
+}
+
+// withTimeFormat returns typ with its Time scalar replaced by one that formats
+// times with layout, for the TimeFormat option.
+func (sb *schemaBuilder) withTimeFormat(typ graphql.Type, layout string) (graphql.Type, error) {
+	switch typ := typ.(type) {
+	case *graphql.NonNull:
+		inner, err := sb.withTimeFormat(typ.Type, layout)
+		if err != nil {
+			return nil, err
+		}
+		return &graphql.NonNull{Type: inner}, nil
+	case *graphql.List:
+		inner, err := sb.withTimeFormat(typ.Type, layout)
+		if err != nil {
+			return nil, err
+		}
+		return &graphql.List{Type: inner}, nil
+	case *graphql.Scalar:
+		if typ.Type == "Time" {
+			formatted := *typ
+			formatted.Serialize = sb.serializeTime(layout)
+			return &formatted, nil
+		}
+	}
+	return nil, fmt.Errorf("time format requires a time result, not %s", typ)
+}
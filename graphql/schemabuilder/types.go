@@ -1,5 +1,7 @@
 package schemabuilder
 
+import "github.com/samsarahq/thunder/graphql"
+
 // A Object represents a Go type and set of methods to be converted into an
 // Object in a GraphQL schema.
 type Object struct {
@@ -8,13 +10,44 @@ type Object struct {
 	Type            interface{}
 	Methods         Methods // Deprecated, use FieldFunc instead.
 	paginatedFields []paginationObject
+	fieldOrder      []string
+
+	key               string
+	deprecationReason string
+	directives        []graphql.Directive
+	defaultField      graphql.DefaultResolver
+	onResolveStart    graphql.ResolveStartHook
+	onResolveEnd      graphql.ResolveEndHook
 
-	key string
+	proto         bool
+	oneofWrappers []interface{}
 }
 
 type paginationObject struct {
-	Name string
-	Fn   interface{}
+	Name    string
+	Fn      interface{}
+	CountFn interface{}
+}
+
+// PaginationOption is an interface for the variadic options that can be
+// passed to a PaginateFieldFunc.
+type PaginationOption func(*paginationObject)
+
+// CountFunc is an option for a PaginateFieldFunc that computes the
+// connection's totalCount with f instead of counting the nodes returned by
+// the field's function, for connections whose total is expensive to load. The
+// function f is called only when totalCount is selected. It takes the same
+// optional context, object, and arguments as the paginated function, and
+// returns the count and an optional error:
+//    user.PaginateFieldFunc("posts", func(ctx context.Context, u *User, args PostArgs) ([]*Post, error) {
+//        ...
+//    }, schemabuilder.CountFunc(func(ctx context.Context, u *User, args PostArgs) (int64, error) {
+//        return db.CountPosts(ctx, u.Id, args.Filter)
+//    }))
+func CountFunc(f interface{}) PaginationOption {
+	return func(p *paginationObject) {
+		p.CountFn = f
+	}
 }
 
 // FieldFuncOption is an interface for the variadic options that can be passed
@@ -27,6 +60,105 @@ func NonNullable(m *method) {
 	m.MarkedNonNullable = true
 }
 
+// Pure is an option that can be passed to a FieldFunc to indicate that its
+// function has no side effects, and may be run again or speculatively. It is
+// recorded as graphql.Field.Pure, whose values the executor caches across the
+// reruns of a live query; fields without it are assumed to have side effects.
+func Pure(m *method) {
+	m.Pure = true
+}
+
+// Flatten is an option that can be passed to a FieldFunc returning an object
+// to merge the object's fields into the parent object, instead of exposing
+// them under a field of their own. It is useful for assembling one object from
+// several Go structs:
+//    user.FieldFunc("profile", func(u *User) *Profile { ... }, schemabuilder.Flatten)
+//
+// The function is called once for each value of the parent object, however
+// many of its fields are selected, and should not take arguments. Fields that
+// collide with the parent's fields are an error.
+func Flatten(m *method) {
+	m.Flatten = true
+}
+
+// ListConcurrency returns an option for a FieldFunc returning a list that
+// bounds how many expensive fields of the list's elements resolve at a time to
+// n, to avoid bursting a downstream service when a list fans out. It applies
+// in addition to any request-wide concurrency limit, and does not change the
+// order of the list.
+func ListConcurrency(n int) FieldFuncOption {
+	return func(m *method) {
+		m.ListConcurrency = n
+	}
+}
+
+// RequireFeature returns an option for a FieldFunc that only resolves the field
+// for callers with feature enabled, as checked by the executor's
+// graphql.WithFeatureChecker, for gradual rollouts. Unlike Audience, the field
+// exists for every caller and introspection shows it; for other callers, it is
+// null, or fails if it is non-null:
+//    query.FieldFunc("reports", func() []*Report { ... }, schemabuilder.RequireFeature("beta-reports"))
+func RequireFeature(feature string) FieldFuncOption {
+	return func(m *method) {
+		m.Feature = feature
+	}
+}
+
+// Deprecated returns an option for a FieldFunc that marks the field as
+// deprecated, with a reason that should point to its replacement, as
+// reported by introspection's isDeprecated and deprecationReason and by SDL's
+// @deprecated directive. Deprecated fields keep resolving as before:
+//    user.FieldFunc("fullName", func(u *User) string { ... }, schemabuilder.Deprecated("use name instead"))
+func Deprecated(reason string) FieldFuncOption {
+	return func(m *method) {
+		m.DeprecationReason = reason
+	}
+}
+
+// Directive returns an option for a FieldFunc that applies the directive name
+// with args to the field, as metadata printed by SDL:
+//    user.FieldFunc("email", func(u *User) string { ... }, schemabuilder.Directive("sensitive", nil))
+func Directive(name string, args map[string]interface{}) FieldFuncOption {
+	return func(m *method) {
+		m.Directives = append(m.Directives, graphql.Directive{Name: name, Args: args})
+	}
+}
+
+// Audience returns an option for a FieldFunc that restricts the field to
+// callers in one of audiences, such as "internal", for serving several
+// audiences from one schema. Other callers cannot select the field, and do not
+// see it when introspecting the schema. Callers are placed in audiences with
+// graphql.WithAudiences:
+//    user.FieldFunc("email", func(u *User) string { ... }, schemabuilder.Audience("internal"))
+func Audience(audiences ...string) FieldFuncOption {
+	return func(m *method) {
+		m.Audiences = append(m.Audiences, audiences...)
+	}
+}
+
+// OptionalBackend is an option that can be passed to a FieldFunc backed by a
+// non-critical service. When the function, or the func it returns for a lazy
+// field, returns an error, the field resolves to null and the error is added
+// as a warning with graphql.AddWarning, keeping the rest of the response
+// intact; graphql.HTTPHandler reports warnings in "extensions.warnings". The
+// field's type must be nullable:
+//    user.FieldFunc("recommendations", fetchRecommendations, schemabuilder.OptionalBackend)
+func OptionalBackend(m *method) {
+	m.OptionalBackend = true
+}
+
+// Options combines several FieldFuncOptions into one, applying them in order.
+// It is useful for defining a policy once and reusing it across fields:
+//    var required = schemabuilder.Options(schemabuilder.NonNullable)
+//    user.FieldFunc("email", func(u *User) *string { ... }, required)
+func Options(options ...FieldFuncOption) FieldFuncOption {
+	return func(m *method) {
+		for _, option := range options {
+			option(m)
+		}
+	}
+}
+
 // FieldFunc exposes a field on an object. The function f can take a number of
 // optional arguments:
 // func([ctx context.Context], [o *Type], [args struct {}]) ([Result], [error])
@@ -45,12 +177,35 @@ func NonNullable(m *method) {
 //        userID, err := db.AddUser(ctx, args.FirstName, args.LastName)
 //        return userID, err
 //    })
+//
+// The object may also be taken as an interface that Type or *Type implements,
+// so that one function can be shared by several objects:
+//    named := func(n Named) string { return n.DisplayName() }
+//    user.FieldFunc("displayName", named)
+//    team.FieldFunc("displayName", named)
+//
+// A bool returned after the result reports whether the result is present, as
+// in func(...) (Result, bool, error). The field is then nullable, and
+// returning false makes it null even if Result is not a pointer.
+//
+// Results and arguments of type json.RawMessage, map[string]interface{}, or
+// interface{} are exposed as the nullable JSON scalar, for arbitrary JSON
+// values that are returned and accepted as is. Results and arguments of type
+// []byte are exposed as the bytes scalar, a base64 string.
+//
+// The result may also be returned as a func() (Result, error), which is called
+// only after the rest of the query has been resolved. This lets resolvers
+// register work with a batch loader and load it all at once.
 func (s *Object) FieldFunc(name string, f interface{}, options ...FieldFuncOption) {
+	s.addMethod(name, &method{Fn: f}, options)
+}
+
+// addMethod registers the field name resolved by m, configured with options.
+func (s *Object) addMethod(name string, m *method, options []FieldFuncOption) {
 	if s.Methods == nil {
 		s.Methods = make(Methods)
 	}
 
-	m := &method{Fn: f}
 	for _, option := range options {
 		option(m)
 	}
@@ -59,6 +214,19 @@ func (s *Object) FieldFunc(name string, f interface{}, options ...FieldFuncOptio
 		panic("duplicate method")
 	}
 	s.Methods[name] = m
+	s.fieldOrder = append(s.fieldOrder, name)
+}
+
+// FieldFuncIf registers a field with FieldFunc only if cond is true, for
+// fields gated by a feature flag at schema build time:
+//    user.FieldFuncIf(flags.Billing, "invoices", func(u *User) []*Invoice { ... })
+//
+// When cond is false nothing is registered, so a field gated by a different
+// condition may use the same name.
+func (s *Object) FieldFuncIf(cond bool, name string, f interface{}, options ...FieldFuncOption) {
+	if cond {
+		s.FieldFunc(name, f, options...)
+	}
 }
 
 // Key registers the key field on an object. The field should be specified by the name of the
@@ -73,9 +241,70 @@ func (s *Object) Key(f string) {
 	s.key = f
 }
 
+// Deprecate marks the object type as deprecated, with a reason that should
+// point to its replacement. GraphQL has no deprecation for types, so the
+// reason is prefixed to the type's description, and executors configured
+// with graphql.WithDeprecationLogger report queries that select its fields.
+func (s *Object) Deprecate(reason string) {
+	s.deprecationReason = reason
+}
+
+// Directive applies the directive name with args to the object type, as
+// metadata printed by SDL, such as for schema federation:
+//    user.Directive("key", map[string]interface{}{"fields": "id"})
+func (s *Object) Directive(name string, args map[string]interface{}) {
+	s.directives = append(s.directives, graphql.Directive{Name: name, Args: args})
+}
+
+// DefaultFieldFunc registers a fallback resolver for fields that are not
+// registered on the object, for objects fronting a schemaless backend. The
+// resolver receives the object, the name of the requested field and its
+// arguments, and its result is returned as a scalar. Selections on such
+// fields are rejected, as are fields that the object does not register when
+// no DefaultFieldFunc is set. Registered fields always take precedence.
+func (s *Object) DefaultFieldFunc(f graphql.DefaultResolver) {
+	s.defaultField = f
+}
+
+// OnResolveStart registers a hook called before the fields selected on each
+// value of the object are resolved, such as to open a tracing span or set up
+// object-scoped loaders. The context it returns is passed to the fields'
+// resolvers, and an error fails the object's resolution:
+//    user.OnResolveStart(func(ctx context.Context, parent interface{}) (context.Context, error) {
+//        return withUserLoaders(ctx, parent.(*User)), nil
+//    })
+func (s *Object) OnResolveStart(f graphql.ResolveStartHook) {
+	s.onResolveStart = f
+}
+
+// OnResolveEnd registers a hook called after the fields selected on each
+// value of the object are resolved, with their result and error. Fields whose
+// function takes a context are resolved in the background, and the hook is
+// called once they complete.
+func (s *Object) OnResolveEnd(f graphql.ResolveEndHook) {
+	s.onResolveEnd = f
+}
+
 type method struct {
 	MarkedNonNullable bool
+	Pure              bool
+	Flatten           bool
+	ListConcurrency   int
+	Audiences         []string
+	OptionalBackend   bool
+	TimeFormat        string
+	Example           interface{}
+	ArgExamples       map[string]interface{}
 	Fn                interface{}
+	// Versions holds the implementations of a field registered with
+	// VersionedFieldFunc, by version, instead of Fn.
+	Versions map[string]interface{}
+	Feature  string
+	Cost     *int
+	CostFn   interface{}
+
+	DeprecationReason string
+	Directives        []graphql.Directive
 }
 
 // A Methods map represents the set of methods exposed on a Object.
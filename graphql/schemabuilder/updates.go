@@ -0,0 +1,291 @@
+package schemabuilder
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/samsarahq/thunder/reactive"
+)
+
+// FieldFuncWithUpdates registers a field name resolved with f, like FieldFunc,
+// for live views that start from a snapshot. The function f returns the
+// field's initial value along with a channel of its later values, and an
+// optional error:
+//
+//	query.FieldFuncWithUpdates("price", func(ctx context.Context, args struct{ Symbol string }) (float64, <-chan float64, error) {
+//	    return prices.Subscribe(ctx, args.Symbol)
+//	})
+//
+// In a subscription, the initial value is sent first. Each value then received
+// from the channel replaces it and reruns the subscription, as if a dependency
+// of the field had changed. The function f is called once per subscription,
+// object, and arguments, and its context is canceled once the subscription
+// stops using the field, after which f should stop sending. Once the channel
+// is closed, the field keeps its last value. Outside of subscriptions, only
+// the initial value is returned and the context is canceled right away.
+//
+// The object and arguments must be comparable, to tell which values of the
+// field are updated.
+func (s *Object) FieldFuncWithUpdates(name string, f interface{}, options ...FieldFuncOption) {
+	s.fieldFuncWithUpdates("FieldFuncWithUpdates", name, f, nil, options)
+}
+
+// FieldFuncWithSharedUpdates registers a field name resolved with f, like
+// FieldFuncWithUpdates, whose updates are shared by all subscriptions, for
+// sources with many subscribers such as a ticker. The function f is called
+// once for all the subscriptions selecting the field with the same object and
+// arguments, and the values it sends are fanned out to each of them, which
+// resolve the rest of their selections from it. The subscriptions are
+// reference-counted: f's context is canceled once the last of them stops using
+// the field.
+//
+// Since the call is shared, f's context does not carry the values of any
+// subscription's context, and f must not depend on the caller.
+func (s *Object) FieldFuncWithSharedUpdates(name string, f interface{}, options ...FieldFuncOption) {
+	s.fieldFuncWithUpdates("FieldFuncWithSharedUpdates", name, f, &sharedUpdates{}, options)
+}
+
+// fieldFuncWithUpdates registers a FieldFuncWithUpdates field, whose updates
+// are shared through shared if it is not nil.
+func (s *Object) fieldFuncWithUpdates(kind, name string, f interface{}, shared *sharedUpdates, options []FieldFuncOption) {
+	fn := reflect.ValueOf(f)
+	if fn.Kind() != reflect.Func {
+		panic(fmt.Sprintf("bad %s: f should be a function", kind))
+	}
+	fnType := fn.Type()
+	resultType, returnsErr, err := updatesResultType(fnType)
+	if err != nil {
+		panic(fmt.Sprintf("bad %s %s: %s", kind, name, err))
+	}
+
+	// The field is resolved from a wrapper of f that takes a context, to
+	// share the updated value through reactive.Cache.
+	hasContext := fnType.NumIn() > 0 && fnType.In(0) == contextType
+	in := []reflect.Type{contextType}
+	for i := 0; i < fnType.NumIn(); i++ {
+		if i == 0 && hasContext {
+			continue
+		}
+		if fnType.In(i) == selectionSetType {
+			panic(fmt.Sprintf("bad %s %s: f cannot take a selection set", kind, name))
+		}
+		if !fnType.In(i).Comparable() {
+			panic(fmt.Sprintf("bad %s %s: %s is not comparable", kind, name, fnType.In(i)))
+		}
+		in = append(in, fnType.In(i))
+	}
+	if len(in) > len(updatesKey{}.args)+1 {
+		panic(fmt.Sprintf("bad %s %s: f takes too many arguments", kind, name))
+	}
+
+	field := new(byte)
+	wrapper := reflect.MakeFunc(reflect.FuncOf(in, []reflect.Type{resultType, errType}, false), func(args []reflect.Value) []reflect.Value {
+		ctx := args[0].Interface().(context.Context)
+		key := updatesKey{field: field}
+		for i, arg := range args[1:] {
+			key.args[i] = arg.Interface()
+		}
+
+		value, err := reactive.Cache(ctx, key, func(ctx context.Context) (interface{}, error) {
+			if shared != nil {
+				return shared.subscribe(ctx, key, fn, args, hasContext, returnsErr)
+			}
+			return subscribeUpdates(ctx, fn, args, hasContext, returnsErr)
+		})
+		if err != nil {
+			return []reflect.Value{reflect.Zero(resultType), reflect.ValueOf(&err).Elem()}
+		}
+
+		updated := value.(*updatedValue)
+		// Depend on updates before reading the value, so that none is missed.
+		reactive.AddDependency(ctx, updated.resource)
+		return []reflect.Value{updated.get(), reflect.Zero(errType)}
+	})
+
+	s.FieldFunc(name, wrapper.Interface(), options...)
+}
+
+// updatesResultType returns the type of the values returned by a
+// FieldFuncWithUpdates function of type fnType, and whether the function also
+// returns an error.
+func updatesResultType(fnType reflect.Type) (reflect.Type, bool, error) {
+	switch {
+	case fnType.NumOut() == 2:
+	case fnType.NumOut() == 3 && fnType.Out(2) == errType:
+	default:
+		return nil, false, fmt.Errorf("f should return a value, a channel of values, and an optional error")
+	}
+	resultType, chanType := fnType.Out(0), fnType.Out(1)
+	if chanType.Kind() != reflect.Chan || chanType.ChanDir()&reflect.RecvDir == 0 || chanType.Elem() != resultType {
+		return nil, false, fmt.Errorf("f should return a channel of %s, not %s", resultType, chanType)
+	}
+	return resultType, fnType.NumOut() == 3, nil
+}
+
+// updatesKey is the reactive.Cache key for the value of a
+// FieldFuncWithUpdates field for an object and arguments.
+type updatesKey struct {
+	field *byte
+	args  [2]interface{}
+}
+
+// updatedValue is the latest value of a FieldFuncWithUpdates field.
+type updatedValue struct {
+	mu    sync.Mutex
+	value reflect.Value
+	// resource is strobed whenever value is replaced.
+	resource *reactive.Resource
+}
+
+func (u *updatedValue) get() reflect.Value {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.value
+}
+
+func (u *updatedValue) set(value reflect.Value) {
+	u.mu.Lock()
+	u.value = value
+	u.mu.Unlock()
+	u.resource.Strobe()
+}
+
+// subscribeUpdates calls the FieldFuncWithUpdates function fn with args, and
+// returns its initial value, kept updated with the values received from its
+// channel until ctx's computation is released.
+func subscribeUpdates(ctx context.Context, fn reflect.Value, args []reflect.Value, hasContext, returnsErr bool) (*updatedValue, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	if !reactive.HasRerunner(ctx) {
+		defer cancel()
+		updated, _, err := callUpdates(ctx, fn, args, hasContext, returnsErr)
+		return updated, err
+	}
+
+	updated, updates, err := callUpdates(ctx, fn, args, hasContext, returnsErr)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	releaseWith(ctx, cancel)
+	go relayUpdates(ctx, updated, updates)
+	return updated, nil
+}
+
+// callUpdates calls the FieldFuncWithUpdates function fn with ctx and args,
+// and returns its initial value and its channel of updates.
+func callUpdates(ctx context.Context, fn reflect.Value, args []reflect.Value, hasContext, returnsErr bool) (*updatedValue, reflect.Value, error) {
+	call := args[1:]
+	if hasContext {
+		call = append([]reflect.Value{reflect.ValueOf(ctx)}, call...)
+	}
+	out := fn.Call(call)
+	if returnsErr && !out[2].IsNil() {
+		return nil, reflect.Value{}, out[2].Interface().(error)
+	}
+	return &updatedValue{value: out[0], resource: reactive.NewResource()}, out[1], nil
+}
+
+// relayUpdates sets updated to each value received from updates, until ctx is
+// canceled or updates is closed.
+func relayUpdates(ctx context.Context, updated *updatedValue, updates reflect.Value) {
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+		{Dir: reflect.SelectRecv, Chan: updates},
+	}
+	for {
+		chosen, value, ok := reflect.Select(cases)
+		if chosen == 0 || !ok {
+			return
+		}
+		updated.set(value)
+	}
+}
+
+// releaseWith calls release once ctx's cached computation is released, when
+// no subscription uses the field anymore.
+func releaseWith(ctx context.Context, release func()) {
+	// done is never invalidated, and is released along with the cached
+	// computation.
+	done := reactive.NewResource()
+	reactive.AddDependency(ctx, done)
+	done.Cleanup(release)
+}
+
+// sharedUpdates are the values of a FieldFuncWithSharedUpdates field, shared
+// by all subscriptions.
+type sharedUpdates struct {
+	mu      sync.Mutex
+	entries map[updatesKey]*sharedUpdate
+}
+
+// sharedUpdate is the value of a FieldFuncWithSharedUpdates field for an
+// object and arguments, and the number of subscriptions using it.
+type sharedUpdate struct {
+	// ready is closed once updated or err is set.
+	ready   chan struct{}
+	updated *updatedValue
+	err     error
+
+	refs   int
+	cancel context.CancelFunc
+}
+
+// subscribe returns the shared value of the field for key, calling fn with
+// args if no subscription uses it yet, and keeps it until ctx's computation is
+// released.
+func (s *sharedUpdates) subscribe(ctx context.Context, key updatesKey, fn reflect.Value, args []reflect.Value, hasContext, returnsErr bool) (*updatedValue, error) {
+	s.mu.Lock()
+	if s.entries == nil {
+		s.entries = make(map[updatesKey]*sharedUpdate)
+	}
+	entry, ok := s.entries[key]
+	if !ok {
+		entry = &sharedUpdate{ready: make(chan struct{})}
+		s.entries[key] = entry
+	}
+	entry.refs++
+	s.mu.Unlock()
+
+	if !ok {
+		upstream, cancel := context.WithCancel(context.Background())
+		entry.cancel = cancel
+		var updates reflect.Value
+		entry.updated, updates, entry.err = callUpdates(upstream, fn, args, hasContext, returnsErr)
+		if entry.err == nil {
+			go relayUpdates(upstream, entry.updated, updates)
+		} else {
+			// Let later subscriptions call fn again.
+			s.mu.Lock()
+			delete(s.entries, key)
+			s.mu.Unlock()
+		}
+		close(entry.ready)
+	}
+	<-entry.ready
+
+	if entry.err != nil || !reactive.HasRerunner(ctx) {
+		s.release(key, entry)
+		return entry.updated, entry.err
+	}
+	releaseWith(ctx, func() {
+		s.release(key, entry)
+	})
+	return entry.updated, nil
+}
+
+// release drops a subscription to entry, and stops its updates once no
+// subscription uses it.
+func (s *sharedUpdates) release(key updatesKey, entry *sharedUpdate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry.refs--
+	if entry.refs > 0 {
+		return
+	}
+	entry.cancel()
+	if s.entries[key] == entry {
+		delete(s.entries, key)
+	}
+}
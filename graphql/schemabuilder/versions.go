@@ -0,0 +1,153 @@
+package schemabuilder
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/samsarahq/thunder/graphql"
+)
+
+// VersionFunc registers f to extract the caller's API version from the
+// context, for the fields registered with VersionedFieldFunc. It is typically
+// set by middleware from a request header.
+func (s *Schema) VersionFunc(f func(ctx context.Context) string) {
+	s.versionFunc = f
+}
+
+// VersionedFieldFunc registers a field with an implementation per API version,
+// for APIs that serve several versions at once. Each implementation is a
+// function as for FieldFunc, and the one of the caller's version, as returned
+// by the schema's VersionFunc, resolves the field:
+//    user.VersionedFieldFunc("name", map[string]interface{}{
+//        "v1": func(u *User) string { return u.FirstName + " " + u.LastName },
+//        "v2": func(u *User) string { return u.DisplayName },
+//    })
+//
+// The implementations must have the same result and argument types in the
+// schema. To callers of other versions the field does not exist, as for fields
+// restricted with Audience, so a field can be added in a newer version. Cost
+// options apply to every version, and a query's cost counts the most
+// expensive version, since it is checked before the caller's version is
+// known.
+func (s *Object) VersionedFieldFunc(name string, implementations map[string]interface{}, options ...FieldFuncOption) {
+	if len(implementations) == 0 {
+		panic(fmt.Sprintf("bad VersionedFieldFunc %s: no versions", name))
+	}
+	s.addMethod(name, &method{Versions: implementations}, options)
+}
+
+// versionedArgs are the arguments of a versioned field, as parsed by each
+// version's implementation.
+type versionedArgs map[string]interface{}
+
+// buildVersionedFunction builds the field of a method registered with
+// VersionedFieldFunc, which dispatches to its version's implementation.
+func (sb *schemaBuilder) buildVersionedFunction(typ reflect.Type, m *method) (*graphql.Field, error) {
+	if sb.versionFunc == nil {
+		return nil, errors.New("versioned field requires a version function, set with Schema.VersionFunc")
+	}
+
+	var versions []string
+	for version := range m.Versions {
+		versions = append(versions, version)
+	}
+	sort.Strings(versions)
+
+	implementations := make(map[string]*graphql.Field, len(versions))
+	var field graphql.Field
+	for i, version := range versions {
+		versionMethod := *m
+		versionMethod.Fn = m.Versions[version]
+		versionMethod.Versions = nil
+		built, err := sb.buildFunction(typ, &versionMethod)
+		if err != nil {
+			return nil, fmt.Errorf("version %s: %s", version, err)
+		}
+
+		if i == 0 {
+			field = *built
+		} else {
+			if err := sameFieldTypes(&field, built); err != nil {
+				return nil, fmt.Errorf("version %s: %s", version, err)
+			}
+			field.Expensive = field.Expensive || built.Expensive
+			field.Pure = field.Pure && built.Pure
+		}
+		implementations[version] = built
+	}
+
+	versionFunc := sb.versionFunc
+	field.Resolve = func(ctx context.Context, source, args interface{}, selectionSet *graphql.SelectionSet) (interface{}, error) {
+		version := versionFunc(ctx)
+		implementation, ok := implementations[version]
+		if !ok {
+			return nil, fmt.Errorf("not available in version %s", version)
+		}
+		return implementation.Resolve(ctx, source, args.(versionedArgs)[version], selectionSet)
+	}
+	field.ParseArguments = func(args interface{}) (interface{}, error) {
+		parsed := make(versionedArgs, len(implementations))
+		for _, version := range versions {
+			value, err := implementations[version].ParseArguments(args)
+			if err != nil {
+				return nil, err
+			}
+			parsed[version] = value
+		}
+		return parsed, nil
+	}
+	field.Cost = versionedCost(implementations, versions, func(f *graphql.Field) func(args interface{}) int { return f.Cost })
+	field.CostMultiplier = versionedCost(implementations, versions, func(f *graphql.Field) func(args interface{}) int { return f.CostMultiplier })
+	field.Versions = versions
+	field.Version = versionFunc
+	return &field, nil
+}
+
+// versionedCost returns a cost function of a versioned field that calls the
+// cost function of each version, returned by costOf, with the version's
+// arguments and returns the highest, since a query's cost is checked before
+// its version is known. Versions without a cost function count 1. It is nil if
+// no version has a cost function.
+func versionedCost(implementations map[string]*graphql.Field, versions []string, costOf func(*graphql.Field) func(args interface{}) int) func(args interface{}) int {
+	hasCost := false
+	for _, version := range versions {
+		hasCost = hasCost || costOf(implementations[version]) != nil
+	}
+	if !hasCost {
+		return nil
+	}
+	return func(args interface{}) int {
+		parsed, _ := args.(versionedArgs)
+		max := 0
+		for i, version := range versions {
+			cost := 1
+			if f := costOf(implementations[version]); f != nil {
+				cost = f(parsed[version])
+			}
+			if i == 0 || cost > max {
+				max = cost
+			}
+		}
+		return max
+	}
+}
+
+// sameFieldTypes returns an error unless the implementations a and b of a
+// versioned field have the same result and argument types.
+func sameFieldTypes(a, b *graphql.Field) error {
+	if a.Type.String() != b.Type.String() {
+		return fmt.Errorf("result %s differs from %s", b.Type, a.Type)
+	}
+	if len(a.Args) != len(b.Args) {
+		return errors.New("arguments differ")
+	}
+	for name, arg := range a.Args {
+		if other, ok := b.Args[name]; !ok || other.String() != arg.String() {
+			return fmt.Errorf("argument %s differs", name)
+		}
+	}
+	return nil
+}
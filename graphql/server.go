@@ -55,6 +55,7 @@ type conn struct {
 	ctx            context.Context
 	makeCtx        MakeCtxFunc
 	middlewares    []MiddlewareFunc
+	executorOpts   []ExecutorOption
 
 	logger             GraphqlLogger
 	subscriptionLogger SubscriptionLogger
@@ -68,6 +69,9 @@ type conn struct {
 
 	minRerunInterval time.Duration
 	maxSubscriptions int
+	sizeLimits       querySizeLimits
+	maxInputDepth    int
+	queryCache       *QueryCache
 }
 
 type inEnvelope struct {
@@ -181,7 +185,12 @@ func (c *conn) handleSubscribe(in *inEnvelope) error {
 
 	tags := map[string]string{"url": c.url, "query": subscribe.Query, "queryVariables": mustMarshalJson(subscribe.Variables), "id": id}
 
-	query, err := Parse(subscribe.Query, subscribe.Variables)
+	if err := c.sizeLimits.check(subscribe.Query); err != nil {
+		c.logger.Error(c.ctx, err, tags)
+		return err
+	}
+
+	query, err := parseAndPrepare(c.queryCache, c.schema.Query, subscribe.Query, subscribe.Variables, c.maxInputDepth)
 	if query != nil {
 		tags["queryType"] = query.Kind
 		tags["queryName"] = query.Name
@@ -190,14 +199,10 @@ func (c *conn) handleSubscribe(in *inEnvelope) error {
 		c.logger.Error(c.ctx, err, tags)
 		return err
 	}
-	if err := PrepareQuery(c.schema.Query, query.SelectionSet); err != nil {
-		c.logger.Error(c.ctx, err, tags)
-		return err
-	}
 
 	var previous interface{}
 
-	e := Executor{}
+	e := NewExecutor(c.executorOpts...)
 
 	initial := true
 	c.subscriptionLogger.Subscribe(c.ctx, id, tags)
@@ -298,7 +303,12 @@ func (c *conn) handleMutate(in *inEnvelope) error {
 
 	tags := map[string]string{"url": c.url, "query": mutate.Query, "queryVariables": mustMarshalJson(mutate.Variables), "id": id}
 
-	query, err := Parse(mutate.Query, mutate.Variables)
+	if err := c.sizeLimits.check(mutate.Query); err != nil {
+		c.logger.Error(c.ctx, err, tags)
+		return err
+	}
+
+	query, err := parseAndPrepare(c.queryCache, c.mutationSchema.Mutation, mutate.Query, mutate.Variables, c.maxInputDepth)
 	if query != nil {
 		tags["queryType"] = query.Kind
 		tags["queryName"] = query.Name
@@ -307,12 +317,8 @@ func (c *conn) handleMutate(in *inEnvelope) error {
 		c.logger.Error(c.ctx, err, tags)
 		return err
 	}
-	if err := PrepareQuery(c.mutationSchema.Mutation, query.SelectionSet); err != nil {
-		c.logger.Error(c.ctx, err, tags)
-		return err
-	}
 
-	e := Executor{}
+	e := NewExecutor(c.executorOpts...)
 	c.subscriptions[id] = reactive.NewRerunner(c.ctx, func(ctx context.Context) (interface{}, error) {
 		// Serialize all mutates for a given connection.
 		c.mutateMu.Lock()
@@ -533,6 +539,7 @@ func CreateConnection(ctx context.Context, socket JSONSocket, schema *Schema, op
 	for _, opt := range opts {
 		opt(c)
 	}
+	c.maxInputDepth = NewExecutor(c.executorOpts...).inputDepth()
 
 	return c
 }
@@ -555,6 +562,29 @@ func WithMaxSubscriptions(max int) ConnectionOption {
 	}
 }
 
+// WithMaxQuerySize makes the connection reject query documents longer than
+// bytes before parsing them.
+func WithMaxQuerySize(bytes int) ConnectionOption {
+	return func(c *conn) {
+		c.sizeLimits.maxBytes = bytes
+	}
+}
+
+// WithMaxTokens makes the connection reject query documents of more than n
+// lexical tokens before parsing them.
+func WithMaxTokens(n int) ConnectionOption {
+	return func(c *conn) {
+		c.sizeLimits.maxTokens = n
+	}
+}
+
+// WithQueryCache makes the connection parse and prepare queries with cache.
+func WithQueryCache(cache *QueryCache) ConnectionOption {
+	return func(c *conn) {
+		c.queryCache = cache
+	}
+}
+
 func WithMutationSchema(schema *Schema) ConnectionOption {
 	return func(c *conn) {
 		c.mutationSchema = schema
@@ -567,6 +597,15 @@ func WithMakeCtx(makeCtx MakeCtxFunc) ConnectionOption {
 	}
 }
 
+// WithExecutorOptions configures the executor used to run the connection's
+// subscriptions and mutations. With WithMaxInputDepth, it also limits the
+// nesting of the arguments of the queries the connection parses.
+func WithExecutorOptions(opts ...ExecutorOption) ConnectionOption {
+	return func(c *conn) {
+		c.executorOpts = append(c.executorOpts, opts...)
+	}
+}
+
 func WithSubscriptionLogger(logger SubscriptionLogger) ConnectionOption {
 	return func(c *conn) {
 		c.subscriptionLogger = logger
@@ -0,0 +1,269 @@
+package graphql
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+)
+
+// This file contains the serializer used by WithStreamingWriter. It writes a
+// result tree produced by the executor to an io.Writer, resolving the fields
+// of objects and awaiting concurrently computed values only once it reaches
+// them.
+
+// fieldError is left in the result tree in place of a value that failed to
+// resolve while streaming, so that the error can be reported with its path.
+type fieldError struct {
+	err error
+}
+
+// A streamedObject is left in the result tree in place of an object value
+// executed with a streaming writer. Its fields are resolved by the writer as it
+// reaches them, in the order they were selected, so that each field is written
+// as soon as it resolves.
+type streamedObject struct {
+	aliases []string
+	// resolve resolves the field at index i of aliases.
+	resolve func(i int) (interface{}, error)
+	// end, if set, is called once all fields have been written, with the
+	// first error among them.
+	end func(err error)
+}
+
+// streamObjectFields returns the streamedObject of selections on source, a
+// value of typ, followed by its __key. Expensive fields are started right
+// away, so that they are computed while the fields before them are written.
+// Other fields are resolved when they are reached, along with their lazy
+// fields.
+func (e *Executor) streamObjectFields(ctx context.Context, typ *Object, source interface{}, selections []*Selection) *streamedObject {
+	type started struct {
+		value interface{}
+		err   error
+	}
+	aliases := make([]string, 0, len(selections)+1)
+	expensive := make(map[int]started)
+	for i, selection := range selections {
+		aliases = append(aliases, selection.Alias)
+		if field, ok := typ.Fields[selection.Name]; ok && field.Expensive {
+			value, err := e.executeSelection(ctx, typ, source, selection)
+			expensive[i] = started{value: value, err: err}
+		}
+	}
+	if typ.Key != nil {
+		aliases = append(aliases, "__key")
+	}
+
+	return &streamedObject{
+		aliases: aliases,
+		resolve: func(i int) (interface{}, error) {
+			if started, ok := expensive[i]; ok {
+				return started.value, started.err
+			}
+
+			e.mu.Lock()
+			defer e.mu.Unlock()
+			var value interface{}
+			var err error
+			if i == len(selections) {
+				value, err = e.executeKey(ctx, typ, source)
+			} else {
+				value, err = e.executeSelection(ctx, typ, source, selections[i])
+			}
+			if err != nil {
+				return nil, err
+			}
+			return e.resolveLazy(value)
+		},
+	}
+}
+
+// streamCustomFields returns the streamedObject of the fields returned by a
+// CustomResolver for selections.
+func streamCustomFields(selections []*Selection, fields map[string]interface{}) *streamedObject {
+	aliases := make([]string, len(selections))
+	for i, selection := range selections {
+		aliases[i] = selection.Alias
+	}
+	return &streamedObject{
+		aliases: aliases,
+		resolve: func(i int) (interface{}, error) {
+			return fields[aliases[i]], nil
+		},
+	}
+}
+
+// awaitPartial is like await, but replaces failed thunks with fieldErrors
+// instead of failing the whole value.
+func awaitPartial(value interface{}) interface{} {
+	switch value := value.(type) {
+	case *thunk:
+		v, err := value.await()
+		if err != nil {
+			return &fieldError{err: err}
+		}
+		return awaitPartial(v)
+
+	case map[string]interface{}:
+		for k, v := range value {
+			// Only thunks are replaced, so that values already awaited,
+			// which OnResolveEnd hooks may be reading, are left untouched.
+			if _, ok := v.(*thunk); ok {
+				value[k] = awaitPartial(v)
+			} else {
+				awaitPartial(v)
+			}
+		}
+
+	case []interface{}:
+		for i, v := range value {
+			if _, ok := v.(*thunk); ok {
+				value[i] = awaitPartial(v)
+			} else {
+				awaitPartial(v)
+			}
+		}
+	}
+
+	return value
+}
+
+type streamWriter struct {
+	underlying io.Writer
+	w          *bufio.Writer
+	errors     []string
+}
+
+// writeStreamingResponse writes value to w as the data of a JSON response,
+// followed by the errors encountered while writing it.
+func writeStreamingResponse(w io.Writer, path []string, value interface{}) error {
+	s := &streamWriter{underlying: w, w: bufio.NewWriter(w)}
+
+	s.w.WriteString(`{"data":`)
+	if err := s.writeValue(path, value); err != nil {
+		return err
+	}
+	s.w.WriteString(`,"errors":`)
+	if err := s.writeJSON(s.errors); err != nil {
+		return err
+	}
+	s.w.WriteString("}\n")
+
+	return s.flush()
+}
+
+func (s *streamWriter) writeJSON(value interface{}) error {
+	bytes, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = s.w.Write(bytes)
+	return err
+}
+
+// flush sends everything written so far to the underlying writer, so that
+// clients receive output while slow fields are still being computed.
+func (s *streamWriter) flush() error {
+	if err := s.w.Flush(); err != nil {
+		return err
+	}
+	if flusher, ok := s.underlying.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+func (s *streamWriter) writeError(path []string, err error) error {
+	s.errors = append(s.errors, nestPath(path, err).Error())
+	_, werr := s.w.WriteString("null")
+	return werr
+}
+
+func (s *streamWriter) writeValue(path []string, value interface{}) error {
+	switch value := value.(type) {
+	case *thunk:
+		select {
+		case <-value.done:
+		default:
+			// Send what we have before blocking on a slow value.
+			if err := s.flush(); err != nil {
+				return err
+			}
+		}
+		v, err := value.await()
+		if err != nil {
+			return s.writeError(path, err)
+		}
+		return s.writeValue(path, v)
+
+	case *fieldError:
+		return s.writeError(path, value.err)
+
+	case *streamedObject:
+		var resolveErr error
+		s.w.WriteByte('{')
+		for i, alias := range value.aliases {
+			if i > 0 {
+				s.w.WriteByte(',')
+			}
+			if err := s.writeJSON(alias); err != nil {
+				return err
+			}
+			s.w.WriteByte(':')
+			v, err := value.resolve(i)
+			if err != nil {
+				if resolveErr == nil {
+					resolveErr = err
+				}
+				v = &fieldError{err: err}
+			}
+			if err := s.writeValue(append(path, alias), v); err != nil {
+				return err
+			}
+		}
+		if value.end != nil {
+			value.end(resolveErr)
+		}
+		return s.w.WriteByte('}')
+
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for k := range value {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		s.w.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				s.w.WriteByte(',')
+			}
+			if err := s.writeJSON(k); err != nil {
+				return err
+			}
+			s.w.WriteByte(':')
+			if err := s.writeValue(append(path, k), value[k]); err != nil {
+				return err
+			}
+		}
+		return s.w.WriteByte('}')
+
+	case []interface{}:
+		s.w.WriteByte('[')
+		for i, v := range value {
+			if i > 0 {
+				s.w.WriteByte(',')
+			}
+			if err := s.writeValue(append(path, fmt.Sprint(i)), v); err != nil {
+				return err
+			}
+		}
+		return s.w.WriteByte(']')
+
+	default:
+		return s.writeJSON(value)
+	}
+}
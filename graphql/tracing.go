@@ -0,0 +1,37 @@
+package graphql
+
+import "context"
+
+// A Tracer instruments the execution of queries and the resolution of their
+// fields, such as with OpenTelemetry spans or resolver latency metrics. Each
+// Start method returns a context for the work it traces, such as one holding
+// a span, and a function called with the work's error once it finishes.
+type Tracer interface {
+	// StartQuery is called when Execute starts executing query.
+	StartQuery(ctx context.Context, query *Query) (context.Context, func(err error))
+	// StartField is called before the resolver of field is called, and the
+	// returned function once the resolver returns. Resolution of the field's
+	// selections is traced separately, and values cached by a live query's
+	// reruns are not traced again.
+	StartField(ctx context.Context, field TracedField) (context.Context, func(err error))
+}
+
+// A TracedField is a field being resolved, as traced by Tracer.StartField.
+type TracedField struct {
+	// Type is the name of the object whose field is resolved.
+	Type string
+	// Name is the name of the field, and Alias its name in the query.
+	Name  string
+	Alias string
+	// Expensive is true for fields resolved in a goroutine of their own.
+	Expensive bool
+}
+
+// WithTracer makes the executor trace the queries it executes and the fields
+// it resolves with tracer, including the reruns of subscriptions served by a
+// connection.
+func WithTracer(tracer Tracer) ExecutorOption {
+	return func(e *Executor) {
+		e.tracer = tracer
+	}
+}
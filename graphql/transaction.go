@@ -0,0 +1,48 @@
+package graphql
+
+import "context"
+
+// A TxManager runs the fields of a mutation in a shared transaction, so that
+// they all succeed or all roll back.
+type TxManager interface {
+	// Begin starts a transaction, and returns a context carrying it for the
+	// mutation's resolvers.
+	Begin(ctx context.Context) (context.Context, error)
+	// Commit commits the transaction carried by ctx.
+	Commit(ctx context.Context) error
+	// Rollback rolls back the transaction carried by ctx.
+	Rollback(ctx context.Context) error
+}
+
+// WithTxManager makes the executor run every mutation in a transaction of
+// manager. The transaction begins before the mutation's fields are resolved,
+// and is committed once they all succeed. If any fails, or the transaction
+// fails to commit, it is rolled back and Execute returns the error without a
+// result. Resolvers obtain the transaction from their context, in whatever way
+// manager stores it there. Queries do not use transactions, and neither do
+// mutations executed with WithStreamingWriter, which writes the response while
+// it is being resolved.
+func WithTxManager(manager TxManager) ExecutorOption {
+	return func(e *Executor) {
+		e.txManager = manager
+	}
+}
+
+// usesTransaction returns true if the executor runs query in a transaction.
+func (e *Executor) usesTransaction(query *Query) bool {
+	return e.txManager != nil && query.Kind == "mutation" && e.streamingWriter == nil
+}
+
+// finishTransaction commits the transaction carried by ctx if the mutation
+// succeeded, and otherwise rolls it back, returning the mutation's error.
+func (e *Executor) finishTransaction(ctx context.Context, err error) error {
+	if err != nil {
+		e.txManager.Rollback(ctx)
+		return err
+	}
+	if err := e.txManager.Commit(ctx); err != nil {
+		e.txManager.Rollback(ctx)
+		return err
+	}
+	return nil
+}
@@ -3,6 +3,9 @@ package graphql
 import (
 	"context"
 	"fmt"
+	"sort"
+
+	"github.com/graphql-go/graphql/language/ast"
 )
 
 // Type represents a GraphQL type, and should be either an Object, a Scalar,
@@ -17,7 +20,12 @@ type Type interface {
 
 // Scalar is a leaf value
 type Scalar struct {
-	Type string
+	Type           string
+	SpecifiedByURL string // Optional, a URL to the scalar's specification.
+
+	// Serialize, if set, converts resolved values of the scalar to their
+	// output representation. It is not called for null values.
+	Serialize func(value interface{}) (interface{}, error)
 }
 
 func (s *Scalar) isType() {}
@@ -31,6 +39,11 @@ type Enum struct {
 	Type       string
 	Values     []string
 	ReverseMap map[interface{}]string
+
+	// ValueDirectives are the directives applied to values, by value. A
+	// "deprecated" directive marks a value as deprecated, with its "reason"
+	// argument.
+	ValueDirectives map[string][]Directive
 }
 
 func (e *Enum) isType() {}
@@ -49,14 +62,96 @@ type Object struct {
 	Description string
 	Key         Resolver
 	Fields      map[string]*Field
+
+	// DeprecationReason is non-empty if the type has been deprecated.
+	DeprecationReason string
+
+	// FieldOrder, if set, is the order in which Fields are listed by
+	// introspection. Fields missing from FieldOrder follow, sorted by name.
+	FieldOrder []string
+
+	// DefaultResolve, if set, resolves selections of fields that are not in
+	// Fields. It receives the selected field's name and unparsed arguments,
+	// and its result is returned as a scalar.
+	DefaultResolve DefaultResolver
+
+	// OnResolveStart, if set, is called before resolving the selected fields
+	// of each value of the object, and returns the context passed to their
+	// resolvers. An error fails the object's resolution.
+	OnResolveStart ResolveStartHook
+	// OnResolveEnd, if set, is called after resolving the selected fields of
+	// each value of the object, with their result and error.
+	OnResolveEnd ResolveEndHook
+
+	// Interfaces are the interfaces the object implements.
+	Interfaces []*Interface
+
+	// Directives are the directives applied to the type.
+	Directives []Directive
 }
 
+// A Directive is a directive applied to a type, field, or enum value, such as
+// @key(fields: "id"), as metadata for tools that read the schema's SDL. Its
+// Args are printed as GraphQL values.
+type Directive struct {
+	Name string
+	Args map[string]interface{}
+}
+
+// A DefaultResolver resolves a field that is not part of an object's schema.
+type DefaultResolver func(ctx context.Context, source interface{}, name string, args map[string]interface{}) (interface{}, error)
+
+// A ResolveStartHook is called when the executor begins resolving an object's
+// value source, and returns the context for resolving its fields.
+type ResolveStartHook func(ctx context.Context, source interface{}) (context.Context, error)
+
+// A ResolveEndHook is called when the executor has resolved an object's value
+// source, with the resulting fields and error. Expensive fields are resolved
+// in the background, and the hook is then called from another goroutine once
+// they complete.
+type ResolveEndHook func(ctx context.Context, source interface{}, result interface{}, err error)
+
 func (o *Object) isType() {}
 
 func (o *Object) String() string {
 	return o.Name
 }
 
+// Interface is an abstract type with fields shared by the objects that
+// implement it. A value of an interface is executed as the object it resolves
+// to, with that object's fields: the interface's Fields validate queries and
+// parse their arguments, so the objects' fields must accept the arguments
+// parsed by the interface's.
+type Interface struct {
+	Name        string
+	Description string
+	Fields      map[string]*Field
+
+	// Types are the objects implementing the interface, by name.
+	Types map[string]*Object
+
+	// ResolveType returns the object a value of the interface resolves to,
+	// and the value of that object to execute. It returns a nil object for
+	// null values.
+	ResolveType func(value interface{}) (*Object, interface{}, error)
+}
+
+func (i *Interface) isType() {}
+
+// typeNames returns the sorted names of the objects implementing i.
+func (i *Interface) typeNames() []string {
+	names := make([]string, 0, len(i.Types))
+	for name := range i.Types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (i *Interface) String() string {
+	return i.Name
+}
+
 // List is a collection of other values
 type List struct {
 	Type Type
@@ -93,6 +188,7 @@ func (n *NonNull) String() string {
 // Verify *Scalar, *Object, *List, *InputObject, and *NonNull implement Type
 var _ Type = &Scalar{}
 var _ Type = &Object{}
+var _ Type = &Interface{}
 var _ Type = &List{}
 var _ Type = &InputObject{}
 var _ Type = &NonNull{}
@@ -111,6 +207,45 @@ type Field struct {
 	ParseArguments func(json interface{}) (interface{}, error)
 
 	Expensive bool
+
+	// Pure marks the resolver as free of side effects, so that it is safe to
+	// run more than once or speculatively. The values of Pure fields are
+	// cached across the reruns of a live query like those of expensive fields,
+	// while other fields are resolved again on every rerun.
+	Pure bool
+
+	// ListConcurrency, if positive, bounds how many expensive fields of the
+	// elements of the field's list value are resolved at a time.
+	ListConcurrency int
+
+	// Audiences, if non-empty, restricts the field to callers in one of the
+	// audiences, as set with WithAudiences.
+	Audiences []string
+
+	// Versions, if non-empty, restricts the field to callers whose API
+	// version, as returned by Version, is one of them.
+	Versions []string
+	Version  func(ctx context.Context) string
+
+	// Feature, if set, is the feature that must be enabled for the caller for
+	// the field to be resolved, as checked with WithFeatureChecker.
+	Feature string
+
+	// DeprecationReason is non-empty if the field has been deprecated, and
+	// Directives are the directives applied to the field.
+	DeprecationReason string
+	Directives        []Directive
+
+	// Cost, if set, estimates the cost of resolving the field from its parsed
+	// arguments, and CostMultiplier the number of values it returns, by which
+	// the cost of its selections is multiplied, as checked with WithMaxCost.
+	Cost           func(args interface{}) int
+	CostMultiplier func(args interface{}) int
+
+	// Example, if not nil, is an example of the field's value, and
+	// ArgExamples are examples of its arguments by name, for documentation.
+	Example     interface{}
+	ArgExamples map[string]interface{}
 }
 
 type Schema struct {
@@ -161,6 +296,14 @@ type Selection struct {
 	// The parsed flag is used to make sure the args for this Selection are only
 	// parsed once.
 	parsed bool
+
+	// parseArguments is the function that parsed the args, so that a cached
+	// query parses the arguments of each request again.
+	parseArguments func(json interface{}) (interface{}, error)
+
+	// loc is the location of the selection in the query it was parsed from,
+	// at which errors found by PrepareQuery are reported.
+	loc *ast.Location
 }
 
 // A Fragment represents a reusable part of a GraphQL query
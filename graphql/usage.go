@@ -0,0 +1,100 @@
+package graphql
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// FieldUsage counts how often each field of a schema is resolved, to find
+// fields that clients no longer query. Counting is lock-free, so a single
+// FieldUsage can be shared by all executors serving the schema.
+type FieldUsage struct {
+	// counts is populated by NewFieldUsage and never modified afterwards.
+	counts map[*Field]*fieldCount
+}
+
+type fieldCount struct {
+	name string
+	hits int64
+}
+
+// NewFieldUsage creates a FieldUsage tracking every field of the objects
+// reachable from schema's query and mutation types. Fields are named as
+// "Type.field".
+func NewFieldUsage(schema *Schema) *FieldUsage {
+	u := &FieldUsage{counts: make(map[*Field]*fieldCount)}
+	seen := make(map[Type]bool)
+	u.collect(schema.Query, seen)
+	u.collect(schema.Mutation, seen)
+	return u
+}
+
+func (u *FieldUsage) collect(typ Type, seen map[Type]bool) {
+	if typ == nil || seen[typ] {
+		return
+	}
+	seen[typ] = true
+
+	switch typ := typ.(type) {
+	case *Object:
+		for name, field := range typ.Fields {
+			u.counts[field] = &fieldCount{name: typ.Name + "." + name}
+			u.collect(field.Type, seen)
+		}
+	case *Interface:
+		// The fields of the interface are resolved as those of its objects.
+		for _, object := range typ.Types {
+			u.collect(object, seen)
+		}
+	case *List:
+		u.collect(typ.Type, seen)
+	case *NonNull:
+		u.collect(typ.Type, seen)
+	}
+}
+
+// record counts a resolution of field. Fields from outside the schema, such as
+// those added by DefaultResolve, are ignored.
+func (u *FieldUsage) record(field *Field) {
+	if count, ok := u.counts[field]; ok {
+		atomic.AddInt64(&count.hits, 1)
+	}
+}
+
+// Counts returns the number of times each field has been resolved.
+func (u *FieldUsage) Counts() map[string]int64 {
+	counts := make(map[string]int64, len(u.counts))
+	for _, count := range u.counts {
+		counts[count.name] = atomic.LoadInt64(&count.hits)
+	}
+	return counts
+}
+
+// Unused returns the sorted names of the fields that have never been resolved.
+func (u *FieldUsage) Unused() []string {
+	var unused []string
+	for _, count := range u.counts {
+		if atomic.LoadInt64(&count.hits) == 0 {
+			unused = append(unused, count.name)
+		}
+	}
+	sort.Strings(unused)
+	return unused
+}
+
+// ReportUnusedAfter calls report with the fields still unused once period has
+// passed, for example to log them. The report can be cancelled by stopping
+// the returned timer.
+func (u *FieldUsage) ReportUnusedAfter(period time.Duration, report func(unused []string)) *time.Timer {
+	return time.AfterFunc(period, func() {
+		report(u.Unused())
+	})
+}
+
+// WithFieldUsage makes the executor count the fields it resolves in usage.
+func WithFieldUsage(usage *FieldUsage) ExecutorOption {
+	return func(e *Executor) {
+		e.fieldUsage = usage
+	}
+}
@@ -0,0 +1,44 @@
+package graphql
+
+import (
+	"context"
+	"sync"
+)
+
+// A Warning describes a problem that did not fail a query, such as a field
+// that resolved to null because an optional backend was unavailable.
+type Warning struct {
+	Message string `json:"message"`
+}
+
+// warningsKey is the context key for the warnings of a query.
+type warningsKey struct{}
+
+type warnings struct {
+	mu       sync.Mutex
+	warnings []Warning
+}
+
+// WithWarnings returns a context that collects the warnings added with
+// AddWarning while executing a query, and a function that returns the
+// warnings collected so far.
+func WithWarnings(ctx context.Context) (context.Context, func() []Warning) {
+	w := &warnings{}
+	return context.WithValue(ctx, warningsKey{}, w), func() []Warning {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		return append([]Warning(nil), w.warnings...)
+	}
+}
+
+// AddWarning adds a warning for err to the warnings collected in ctx. It does
+// nothing if ctx does not collect warnings.
+func AddWarning(ctx context.Context, err error) {
+	w, ok := ctx.Value(warningsKey{}).(*warnings)
+	if !ok {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.warnings = append(w.warnings, Warning{Message: err.Error()})
+}